@@ -3,16 +3,26 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+	_ "time/tzdata" // on_this_day.timezone on systems without a zone database
 
 	"github.com/Aquila-f/photo-slider/internal/config"
 	"github.com/Aquila-f/photo-slider/internal/domain"
 	"github.com/Aquila-f/photo-slider/internal/handler"
+	"github.com/Aquila-f/photo-slider/internal/index"
 	"github.com/Aquila-f/photo-slider/internal/mapper"
 	"github.com/Aquila-f/photo-slider/internal/photo"
 	"github.com/Aquila-f/photo-slider/internal/service"
 	"github.com/Aquila-f/photo-slider/internal/storage"
+	"github.com/Aquila-f/photo-slider/internal/store"
 	"github.com/Aquila-f/photo-slider/internal/strategy"
 )
 
@@ -47,18 +57,132 @@ func main() {
 		return storage.NewLocalFSProvider(id)
 	})
 
+	// Pick the album strategy: one album per folder, optionally including subfolders.
+	var albumStrategy domain.AlbumStrategy = strategy.NewFolderAlbumStrategy()
+	if cfg.IncludeSubfolders {
+		albumStrategy = strategy.NewRecursiveFolderAlbumStrategy()
+	}
+
 	// Initialize the album service and wire up the registrar.
-	svc := service.NewAlbumService(sourceSvc, albums, strategy.NewFolderAlbumStrategy(), mapper.NewBase64Mapper(), 3)
+	albumMapper := mapper.NewBase64Mapper()
+	svc := service.NewAlbumService(sourceSvc, albums, albumStrategy, albumMapper, 3)
 	sourceSvc.SetRegistrar(svc)
+	svc.SetOriginalAccess(cfg.Originals.Allowed)
+	svc.SetVideoAccess(cfg.Videos.Allowed)
+	svc.SetMetadataPolicy(cfg.Metadata.For)
+	svc.SetRawPairs(cfg.RawPairs)
+
+	// Index photo metadata and fingerprints on every scan so smart albums
+	// and duplicate detection can query it. The index is kept in the data
+	// directory, so only new or modified files are read after a restart.
+	photoIndex, err := index.NewPersistentIndex(filepath.Join(cfg.DataDir, "index.jsonl"), photo.NewEXIFExtractor(), photo.NewImageFingerprinter())
+	if err != nil {
+		log.Fatalf("failed to load photo index: %v", err)
+	}
+	photoIndex.SetVideoExtractor(photo.NewVideoExtractor())
+	svc.SetIndex(photoIndex)
+
+	// Favorites, ratings and hidden marks are keyed by content hash.
+	flagSvc, err := service.NewFlagService(store.NewJSONFile(filepath.Join(cfg.DataDir, "flags.json")), svc, photoIndex)
+	if err != nil {
+		log.Fatalf("failed to load photo flags: %v", err)
+	}
+	svc.SetFlagReader(flagSvc)
+
+	// Per-viewer show history lets slideshows favor photos not seen lately.
+	historySvc, err := service.NewHistoryService(store.NewJSONFile(filepath.Join(cfg.DataDir, "history.json")), svc, photoIndex)
+	if err != nil {
+		log.Fatalf("failed to load show history: %v", err)
+	}
+
+	// Named photo orders for ?order=, with per-album defaults and covers from config.
+	orders := strategy.NewListStrategies()
+	orders["fresh"] = strategy.NewFreshListStrategy(historySvc, flagSvc, false)
+	orders["weighted"] = strategy.NewFreshListStrategy(historySvc, flagSvc, true)
+	svc.SetListStrategies(orders)
+	for _, a := range cfg.Albums {
+		if a.Cover != "" {
+			svc.SetCover(a.Name, a.Cover)
+		}
+		if a.Order == "" {
+			continue
+		}
+		if err := svc.SetDefaultOrder(a.Name, a.Order); err != nil {
+			log.Fatalf("album %q: order %q: %v", a.Name, a.Order, err)
+		}
+	}
+
+	// Group exact and near-duplicate copies after every scan.
+	duplicateSvc := service.NewDuplicateService(cfg.NearDuplicateDistance)
+	svc.AddIndexObserver(duplicateSvc)
+	svc.SetDuplicateFinder(duplicateSvc)
+	duplicateSvc.SetMetadataPolicy(cfg.Metadata.For)
+
+	// Search runs on an inverted index rebuilt after every scan; hits play
+	// through the unlisted album of the whole library.
+	searchSvc := service.NewSearchService(albumMapper)
+	searchSvc.SetFlagReader(flagSvc)
+	searchSvc.SetMetadataPolicy(cfg.Metadata.For)
+	svc.AddIndexObserver(searchSvc)
+
+	// Register smart albums from config and those created at runtime,
+	// persisted in the data directory; they are evaluated after each sync.
+	smartAlbums := make([]domain.SmartAlbum, 0, len(cfg.SmartAlbums))
+	for _, sa := range cfg.SmartAlbums {
+		smartAlbums = append(smartAlbums, domain.SmartAlbum{Name: sa.Name, Query: sa.Query})
+	}
+	smartSvc, err := service.NewSmartAlbumService(store.NewJSONFile(filepath.Join(cfg.DataDir, "smart_albums.json")), smartAlbums)
+	if err != nil {
+		log.Fatalf("failed to load smart albums: %v", err)
+	}
+	smartSvc.SetRefresher(svc)
+	svc.AddVirtualSource(smartSvc)
+
+	// Load hand-picked playlists persisted in the data directory.
+	playlistSvc, err := service.NewPlaylistService(store.NewJSONFile(filepath.Join(cfg.DataDir, "playlists.json")), svc, albumMapper)
+	if err != nil {
+		log.Fatalf("failed to load playlists: %v", err)
+	}
+	playlistSvc.SetRefresher(svc)
+	svc.AddVirtualSource(playlistSvc)
+
+	// Photos taken on today's date in earlier years, rebuilt every midnight.
+	if cfg.OnThisDay.Enabled {
+		loc, err := cfg.OnThisDay.Location()
+		if err != nil {
+			log.Fatalf("on_this_day: %v", err)
+		}
+		onThisDaySvc := service.NewOnThisDayService(cfg.OnThisDay.WindowDays, loc)
+		onThisDaySvc.SetRefresher(svc)
+		svc.AddVirtualSource(onThisDaySvc)
+		go onThisDaySvc.Run(context.Background())
+	}
 
 	if err := svc.SyncAlbums(context.Background()); err != nil {
 		log.Fatalf("failed to sync albums: %v", err)
 	}
 
 	// Wire up the HTTP API and router with image compression and a 256-entry LRU cache.
-	api := handler.NewAlbumAPI(svc, photo.NewImageCompressor(), photo.NewFixedSizeMapCacher(256), photo.NewEXIFExtractor(), strategy.NewRandomListStrategy())
+	api := handler.NewAlbumAPI(svc, photo.NewImageCompressor(), photo.NewFixedSizeMapCacher(256), photo.NewEXIFExtractor())
+	// Only whitelisted sizes are rendered, so clients cannot fill the cache
+	// with arbitrary ones.
+	sizes, dimensions := photo.DefaultSizes, photo.DefaultDimensions
+	if cfg.Renditions.Sizes != nil {
+		sizes = cfg.Renditions.Sizes
+	}
+	if cfg.Renditions.Dimensions != nil {
+		dimensions = cfg.Renditions.Dimensions
+	}
+	api.SetRenditions(photo.NewRenditionPolicy(sizes, dimensions))
 	sourceAPI := handler.NewSourceAPI(sourceSvc)
-	router := handler.SetupRouter(staticFS, api, sourceAPI)
+	smartAPI := handler.NewSmartAlbumAPI(smartSvc)
+	playlistAPI := handler.NewPlaylistAPI(playlistSvc)
+	flagAPI := handler.NewFlagAPI(flagSvc)
+	duplicateAPI := handler.NewDuplicateAPI(duplicateSvc)
+	searchAPI := handler.NewSearchAPI(searchSvc)
+	historyAPI := handler.NewHistoryAPI(historySvc)
+	streamAPI := handler.NewStreamAPI(service.NewStreamService(svc, albumMapper, orders["random"]))
+	router := handler.SetupRouter(staticFS, api, sourceAPI, smartAPI, playlistAPI, flagAPI, duplicateAPI, searchAPI, historyAPI, streamAPI)
 
 	// Log registered sources and albums before starting the server.
 	log.Printf("Serving %d source(s), %d album(s)", len(cfg.Sources), len(albums))
@@ -66,7 +190,25 @@ func main() {
 		log.Printf("  album: %s (%d photos)", a.Name, len(a.Photos))
 	}
 	log.Printf("Open http://localhost:%s", *port)
-	if err := router.Run(":" + *port); err != nil {
-		log.Fatalf("server error: %v", err)
+	srv := &http.Server{Addr: ":" + *port, Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// On shutdown, let requests finish and save the show history batched
+	// since the last flush.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error shutting down: %v", err)
+	}
+	if err := historySvc.Close(); err != nil {
+		log.Printf("error saving show history: %v", err)
 	}
 }
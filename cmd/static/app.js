@@ -1,18 +1,35 @@
+// PAGE_SIZE is how many photos a listing request asks for; the next page is
+// fetched once the slideshow gets within PRELOAD_AHEAD photos of the end.
+const PAGE_SIZE = 200
+const PRELOAD_AHEAD = 5
+
 function slideshow() {
   return {
     albums: [],
     currentAlbum: '',
     photos: [],
+    total: 0,
     current: 0,
     shuffle: false,
+    order: '',
     playing: false,
     interval: 3,
     meta: { takenAt: '', model: '' },
     imageSrc: '',
+    videoSrc: '',
+    motionSrc: '',
     error: '',
     _timer: null,
+    _seed: '',
+    _cursor: '',
+    _listUrl: '',
+    _loadingMore: null,
+    _viewer: '',
     _abortCtrl: null,
     _preloadCache: new Map(),
+    _videos: new Set(),
+    _loops: new Map(),
+    _motions: new Set(),
     _touchStartX: 0,
     _touchStartY: 0,
     expanded: false,
@@ -24,6 +41,11 @@ function slideshow() {
     showSources: false,
 
     async init() {
+      this._viewer = localStorage.getItem('viewer') || ''
+      if (!this._viewer) {
+        this._viewer = crypto.randomUUID ? crypto.randomUUID() : String(Math.random()).slice(2)
+        localStorage.setItem('viewer', this._viewer)
+      }
       await this.loadSources()
       try {
         const res = await fetch('/api/albums')
@@ -101,6 +123,8 @@ function slideshow() {
         this.currentAlbum = ''
         this.photos = []
         this.imageSrc = ''
+        this.videoSrc = ''
+        this.motionSrc = ''
       }
     },
 
@@ -110,9 +134,32 @@ function slideshow() {
       this.current = 0
       this.error = ''
       try {
-        const url = '/api/albums/' + encodeURIComponent(this.currentAlbum) + (this.shuffle ? '?shuffle=true' : '')
-        const res = await fetch(url)
-        this.photos = await res.json() ?? []
+        // A shuffle resumes from the seed and position saved for this album.
+        const saved = this.shuffle ? this._loadShuffle() : null
+        if (!this.shuffle) localStorage.removeItem(this._shuffleKey())
+        const params = new URLSearchParams()
+        if (this.shuffle) params.set('shuffle', 'true')
+        else if (this.order) params.set('order', this.order)
+        if (saved) params.set('seed', saved.seed)
+        params.set('viewer', this._viewer)
+        params.set('limit', PAGE_SIZE)
+        this._listUrl = '/api/albums/' + encodeURIComponent(this.currentAlbum) + '?' + params.toString()
+        const res = await fetch(this._listUrl)
+        const page = await res.json()
+        this._videos.clear()
+        this._loops.clear()
+        this._motions.clear()
+        this.photos = this._addPage(page)
+        this.total = page.Total ?? 0
+        this._cursor = page.NextCursor || ''
+        this._seed = page.Seed || ''
+        if (saved && saved.seed === this._seed && this.photos.length > 0) {
+          for (let n = 0; saved.current >= this.photos.length && this._cursor && n !== this.photos.length;) {
+            n = this.photos.length
+            await this.loadMore()
+          }
+          this.current = Math.min(saved.current, this.photos.length - 1)
+        }
       } catch {
         this.photos = []
         this.error = 'Failed to load photos.'
@@ -122,13 +169,66 @@ function slideshow() {
       if (this.photos.length > 0) await this.loadImage()
     },
 
+    // loadMore appends the next page of the listing, if there is one.
+    loadMore() {
+      if (!this._cursor) return Promise.resolve()
+      if (!this._loadingMore) {
+        const listUrl = this._listUrl
+        this._loadingMore = fetch(listUrl + '&cursor=' + encodeURIComponent(this._cursor))
+          .then(res => res.json())
+          .then(page => {
+            if (listUrl !== this._listUrl) return
+            this.photos.push(...this._addPage(page))
+            this._cursor = page.NextCursor || ''
+          })
+          .catch(() => {})
+          .finally(() => { this._loadingMore = null })
+      }
+      return this._loadingMore
+    },
+
+    // _addPage returns the tokens of a listing page, remembering which are
+    // videos, which have a motion clip and how long animations take to loop.
+    _addPage(page) {
+      const photos = page.Photos ?? []
+      for (const p of photos) {
+        if (p.Type === 'video') this._videos.add(p.Key)
+        if (p.Animated) this._loops.set(p.Key, p.LoopMs)
+        if (p.Motion) this._motions.add(p.Key)
+      }
+      return photos.map(p => p.Key)
+    },
+
+    _reportShown(token) {
+      const url = '/api/albums/' + encodeURIComponent(this.currentAlbum) + '/photos/' + encodeURIComponent(token) +
+        '/shown?viewer=' + encodeURIComponent(this._viewer)
+      fetch(url, { method: 'POST' }).catch(() => {})
+    },
+
+    _shuffleKey() {
+      return 'shuffle:' + this.currentAlbum
+    },
+
+    _loadShuffle() {
+      try {
+        return JSON.parse(localStorage.getItem(this._shuffleKey()))
+      } catch {
+        return null
+      }
+    },
+
+    _saveShuffle() {
+      if (!this.shuffle || !this._seed) return
+      localStorage.setItem(this._shuffleKey(), JSON.stringify({ seed: this._seed, current: this.current }))
+    },
+
     photoUrl(token) {
       return '/photos/' + encodeURIComponent(this.currentAlbum) + '/' + encodeURIComponent(token)
     },
 
     _fetchPhoto(url, signal) {
       if (!this._preloadCache.has(url)) {
-        const promise = fetch(url, { signal }).then(async res => {
+        const promise = fetch(url, { signal, headers: { Accept: 'image/webp,image/*;q=0.8' } }).then(async res => {
           if (!res.ok) throw new Error('Network response was not ok');
           return {
             blob: await res.blob(),
@@ -151,6 +251,7 @@ function slideshow() {
       this._abortCtrl = new AbortController()
       const signal = this._abortCtrl.signal
       const target = this.current
+      this._saveShuffle()
 
       try {
         const url = this.photoUrl(this.photos[target])
@@ -166,6 +267,19 @@ function slideshow() {
         }
         if (this.imageSrc) URL.revokeObjectURL(this.imageSrc)
         this.imageSrc = URL.createObjectURL(data.blob)
+        this.motionSrc = ''
+        // Videos play over their poster; a playing slideshow waits for the
+        // clip to end instead of the timer.
+        const token = this.photos[target]
+        this.videoSrc = this._videos.has(token) ? this.photoUrl(token) + '/video' : ''
+        if (this.videoSrc && this.playing) clearInterval(this._timer)
+        // Animations stay up until they have played through at least once.
+        const loop = this._loops.get(token) ?? 0
+        if (!this.videoSrc && this.playing && loop > this.interval * 1000) {
+          clearInterval(this._timer)
+          this._timer = setInterval(() => this.next(), loop)
+        }
+        this._reportShown(this.photos[target])
       } catch (e) {
         if (e.name === 'AbortError') return
         this.meta = { takenAt: '', model: '' }
@@ -173,7 +287,24 @@ function slideshow() {
       }
     },
 
+    hasMotion() {
+      return this._motions.has(this.photos[this.current])
+    },
+
+    // playMotion plays the clip of a Live Photo or motion photo once over
+    // its still.
+    playMotion() {
+      this.motionSrc = this.photoUrl(this.photos[this.current]) + '/motion'
+    },
+
+    // imageFailed reports photos the browser cannot show, such as HEIC photos
+    // outside Safari, which are sent as they are.
+    imageFailed() {
+      if (this.imageSrc) this.error = 'This browser cannot show this photo.'
+    },
+
     preloadAdjacent(index) {
+      if (index >= this.photos.length - PRELOAD_AHEAD) this.loadMore()
       const targets = [
         (index + 1) % this.photos.length,
         (index - 1 + this.photos.length) % this.photos.length,
@@ -188,13 +319,18 @@ function slideshow() {
       this._preloadCache.clear()
     },
 
-    next() {
+    async next() {
+      if (this.current + 1 >= this.photos.length) await this.loadMore()
       this.current = (this.current + 1) % this.photos.length
       this.loadImage()
       this.preloadAdjacent(this.current)
       this.restartIfPlaying()
     },
 
+    videoEnded() {
+      if (this.playing) this.next()
+    },
+
     prev() {
       this.current = (this.current - 1 + this.photos.length) % this.photos.length
       this.loadImage()
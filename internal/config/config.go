@@ -4,12 +4,163 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/Aquila-f/photo-slider/internal/domain"
 	"github.com/goccy/go-yaml"
 )
 
 type Config struct {
 	Sources []string `yaml:"sources"`
+	// IncludeSubfolders makes every album also contain the photos of its subfolders.
+	IncludeSubfolders bool         `yaml:"include_subfolders"`
+	SmartAlbums       []SmartAlbum `yaml:"smart_albums"`
+	// Albums holds per-album settings, matched by album name.
+	Albums []AlbumConfig `yaml:"albums"`
+	// DataDir holds the files photo-slider writes, such as playlists.
+	DataDir string `yaml:"data_dir"`
+	// NearDuplicateDistance is the largest number of differing dHash bits for
+	// two photos to count as near duplicates; negative disables the check.
+	NearDuplicateDistance int       `yaml:"near_duplicate_distance"`
+	OnThisDay             OnThisDay `yaml:"on_this_day"`
+	// Renditions whitelists the photo sizes clients may ask for.
+	Renditions Renditions `yaml:"renditions"`
+	// Originals decides which sources serve their original files.
+	Originals SourceSwitch `yaml:"originals"`
+	// Videos decides which sources stream their videos for playback; unset,
+	// it follows Originals.
+	Videos *SourceSwitch `yaml:"videos"`
+	// RawPairs picks which file of a RAW+JPEG pair albums show: "both",
+	// "jpeg" or "raw".
+	RawPairs string `yaml:"raw_pairs"`
+	// Metadata decides which metadata photos are served with.
+	Metadata Metadata `yaml:"metadata"`
+}
+
+// SourceSwitch turns something on or off per source. Sources maps source
+// directories to an override of Enabled, which applies to every other
+// source, including those added at runtime.
+type SourceSwitch struct {
+	Enabled bool            `yaml:"enabled"`
+	Sources map[string]bool `yaml:"sources"`
+}
+
+// Allowed reports whether the switch is on for the source with the given
+// ID, its absolute directory.
+func (s SourceSwitch) Allowed(sourceID string) bool {
+	if allowed, ok := s.Sources[sourceID]; ok {
+		return allowed
+	}
+	return s.Enabled
+}
+
+// absolute makes the directories of Sources absolute, as source IDs are;
+// name is the setting's name for errors.
+func (s *SourceSwitch) absolute(name string) error {
+	sources := make(map[string]bool, len(s.Sources))
+	for dir, allowed := range s.Sources {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("%s.sources invalid path %q: %w", name, dir, err)
+		}
+		sources[abs] = allowed
+	}
+	s.Sources = sources
+	return nil
+}
+
+// Metadata decides which metadata the photos of each source are served with.
+// Sources maps source directories to a rule of their own; the inline rule
+// applies to every other source, including those added at runtime.
+type Metadata struct {
+	MetadataRule `yaml:",inline"`
+	Sources      map[string]MetadataRule `yaml:"sources"`
+}
+
+// MetadataRule is a metadata policy: "keep" serves metadata as it is stored,
+// "strip" removes all of it, "orientation" keeps only the orientation and
+// "allowlist" keeps the Fields listed.
+type MetadataRule struct {
+	Policy string   `yaml:"policy"`
+	Fields []string `yaml:"fields"`
+}
+
+// For returns the policy of the source with the given ID, its absolute
+// directory.
+func (m Metadata) For(sourceID string) domain.MetadataPolicy {
+	rule, ok := m.Sources[sourceID]
+	if !ok {
+		rule = m.MetadataRule
+	}
+	switch rule.Policy {
+	case "strip":
+		return domain.MetadataPolicy{Strip: true}
+	case "orientation":
+		return domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaOrientation}}
+	case "allowlist":
+		return domain.MetadataPolicy{Strip: true, Keep: rule.Fields}
+	}
+	return domain.MetadataPolicy{}
+}
+
+func (r MetadataRule) validate() error {
+	switch r.Policy {
+	case "keep", "strip", "orientation":
+		if len(r.Fields) > 0 {
+			return fmt.Errorf("fields only apply to the allowlist policy")
+		}
+	case "allowlist":
+		for _, f := range r.Fields {
+			if !slices.Contains(domain.MetaFields, f) {
+				return fmt.Errorf("unknown field %q, want one of %s", f, strings.Join(domain.MetaFields, ", "))
+			}
+		}
+	default:
+		return fmt.Errorf("policy must be \"keep\", \"strip\", \"orientation\" or \"allowlist\"")
+	}
+	return nil
+}
+
+// Renditions lists the named sizes, by long edge in pixels with 0 for the
+// original, and the widths and heights allowed for ?w= and ?h=. Unset lists
+// keep the built-in defaults.
+type Renditions struct {
+	Sizes      map[string]int `yaml:"sizes"`
+	Dimensions []int          `yaml:"dimensions"`
+}
+
+// OnThisDay configures the album of photos taken on today's date in earlier
+// years. WindowDays widens the match to that many days either side; Timezone
+// is an IANA name deciding when the day changes, empty for the local zone.
+type OnThisDay struct {
+	Enabled    bool   `yaml:"enabled"`
+	WindowDays int    `yaml:"window_days"`
+	Timezone   string `yaml:"timezone"`
+}
+
+// Location returns the zone named by Timezone, or the local zone if it is
+// empty.
+func (o OnThisDay) Location() (*time.Location, error) {
+	if o.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(o.Timezone)
+}
+
+// SmartAlbum is a virtual album of every photo matching Query.
+type SmartAlbum struct {
+	Name  string `yaml:"name"`
+	Query string `yaml:"query"`
+}
+
+// AlbumConfig sets the default photo order and the cover photo, by file
+// name, of the albums named Name.
+type AlbumConfig struct {
+	Name  string `yaml:"name"`
+	Order string `yaml:"order"`
+	Cover string `yaml:"cover"`
 }
 
 func Load(path string) (*Config, error) {
@@ -18,7 +169,8 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
 
-	var cfg Config
+	cfg := Config{DataDir: "data", NearDuplicateDistance: 5, OnThisDay: OnThisDay{Enabled: true}, Originals: SourceSwitch{Enabled: true}, RawPairs: domain.RawPairsBoth,
+		Metadata: Metadata{MetadataRule: MetadataRule{Policy: "keep"}}}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
@@ -35,5 +187,68 @@ func Load(path string) (*Config, error) {
 		cfg.Sources[i] = abs
 	}
 
+	// Source IDs are absolute paths, so overrides must be too.
+	if err := cfg.Originals.absolute("originals"); err != nil {
+		return nil, err
+	}
+	if cfg.Videos == nil {
+		videos := cfg.Originals
+		cfg.Videos = &videos
+	} else if err := cfg.Videos.absolute("videos"); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Metadata.validate(); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	rules := make(map[string]MetadataRule, len(cfg.Metadata.Sources))
+	for dir, rule := range cfg.Metadata.Sources {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("metadata.sources invalid path %q: %w", dir, err)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("metadata.sources %q: %w", dir, err)
+		}
+		rules[abs] = rule
+	}
+	cfg.Metadata.Sources = rules
+
+	for i, sa := range cfg.SmartAlbums {
+		if sa.Name == "" {
+			return nil, fmt.Errorf("smart_albums[%d] missing name", i)
+		}
+	}
+
+	for i, a := range cfg.Albums {
+		if a.Name == "" {
+			return nil, fmt.Errorf("albums[%d] missing name", i)
+		}
+	}
+
+	for name, edge := range cfg.Renditions.Sizes {
+		if edge < 0 {
+			return nil, fmt.Errorf("renditions.sizes.%s must not be negative", name)
+		}
+	}
+	for i, d := range cfg.Renditions.Dimensions {
+		if d <= 0 {
+			return nil, fmt.Errorf("renditions.dimensions[%d] must be positive", i)
+		}
+	}
+
+	switch cfg.RawPairs {
+	case domain.RawPairsBoth, domain.RawPairsJPEG, domain.RawPairsRaw:
+	default:
+		return nil, fmt.Errorf("raw_pairs must be %q, %q or %q", domain.RawPairsBoth, domain.RawPairsJPEG, domain.RawPairsRaw)
+	}
+
+	if cfg.OnThisDay.WindowDays < 0 {
+		return nil, fmt.Errorf("on_this_day.window_days must not be negative")
+	}
+	if _, err := cfg.OnThisDay.Location(); err != nil {
+		return nil, fmt.Errorf("on_this_day.timezone: %w", err)
+	}
+
 	return &cfg, nil
 }
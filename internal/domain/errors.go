@@ -15,4 +15,17 @@ var (
 	ErrSourceNotFound = &DomainError{Code: "SOURCE_NOT_FOUND", Message: "Source not found"}
 	ErrAlbumNotFound  = &DomainError{Code: "ALBUM_NOT_FOUND", Message: "Album not found"}
 	ErrPhotoNotFound  = &DomainError{Code: "PHOTO_NOT_FOUND", Message: "Photo not found"}
+	ErrInvalidQuery   = &DomainError{Code: "INVALID_QUERY", Message: "Invalid query"}
+
+	ErrPlaylistNotFound = &DomainError{Code: "PLAYLIST_NOT_FOUND", Message: "Playlist not found"}
+	ErrInvalidRating    = &DomainError{Code: "INVALID_RATING", Message: "Rating must be between 0 and 5"}
+	ErrInvalidOrder     = &DomainError{Code: "INVALID_ORDER", Message: "Unknown photo order"}
+	ErrInvalidMode      = &DomainError{Code: "INVALID_MODE", Message: "Unknown stream mode"}
+	ErrInvalidSort      = &DomainError{Code: "INVALID_SORT", Message: "Unknown album sort"}
+	ErrInvalidRendition = &DomainError{Code: "INVALID_RENDITION", Message: "Rendition not allowed"}
+	ErrNoPoster         = &DomainError{Code: "NO_POSTER", Message: "Video has no poster image"}
+	ErrOriginalDenied   = &DomainError{Code: "ORIGINAL_DENIED", Message: "Original files of this source are not served"}
+	ErrVideoDenied      = &DomainError{Code: "VIDEO_DENIED", Message: "Videos of this source are not streamed"}
+	ErrNoMotion         = &DomainError{Code: "NO_MOTION", Message: "Photo has no motion clip"}
+	ErrMetadataKept     = &DomainError{Code: "METADATA_KEPT", Message: "Photo metadata cannot be removed from this file"}
 )
@@ -2,6 +2,9 @@ package domain
 
 import (
 	"context"
+	"io"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -11,9 +14,11 @@ type Source struct {
 }
 
 type FileInfo struct {
-	Name  string
-	Path  string
-	IsDir bool
+	Name    string
+	Path    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
 }
 
 type DirSnapshot struct {
@@ -25,32 +30,170 @@ type StorageProvider interface {
 	ListDir(ctx context.Context, path string) ([]FileInfo, error)
 	Walk(ctx context.Context, root string, maxDepth int) ([]DirSnapshot, error)
 	ReadFile(ctx context.Context, filePath string) ([]byte, error)
+	// Open opens a file for streaming. The caller closes it.
+	Open(ctx context.Context, filePath string) (io.ReadSeekCloser, FileInfo, error)
 }
 
+// AlbumItem summarizes a listed album. Source is empty for virtual albums.
+// Cover is the token of the photo that stands for the album. Count, Bytes and
+// the capture date range cover the photos that are not hidden; TakenFrom and
+// TakenTo are nil when none has a capture date.
 type AlbumItem struct {
+	Name      string
+	Key       string
+	Source    string
+	Count     int
+	Cover     string
+	TakenFrom *time.Time
+	TakenTo   *time.Time
+	Bytes     int64
+}
+
+// Album sort orders for AlbumFilter.Sort.
+const (
+	AlbumSortName  = "name"
+	AlbumSortDate  = "date"
+	AlbumSortCount = "count"
+	AlbumSortSize  = "size"
+)
+
+// AlbumFilter narrows and sorts album listings. Zero fields match every album,
+// and albums are sorted by name unless Sort says otherwise.
+type AlbumFilter struct {
+	// Name matches a case-insensitive substring of the album name.
 	Name string
-	Key  string
+	// TakenFrom and TakenTo keep albums with photos taken in [TakenFrom,
+	// TakenTo).
+	TakenFrom time.Time
+	TakenTo   time.Time
+	MinCount  int
+	MinBytes  int64
+	Sort      string
+	Desc      bool
 }
 
+// AlbumNode is an album in the folder hierarchy. ParentKey is empty for
+// top-level albums.
+type AlbumNode struct {
+	Name      string
+	Key       string
+	ParentKey string
+	Count     int
+	Children  []AlbumNode
+}
+
+// PhotoInfo is a photo within an album. FilePath is the token clients use to
+// address it; SourceID and Path locate the file within its source.
 type PhotoInfo struct {
 	AlbumName string
 	FilePath  string
+	SourceID  string
+	Path      string
+	// Motion is the path of the Live Photo clip paired with a still, relative
+	// to the source root like Path; empty if there is none.
+	Motion string
+}
+
+// Archive lists the photos packed into an album download. Name is the album
+// name, and each entry's Name is its unique path inside the archive.
+type Archive struct {
+	Name    string
+	Entries []ArchiveEntry
+}
+
+// ArchiveEntry is a photo of an Archive, addressed by its album token.
+type ArchiveEntry struct {
+	Token string
+	Name  string
 }
 
+// PhotoPage is one page of an album listing. Total counts every listed
+// photo. Seed is the seed random orders used and NextCursor, empty on the last
+// page, continues the listing in the same order.
+type PhotoPage struct {
+	Total      int
+	Seed       string
+	NextCursor string
+	Photos     []PhotoItem
+}
+
+// PhotoItem is a photo in an album listing. Key is its token within the
+// album, Name its file name and Type its MediaType. Animated images also say
+// how many milliseconds one loop of the animation lasts. Motion marks Live
+// Photos and motion photos, whose clip plays from the motion endpoint.
+type PhotoItem struct {
+	Key      string
+	Name     string
+	Type     string
+	Animated bool
+	LoopMs   int
+	Motion   bool
+}
+
+// Album is a named list of photos. Folder albums read their photos from Dir
+// in a single source; virtual albums have no SourceID and may span sources.
+// Unlisted albums can be played by key but are left out of album listings.
 type Album struct {
 	UID      string
 	SourceID string
 	Name     string
 	Dir      string
 	Photos   []PhotoInfo
+	Unlisted bool
+}
+
+func (a *Album) IsVirtual() bool {
+	return a.SourceID == ""
+}
+
+// Photo returns the photo addressed by token.
+func (a *Album) Photo(token string) (PhotoInfo, bool) {
+	for _, p := range a.Photos {
+		if p.FilePath == token {
+			return p, true
+		}
+	}
+	return PhotoInfo{}, false
+}
+
+// ParentDir returns the folder a source-relative dir, such as an album's
+// Dir, lies in, "" for a top-level folder.
+func ParentDir(dir string) string {
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		return dir[:i]
+	}
+	return ""
 }
 
 type AlbumStrategy interface {
 	GenerateAlbums(ctx context.Context, snaps []DirSnapshot, sourceId string) ([]Album, error)
 }
 
+// VirtualAlbumSource builds albums that are not tied to a single folder from
+// the indexed photo records. Photos only need SourceID and Path set.
+type VirtualAlbumSource interface {
+	VirtualAlbums(ctx context.Context, records []PhotoRecord) ([]Album, error)
+}
+
+// VirtualAlbumRefresher is implemented by AlbumService so that services owning
+// virtual album definitions can rebuild them after a change.
+type VirtualAlbumRefresher interface {
+	RefreshVirtualAlbums(ctx context.Context) error
+}
+
+// PhotoListStrategy puts the photos of an album in playing order. It returns
+// a new slice and leaves photos as it was.
 type PhotoListStrategy interface {
-	Arrange(ctx context.Context, tokens []string) ([]string, error)
+	Arrange(ctx context.Context, photos []PhotoInfo, opts ArrangeOptions) ([]PhotoInfo, error)
+}
+
+// ArrangeOptions carries the per-listing inputs of a PhotoListStrategy.
+type ArrangeOptions struct {
+	// Seed makes random orders reproducible: the same photos and seed always
+	// give the same order.
+	Seed uint64
+	// Viewer identifies the screen or person the photos are listed for.
+	Viewer string
 }
 
 type Mapper interface {
@@ -71,6 +214,13 @@ type AlbumRegistrar interface {
 type PhotoMeta struct {
 	TakenAt *time.Time
 	Model   string
+	// Rating is the 1-5 star rating stored in the file's XMP, 0 if unrated.
+	Rating int
+	// Keywords and Caption come from the XMP dc:subject and dc:description.
+	Keywords []string
+	Caption  string
+	// Motion reports a motion photo: a JPEG with a video clip appended.
+	Motion bool
 }
 
 func (m *PhotoMeta) Headers() map[string]string {
@@ -84,6 +234,260 @@ func (m *PhotoMeta) Headers() map[string]string {
 	return h
 }
 
+// Metadata fields a MetadataPolicy can keep.
+const (
+	MetaOrientation = "orientation"
+	MetaTakenAt     = "taken_at"
+	MetaModel       = "model"
+	MetaRating      = "rating"
+	MetaKeywords    = "keywords"
+	MetaCaption     = "caption"
+)
+
+// MetaFields lists every metadata field a MetadataPolicy can keep.
+var MetaFields = []string{MetaOrientation, MetaTakenAt, MetaModel, MetaRating, MetaKeywords, MetaCaption}
+
+// MetadataPolicy decides which metadata the photos of a source are served
+// with, in their bytes, headers and JSON alike. The zero policy serves
+// metadata as it is stored; with Strip set, only the fields in Keep are
+// served and everything else, such as GPS positions and serial numbers, is
+// removed.
+type MetadataPolicy struct {
+	Strip bool
+	Keep  []string
+}
+
+// Keeps reports whether the policy serves field.
+func (p MetadataPolicy) Keeps(field string) bool {
+	return !p.Strip || slices.Contains(p.Keep, field)
+}
+
+// Filter returns the part of meta the policy keeps.
+func (p MetadataPolicy) Filter(meta *PhotoMeta) *PhotoMeta {
+	if meta == nil || !p.Strip {
+		return meta
+	}
+	kept := &PhotoMeta{Motion: meta.Motion}
+	if p.Keeps(MetaTakenAt) {
+		kept.TakenAt = meta.TakenAt
+	}
+	if p.Keeps(MetaModel) {
+		kept.Model = meta.Model
+	}
+	if p.Keeps(MetaRating) {
+		kept.Rating = meta.Rating
+	}
+	if p.Keeps(MetaKeywords) {
+		kept.Keywords = meta.Keywords
+	}
+	if p.Keeps(MetaCaption) {
+		kept.Caption = meta.Caption
+	}
+	return kept
+}
+
+// FilterRecord returns rec without the metadata the policy does not keep.
+func (p MetadataPolicy) FilterRecord(rec PhotoRecord) PhotoRecord {
+	if !p.Strip {
+		return rec
+	}
+	meta := p.Filter(&PhotoMeta{TakenAt: rec.TakenAt, Model: rec.Model, Rating: rec.Rating, Keywords: rec.Keywords, Caption: rec.Caption})
+	rec.TakenAt, rec.Model, rec.Rating, rec.Keywords, rec.Caption = meta.TakenAt, meta.Model, meta.Rating, meta.Keywords, meta.Caption
+	return rec
+}
+
+// PhotoRecord is the indexed metadata of a single photo. Path is relative to
+// the source root.
+type PhotoRecord struct {
+	SourceID string
+	Path     string
+	// Size and ModTime are what the file looked like when it was read; an
+	// unchanged pair lets a rescan reuse the record.
+	Size     int64
+	ModTime  time.Time
+	TakenAt  *time.Time
+	Model    string
+	Rating   int
+	Keywords []string
+	Caption  string
+	// Hash is the hex SHA-256 of the file content, so it survives renames.
+	Hash      string
+	Width     int
+	Height    int
+	DHash     uint64
+	Animation time.Duration
+	// Motion reports a motion photo, whose JPEG embeds a video clip.
+	Motion bool
+}
+
+// IndexReader is the read side of a PhotoIndex.
+type IndexReader interface {
+	Records(ctx context.Context) []PhotoRecord
+	Get(sourceID, path string) (PhotoRecord, bool)
+}
+
+// PhotoIndex holds metadata for every photo of every source, refreshed
+// whenever a source is scanned.
+type PhotoIndex interface {
+	IndexReader
+	IndexSource(ctx context.Context, src *Source, snaps []DirSnapshot) error
+	RemoveSource(sourceID string)
+}
+
+// IndexConsumer is implemented by strategies that look photos up in the
+// index instead of relying on file names alone.
+type IndexConsumer interface {
+	SetIndex(index IndexReader)
+}
+
+// IndexObserver is notified with every indexed record after sources are
+// scanned or removed.
+type IndexObserver interface {
+	IndexChanged(ctx context.Context, records []PhotoRecord)
+}
+
+// Fingerprint describes what an image looks like rather than its bytes.
+// Width and Height are after EXIF orientation; DHash is a perceptual hash.
+// Animation is how long one loop of an animated image lasts, 0 for stills.
+type Fingerprint struct {
+	Width     int
+	Height    int
+	DHash     uint64
+	Animation time.Duration
+}
+
+type Fingerprinter interface {
+	Fingerprint(ctx context.Context, data []byte) (Fingerprint, error)
+}
+
+// DuplicateGroup is a set of copies of the same shot. Photos[0] is the copy
+// with the highest resolution. Exact is true when all copies are identical
+// files.
+type DuplicateGroup struct {
+	Exact  bool
+	Photos []PhotoRecord
+}
+
+// DuplicateFinder locates photos within their duplicate group.
+type DuplicateFinder interface {
+	// DuplicateOf returns the group of ref and its rank in it, rank 0 being
+	// the copy to keep. ok is false for photos without duplicates.
+	DuplicateOf(ref PhotoRef) (group, rank int, ok bool)
+}
+
+// SmartAlbum is a virtual album made of every photo matching Query.
+type SmartAlbum struct {
+	Name  string
+	Query string
+}
+
+// Playlist is a hand-picked, ordered list of photos that plays as the album
+// with the given Key.
+type Playlist struct {
+	ID     string
+	Key    string
+	Name   string
+	Photos []PhotoRef
+}
+
+// PhotoFlags are the user's marks on a photo. Rating is 1-5, or 0 if unrated.
+type PhotoFlags struct {
+	Favorite bool
+	Rating   int
+	Hidden   bool
+}
+
+// FlagUpdate changes the flags whose fields are set.
+type FlagUpdate struct {
+	Favorite *bool
+	Rating   *int
+	Hidden   *bool
+}
+
+// FreshHorizon is how long after being shown a photo is fully fresh again.
+// Show history older than that no longer matters.
+const FreshHorizon = 30 * 24 * time.Hour
+
+// ShowHistory reports when a viewer was last shown an indexed photo.
+type ShowHistory interface {
+	LastShown(viewer string, rec PhotoRecord) (time.Time, bool)
+}
+
+// FlagReader reports the flags of an indexed photo.
+type FlagReader interface {
+	Flags(ctx context.Context, rec PhotoRecord) PhotoFlags
+}
+
+// SearchHit is a photo found by a search. Key is its token within the
+// SearchResult's Album; Type is its MediaType.
+type SearchHit struct {
+	Key      string
+	Type     string
+	SourceID string
+	Path     string
+	TakenAt  *time.Time
+	Model    string
+}
+
+// SearchResult is one page of search hits. Total counts every hit.
+type SearchResult struct {
+	Total  int
+	Album  string
+	Photos []SearchHit
+}
+
+// Stream modes decide how a PhotoStream interleaves its albums.
+const (
+	// StreamRoundRobin takes one photo from each album in turn.
+	StreamRoundRobin = "round_robin"
+	// StreamProportional spreads every album evenly over the stream, so
+	// larger albums show up more often.
+	StreamProportional = "proportional"
+	// StreamRandom shuffles the photos of all albums together.
+	StreamRandom = "random"
+)
+
+// PhotoStream interleaves the photos of several albums. Every Key is a token
+// of the album Album, so photos are served without knowing where they came
+// from.
+type PhotoStream struct {
+	Album  string
+	Photos []StreamPhoto
+}
+
+// StreamPhoto is a photo of a PhotoStream and the album it was taken from.
+// Type is its MediaType.
+type StreamPhoto struct {
+	Key       string
+	Type      string
+	AlbumKey  string
+	AlbumName string
+}
+
+// ListOptions narrows the photos listed for an album. Hidden photos are
+// always left out.
+type ListOptions struct {
+	FavoritesOnly bool
+	MinRating     int
+	// CollapseDuplicates keeps only the best copy of duplicates in the list.
+	CollapseDuplicates bool
+	// Order names the PhotoListStrategy applied after the album's default
+	// order; empty keeps the default.
+	Order  string
+	Seed   uint64
+	Viewer string
+	// Snapshot names the listing of a paged slideshow. Later pages under the
+	// same name read the listing the first page was cut from, so orders that
+	// change as photos are shown stay stable from page to page.
+	Snapshot string
+}
+
 type MetaExtractor interface {
 	Extract(ctx context.Context, data []byte) (*PhotoMeta, error)
 }
+
+// VideoMetaExtractor reads the metadata of a video from the file itself, as
+// videos are too large to load whole.
+type VideoMetaExtractor interface {
+	ExtractVideo(ctx context.Context, r io.ReadSeeker) (*PhotoMeta, error)
+}
@@ -0,0 +1,38 @@
+package domain
+
+import "strings"
+
+// refSep separates source ID and path in a photo ref; it cannot appear in
+// file paths.
+const refSep = "\x00"
+
+// PhotoRef locates a photo independently of any album.
+type PhotoRef struct {
+	SourceID string
+	Path     string
+}
+
+// AlbumPhoto addresses a photo the way clients see it: an album key and a
+// photo token from that album's listing.
+type AlbumPhoto struct {
+	AlbumKey string
+	Token    string
+}
+
+// EncodePhotoRef builds a token that addresses a photo across all sources.
+func EncodePhotoRef(m Mapper, sourceID, path string) string {
+	return m.Encode(sourceID + refSep + path)
+}
+
+// DecodePhotoRef reverses EncodePhotoRef.
+func DecodePhotoRef(m Mapper, token string) (sourceID, path string, err error) {
+	raw, err := m.Decode(token)
+	if err != nil {
+		return "", "", ErrPhotoNotFound
+	}
+	sourceID, path, ok := strings.Cut(raw, refSep)
+	if !ok {
+		return "", "", ErrPhotoNotFound
+	}
+	return sourceID, path, nil
+}
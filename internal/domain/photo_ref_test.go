@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+// plainMapper is an identity Mapper so encoded refs stay readable in tests.
+type plainMapper struct{}
+
+func (plainMapper) Encode(name string) string         { return name }
+func (plainMapper) Decode(key string) (string, error) { return key, nil }
+
+func TestPhotoRef_RoundTrip(t *testing.T) {
+	token := EncodePhotoRef(plainMapper{}, "/home/photos", "2024/a b.jpg")
+
+	sourceID, path, err := DecodePhotoRef(plainMapper{}, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sourceID != "/home/photos" || path != "2024/a b.jpg" {
+		t.Errorf("decoded (%q, %q), want (%q, %q)", sourceID, path, "/home/photos", "2024/a b.jpg")
+	}
+}
+
+func TestPhotoRef_DecodeInvalid(t *testing.T) {
+	if _, _, err := DecodePhotoRef(plainMapper{}, "no-separator"); !errors.Is(err, ErrPhotoNotFound) {
+		t.Errorf("expected ErrPhotoNotFound, got: %v", err)
+	}
+}
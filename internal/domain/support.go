@@ -5,11 +5,72 @@ import (
 	"strings"
 )
 
+// Which file of a RAW+JPEG pair, a RAW file and a JPEG with the same name in
+// the same folder, albums show.
+const (
+	RawPairsBoth = "both"
+	RawPairsJPEG = "jpeg"
+	RawPairsRaw  = "raw"
+)
+
+// Media types of album items.
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+)
+
 var imageExts = map[string]struct{}{
-	".jpg": {}, ".jpeg": {}, ".png": {}, ".webp": {},
+	".jpg": {}, ".jpeg": {}, ".png": {}, ".webp": {}, ".gif": {}, ".heic": {}, ".heif": {},
+}
+
+// rawExts are camera RAW formats, shown through their embedded previews.
+var rawExts = map[string]struct{}{
+	".cr2": {}, ".nef": {}, ".arw": {}, ".dng": {}, ".raf": {},
 }
 
+var videoExts = map[string]struct{}{
+	".mp4": {}, ".mov": {}, ".webm": {},
+}
+
+// IsImage reports whether name is a photo albums list. HEIC and HEIF files
+// count even though only those embedding a JPEG can be resized or hashed;
+// phone HEICs, which hold HEVC images only, are served as HEIC, which most
+// browsers other than Safari cannot show.
 func IsImage(name string) bool {
 	_, ok := imageExts[strings.ToLower(filepath.Ext(name))]
+	return ok || IsRaw(name)
+}
+
+func IsRaw(name string) bool {
+	_, ok := rawExts[strings.ToLower(filepath.Ext(name))]
 	return ok
 }
+
+func IsJPEG(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+func IsVideo(name string) bool {
+	_, ok := videoExts[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// IsLivePhotoClip reports whether name is the video half of an Apple Live
+// Photo, a QuickTime clip stored next to a still of the same name.
+func IsLivePhotoClip(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".mov")
+}
+
+// IsMedia reports whether name is a file albums show: an image or a video.
+func IsMedia(name string) bool {
+	return IsImage(name) || IsVideo(name)
+}
+
+// MediaType returns MediaVideo for videos and MediaImage for anything else.
+func MediaType(name string) string {
+	if IsVideo(name) {
+		return MediaVideo
+	}
+	return MediaImage
+}
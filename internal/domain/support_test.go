@@ -13,6 +13,14 @@ func TestIsImage(t *testing.T) {
 		{"jpeg", "photo.jpeg", true},
 		{"png", "photo.png", true},
 		{"webp", "photo.webp", true},
+		{"gif", "photo.gif", true},
+		{"heic", "IMG_0001.HEIC", true},
+		{"heif", "photo.heif", true},
+		{"cr2", "photo.CR2", true},
+		{"nef", "photo.NEF", true},
+		{"arw", "photo.ARW", true},
+		{"dng", "photo.dng", true},
+		{"raf", "photo.RAF", true},
 
 		// case insensitive
 		{"JPG uppercase", "photo.JPG", true},
@@ -22,7 +30,6 @@ func TestIsImage(t *testing.T) {
 		{"mixed case", "photo.JpG", true},
 
 		// unsupported extensions
-		{"gif", "photo.gif", false},
 		{"mp4", "video.mp4", false},
 		{"txt", "readme.txt", false},
 
@@ -43,3 +50,27 @@ func TestIsImage(t *testing.T) {
 		})
 	}
 }
+
+func TestIsMedia(t *testing.T) {
+	tests := []struct {
+		filename string
+		media    bool
+		kind     string
+	}{
+		{"photo.jpg", true, MediaImage},
+		{"clip.mp4", true, MediaVideo},
+		{"clip.MOV", true, MediaVideo},
+		{"clip.webm", true, MediaVideo},
+		{"clip.avi", false, MediaImage},
+		{"readme.txt", false, MediaImage},
+	}
+
+	for _, tt := range tests {
+		if got := IsMedia(tt.filename); got != tt.media {
+			t.Errorf("IsMedia(%q) = %v, want %v", tt.filename, got, tt.media)
+		}
+		if got := MediaType(tt.filename); got != tt.kind {
+			t.Errorf("MediaType(%q) = %q, want %q", tt.filename, got, tt.kind)
+		}
+	}
+}
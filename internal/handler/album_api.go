@@ -1,49 +1,211 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
+	"io"
 	"log"
+	"math/rand/v2"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Aquila-f/photo-slider/internal/domain"
 	"github.com/Aquila-f/photo-slider/internal/photo"
+	"github.com/Aquila-f/photo-slider/internal/query"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
 type albumService interface {
-	ListAlbums(ctx context.Context) []domain.AlbumItem
-	ListPhoto(ctx context.Context, albumKey string) ([]string, error)
+	FindAlbums(ctx context.Context, f domain.AlbumFilter) ([]domain.AlbumItem, error)
+	AlbumTree(ctx context.Context) []domain.AlbumNode
+	ListPhotoPage(ctx context.Context, albumKey string, opts domain.ListOptions, offset, limit int) (domain.PhotoPage, error)
 	ReadPhoto(ctx context.Context, albumKey, photoToken string) ([]byte, error)
+	OpenPhoto(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error)
+	OpenVideo(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error)
+	OpenMotion(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error)
+	MetadataPolicy(ctx context.Context, albumKey, photoToken string) (domain.MetadataPolicy, error)
+	ArchivePhotos(ctx context.Context, albumKey string, opts domain.ListOptions, tokens []string, originals bool) (domain.Archive, error)
 }
 
 type AlbumAPI struct {
-	svc          albumService
-	compressor   photo.Compressor
-	cacher       photo.Cacher
-	extractor    domain.MetaExtractor
-	listStrategy domain.PhotoListStrategy
+	svc        albumService
+	compressor photo.Compressor
+	cacher     photo.Cacher
+	extractor  domain.MetaExtractor
+	renditions *photo.RenditionPolicy
+}
+
+func NewAlbumAPI(svc albumService, compressor photo.Compressor, cacher photo.Cacher, extractor domain.MetaExtractor) *AlbumAPI {
+	return &AlbumAPI{
+		svc:        svc,
+		compressor: compressor,
+		cacher:     cacher,
+		extractor:  extractor,
+		renditions: photo.NewRenditionPolicy(photo.DefaultSizes, photo.DefaultDimensions),
+	}
 }
 
-func NewAlbumAPI(svc albumService, compressor photo.Compressor, cacher photo.Cacher, extractor domain.MetaExtractor, listStrategy domain.PhotoListStrategy) *AlbumAPI {
-	return &AlbumAPI{svc: svc, compressor: compressor, cacher: cacher, extractor: extractor, listStrategy: listStrategy}
+// SetRenditions sets the policy deciding which sizes the photo route serves.
+func (h *AlbumAPI) SetRenditions(p *photo.RenditionPolicy) {
+	h.renditions = p
 }
 
 func (h *AlbumAPI) listAlbums(c *gin.Context) {
-	albums := h.svc.ListAlbums(c.Request.Context())
+	if c.Query("view") == "tree" {
+		c.JSON(http.StatusOK, h.svc.AlbumTree(c.Request.Context()))
+		return
+	}
+	f, err := albumFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	albums, err := h.svc.FindAlbums(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, albums)
 }
 
+// albumFilter reads the album filter and sort query parameters.
+func albumFilter(c *gin.Context) (domain.AlbumFilter, error) {
+	f := domain.AlbumFilter{
+		Name: c.Query("name"),
+		Sort: c.Query("sort"),
+		Desc: c.Query("desc") == "true",
+	}
+	if v := c.Query("taken"); v != "" {
+		from, to, err := query.ParseRange(v)
+		if err != nil {
+			return f, err
+		}
+		f.TakenFrom, f.TakenTo = from, to
+	}
+	var err error
+	if f.MinCount, err = queryInt(c, "min_count", 0); err != nil {
+		return f, errors.New("invalid min_count")
+	}
+	if v := c.Query("min_bytes"); v != "" {
+		if f.MinBytes, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("invalid min_bytes")
+		}
+	}
+	return f, nil
+}
+
 func (h *AlbumAPI) listPhotos(c *gin.Context) {
 	albumKey := c.Param("albumkey")
-	photos, err := h.svc.ListPhoto(c.Request.Context(), albumKey)
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := queryInt(c, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	offset := 0
+	opts.Snapshot = strconv.FormatUint(rand.Uint64(), 36)
+	if v := c.Query("cursor"); v != "" {
+		if offset, opts.Seed, opts.Snapshot, err = decodeCursor(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+	page, err := h.svc.ListPhotoPage(c.Request.Context(), albumKey, opts, offset, limit)
+	if errors.Is(err, domain.ErrInvalidOrder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	if c.Query("shuffle") == "true" {
-		photos, _ = h.listStrategy.Arrange(c.Request.Context(), photos)
+	page.Seed = strconv.FormatUint(opts.Seed, 10)
+	if next := offset + len(page.Photos); next < page.Total {
+		page.NextCursor = encodeCursor(next, opts.Seed, opts.Snapshot)
+	}
+	c.Header("X-Shuffle-Seed", page.Seed)
+	c.JSON(http.StatusOK, page)
+}
+
+// encodeCursor makes the cursor of the page starting at offset. It carries
+// the seed so that random orders stay the same from page to page, and the
+// snapshot the service keeps the listing under, so that orders following the
+// show history do too.
+func encodeCursor(offset int, seed uint64, snapshot string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + strconv.FormatUint(seed, 10) + ":" + snapshot))
+}
+
+// decodeCursor reads a cursor of encodeCursor. Cursors handed out before
+// snapshots existed have none.
+func decodeCursor(cursor string) (offset int, seed uint64, snapshot string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, "", errors.New("malformed cursor")
+	}
+	offset, err = strconv.Atoi(parts[0])
+	if err != nil || offset < 0 {
+		return 0, 0, "", errors.New("malformed cursor")
+	}
+	if seed, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return 0, 0, "", err
+	}
+	if len(parts) == 3 {
+		snapshot = parts[2]
 	}
-	c.JSON(http.StatusOK, photos)
+	return offset, seed, snapshot, nil
+}
+
+// listOptions reads the filter and order query parameters shared by photo
+// listings.
+func listOptions(c *gin.Context) (domain.ListOptions, error) {
+	opts := domain.ListOptions{
+		FavoritesOnly:      c.Query("favorites") == "true",
+		CollapseDuplicates: c.Query("collapse") == "true",
+		Order:              c.Query("order"),
+		Viewer:             c.Query("viewer"),
+	}
+	// shuffle=true predates ?order= and is kept as a shorthand.
+	if opts.Order == "" && c.Query("shuffle") == "true" {
+		opts.Order = "random"
+	}
+	if v := c.Query("min_rating"); v != "" {
+		rating, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("invalid min_rating")
+		}
+		opts.MinRating = rating
+	}
+	// Random orders follow the seed; clients resume a shuffle by sending back
+	// the seed handed out with an earlier listing.
+	opts.Seed = rand.Uint64()
+	if v := c.Query("seed"); v != "" {
+		seed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return opts, errors.New("invalid seed")
+		}
+		opts.Seed = seed
+	}
+	return opts, nil
 }
 
 func (h *AlbumAPI) readPhoto(c *gin.Context) {
@@ -51,15 +213,40 @@ func (h *AlbumAPI) readPhoto(c *gin.Context) {
 	token := c.Param("key")
 	ctx := c.Request.Context()
 
-	cacheKey := albumKey + "/" + token
-	if cached, err := h.cacher.Get(ctx, cacheKey); err == nil {
+	rendition, err := h.rendition(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rendition.IsOriginal() {
+		h.readOriginal(c)
+		return
+	}
+	// The format may depend on Accept, so caches must keep one copy per
+	// value. Only photos that may become WebP get a second copy here.
+	webp := acceptsWebP(c.GetHeader("Accept"))
+	c.Header("Vary", "Accept")
+
+	prefix := albumKey + "/" + token + "?"
+	cacheKey := prefix + rendition.Key()
+	cached, err := h.cacher.Get(ctx, cacheKey)
+	if webp && (err != nil || cached.WebPCandidate) {
+		alt := rendition
+		alt.WebP = true
+		cacheKey = prefix + alt.Key()
+		cached, err = h.cacher.Get(ctx, cacheKey)
+	}
+	if err == nil {
 		log.Printf("cache hit: %s", cacheKey)
 		setMetaHeaders(c, cached.Meta)
-		c.Data(http.StatusOK, http.DetectContentType(cached.Data), cached.Data)
+		c.Data(http.StatusOK, contentType(cached.Data), cached.Data)
 		return
 	}
 
 	raw, err := h.svc.ReadPhoto(ctx, albumKey, token)
+	if errors.Is(err, domain.ErrNoPoster) {
+		raw, err = photo.VideoPoster(rendition)
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
 		return
@@ -68,15 +255,313 @@ func (h *AlbumAPI) readPhoto(c *gin.Context) {
 	// meta is best-effort; failure just means no EXIF headers in the response.
 	meta, _ := h.extractor.Extract(ctx, raw)
 
-	data, err := h.compressor.Compress(ctx, raw)
+	candidate := photo.WebPCandidate(raw)
+	rendition.WebP = webp && candidate
+	cacheKey = prefix + rendition.Key()
+	data, err := h.compressor.Compress(ctx, raw, rendition)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	_ = h.cacher.Set(ctx, cacheKey, photo.CachedPhoto{Data: data, Meta: meta})
+	passthrough := bytes.Equal(data, raw)
+	// Photos sent as they are still carry every bit of their metadata.
+	policy, err := h.svc.MetadataPolicy(ctx, albumKey, token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return
+	}
+	data, ok := photo.StripMetadata(data, policy)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrMetadataKept.Error()})
+		return
+	}
+	meta = policy.Filter(meta)
+	// Files sent as they are, such as HEICs that cannot be decoded, would
+	// fill the cache with a full copy under every rendition key; reading
+	// them again costs no more than the cache saves.
+	if !passthrough {
+		_ = h.cacher.Set(ctx, cacheKey, photo.CachedPhoto{Data: data, Meta: meta, WebPCandidate: candidate})
+	}
 
 	setMetaHeaders(c, meta)
-	c.Data(http.StatusOK, http.DetectContentType(data), data)
+	c.Data(http.StatusOK, contentType(data), data)
+}
+
+// readOriginal streams the file of a photo as it is stored. Range requests,
+// conditional requests and the Content-Type from the file extension are
+// handled by http.ServeContent. ?download=true asks browsers to save the file
+// rather than show it. The source's metadata policy applies to the file.
+func (h *AlbumAPI) readOriginal(c *gin.Context) {
+	h.serveFile(c, h.svc.OpenPhoto)
+}
+
+// readVideo streams a video for playback like readOriginal, under the
+// source's video setting rather than its originals one.
+func (h *AlbumAPI) readVideo(c *gin.Context) {
+	h.serveFile(c, h.svc.OpenVideo)
+}
+
+// serveFile streams the file open returns for the photo in the path.
+func (h *AlbumAPI) serveFile(c *gin.Context, open func(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error)) {
+	albumKey, token := c.Param("albumkey"), c.Param("key")
+	ctx := c.Request.Context()
+
+	f, info, err := open(ctx, albumKey, token)
+	if errors.Is(err, domain.ErrOriginalDenied) || errors.Is(err, domain.ErrVideoDenied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return
+	}
+	defer f.Close()
+	policy, err := h.svc.MetadataPolicy(ctx, albumKey, token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return
+	}
+	r, ok := photo.StripOriginal(f, info.Name, policy)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrMetadataKept.Error()})
+		return
+	}
+
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": info.Name}))
+	http.ServeContent(c.Writer, c.Request, info.Name, info.ModTime, r)
+}
+
+// readMotion streams the motion clip of a Live Photo, or the MP4 a motion
+// photo carries after its JPEG, with Range support and the metadata policy
+// like readOriginal.
+func (h *AlbumAPI) readMotion(c *gin.Context) {
+	albumKey, token := c.Param("albumkey"), c.Param("key")
+	ctx := c.Request.Context()
+
+	policy, err := h.svc.MetadataPolicy(ctx, albumKey, token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return
+	}
+	f, info, err := h.svc.OpenMotion(ctx, albumKey, token)
+	switch {
+	case errors.Is(err, domain.ErrNoMotion):
+		raw, err := h.svc.ReadPhoto(ctx, albumKey, token)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+			return
+		}
+		clip, ok := photo.MotionClip(raw)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": domain.ErrNoMotion.Error()})
+			return
+		}
+		var r io.ReadSeeker = bytes.NewReader(clip)
+		if policy.Strip {
+			if r, ok = photo.StripVideoMetadata(r, policy); !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrMetadataKept.Error()})
+				return
+			}
+		}
+		c.Header("Content-Type", "video/mp4")
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, r)
+		return
+	case errors.Is(err, domain.ErrOriginalDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return
+	}
+	defer f.Close()
+	r, ok := photo.StripOriginal(f, info.Name, policy)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrMetadataKept.Error()})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name, info.ModTime, r)
+}
+
+// downloadRequest picks the photos of a partial album download by token.
+type downloadRequest struct {
+	Photos []string `json:"photos" binding:"required,min=1"`
+}
+
+// download streams a ZIP of an album. GET packs every listed photo, narrowed
+// by the listing's filter parameters; POST packs the photos it names. Entries
+// are originals unless ?size=, ?w= or ?h= asks for renditions. Nothing is
+// buffered beyond one photo, and packing stops when the client goes away.
+func (h *AlbumAPI) download(c *gin.Context) {
+	albumKey := c.Param("albumkey")
+	ctx := c.Request.Context()
+
+	var tokens []string
+	if c.Request.Method == http.MethodPost {
+		var req downloadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tokens = req.Photos
+	}
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var rendition photo.Rendition
+	if c.Query("size") != "" || c.Query("w") != "" || c.Query("h") != "" {
+		if rendition, err = h.rendition(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	archive, err := h.svc.ArchivePhotos(ctx, albumKey, opts, tokens, rendition.IsOriginal())
+	switch {
+	case errors.Is(err, domain.ErrInvalidOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, domain.ErrOriginalDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Album names of nested folders contain slashes, which file names cannot.
+	filename := strings.ReplaceAll(archive.Name, "/", " - ") + ".zip"
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, e := range archive.Entries {
+		if ctx.Err() != nil {
+			log.Printf("download of %s cancelled: %v", archive.Name, ctx.Err())
+			return
+		}
+		if err := h.writeEntry(ctx, zw, albumKey, e, rendition); err != nil {
+			log.Printf("download of %s: %s: %v", archive.Name, e.Name, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("download of %s: %v", archive.Name, err)
+	}
+}
+
+// writeEntry adds one photo to a download. Photos that cannot be read, say
+// because they were deleted since the listing, are left out; the returned
+// error means the archive itself can no longer be written.
+func (h *AlbumAPI) writeEntry(ctx context.Context, zw *zip.Writer, albumKey string, e domain.ArchiveEntry, r photo.Rendition) error {
+	// Photos are compressed already, so entries are stored rather than deflated.
+	hdr := &zip.FileHeader{Name: e.Name, Method: zip.Store}
+	policy, err := h.svc.MetadataPolicy(ctx, albumKey, e.Token)
+	if err != nil {
+		log.Printf("download: skipping %s: %v", e.Name, err)
+		return nil
+	}
+	// Videos have no renditions, so they are always packed as stored.
+	if r.IsOriginal() || domain.IsVideo(e.Name) {
+		f, info, err := h.svc.OpenPhoto(ctx, albumKey, e.Token)
+		if err != nil {
+			log.Printf("download: skipping %s: %v", e.Name, err)
+			return nil
+		}
+		defer f.Close()
+		stripped, ok := photo.StripOriginal(f, e.Name, policy)
+		if !ok {
+			log.Printf("download: skipping %s: %v", e.Name, domain.ErrMetadataKept)
+			return nil
+		}
+		hdr.Modified = info.ModTime
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, stripped)
+		return err
+	}
+
+	raw, err := h.svc.ReadPhoto(ctx, albumKey, e.Token)
+	if err == nil {
+		raw, err = h.compressor.Compress(ctx, raw, r)
+	}
+	if err != nil {
+		log.Printf("download: skipping %s: %v", e.Name, err)
+		return nil
+	}
+	raw, ok := photo.StripMetadata(raw, policy)
+	if !ok {
+		log.Printf("download: skipping %s: %v", e.Name, domain.ErrMetadataKept)
+		return nil
+	}
+	hdr.Name = withFormatExt(e.Name, contentType(raw))
+	hdr.Modified = time.Now()
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// formatExts names the extension of each format renditions are encoded in.
+var formatExts = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/webp": ".webp", "image/gif": ".gif"}
+
+// contentType is http.DetectContentType, which does not know HEIF: HEIC
+// photos without a JPEG to resize are sent as they are.
+func contentType(data []byte) string {
+	if photo.IsHEIF(data) {
+		return "image/heic"
+	}
+	return http.DetectContentType(data)
+}
+
+// withFormatExt swaps the extension of name for one matching contentType, so
+// a PNG resized to a JPEG is not saved as .png.
+func withFormatExt(name, contentType string) string {
+	ext := path.Ext(name)
+	if want, ok := formatExts[contentType]; ok && mime.TypeByExtension(ext) != contentType {
+		return strings.TrimSuffix(name, ext) + want
+	}
+	return name
+}
+
+// rendition reads the size, or w, h and mode, query parameters.
+func (h *AlbumAPI) rendition(c *gin.Context) (photo.Rendition, error) {
+	w, err := queryInt(c, "w", 0)
+	if err != nil {
+		return photo.Rendition{}, errors.New("invalid w")
+	}
+	ht, err := queryInt(c, "h", 0)
+	if err != nil {
+		return photo.Rendition{}, errors.New("invalid h")
+	}
+	return h.renditions.Resolve(c.Query("size"), w, ht, c.Query("mode"))
+}
+
+// acceptsWebP reports whether an Accept header names image/webp with a
+// non-zero quality. Wildcards do not count, since some clients sending them
+// cannot decode WebP.
+func acceptsWebP(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil || mediaType != "image/webp" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			return false
+		}
+		return true
+	}
+	return false
 }
 
 func setMetaHeaders(c *gin.Context, meta *domain.PhotoMeta) {
@@ -0,0 +1,946 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/photo"
+	"github.com/gin-gonic/gin"
+)
+
+type mockAlbumService struct {
+	albums    []domain.AlbumItem
+	tree      []domain.AlbumNode
+	photos    map[string][]string
+	files     map[string][]byte // albumKey + "/" + token -> content
+	motions   map[string][]byte // albumKey + "/" + token -> paired clip
+	readToken string
+	filter    domain.AlbumFilter
+	listOpts  domain.ListOptions
+	offset    int
+	limit     int
+	listErr   error
+	denied    bool
+	// videosDenied makes OpenVideo fail like a source that does not
+	// stream videos.
+	videosDenied bool
+	archived     []string // tokens passed to ArchivePhotos
+	policy       domain.MetadataPolicy
+}
+
+func (m *mockAlbumService) FindAlbums(_ context.Context, f domain.AlbumFilter) ([]domain.AlbumItem, error) {
+	m.filter = f
+	if f.Sort == "sideways" {
+		return nil, domain.ErrInvalidSort
+	}
+	return m.albums, nil
+}
+
+func (m *mockAlbumService) AlbumTree(_ context.Context) []domain.AlbumNode {
+	return m.tree
+}
+
+func (m *mockAlbumService) ListPhotoPage(_ context.Context, albumKey string, opts domain.ListOptions, offset, limit int) (domain.PhotoPage, error) {
+	m.listOpts = opts
+	m.offset, m.limit = offset, limit
+	if m.listErr != nil {
+		return domain.PhotoPage{}, m.listErr
+	}
+	photos, ok := m.photos[albumKey]
+	if !ok {
+		return domain.PhotoPage{}, domain.ErrAlbumNotFound
+	}
+	page := domain.PhotoPage{Total: len(photos), Photos: []domain.PhotoItem{}}
+	for _, p := range photos[min(offset, len(photos)):min(offset+limit, len(photos))] {
+		page.Photos = append(page.Photos, domain.PhotoItem{Key: p, Name: p})
+	}
+	return page, nil
+}
+
+func (m *mockAlbumService) ReadPhoto(_ context.Context, albumKey, photoToken string) ([]byte, error) {
+	m.readToken = photoToken
+	data, ok := m.files[albumKey+"/"+photoToken]
+	if !ok && domain.IsVideo(photoToken) {
+		return nil, domain.ErrNoPoster
+	}
+	if !ok {
+		return nil, domain.ErrPhotoNotFound
+	}
+	return data, nil
+}
+
+func (m *mockAlbumService) OpenPhoto(_ context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	if m.denied {
+		return nil, domain.FileInfo{}, domain.ErrOriginalDenied
+	}
+	data, ok := m.files[albumKey+"/"+photoToken]
+	if !ok {
+		return nil, domain.FileInfo{}, domain.ErrPhotoNotFound
+	}
+	f := nopCloser{bytes.NewReader(data)}
+	return f, domain.FileInfo{Name: path.Base(photoToken), Path: photoToken, Size: int64(len(data))}, nil
+}
+
+func (m *mockAlbumService) OpenVideo(_ context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	data, ok := m.files[albumKey+"/"+photoToken]
+	if !ok || !domain.IsVideo(photoToken) {
+		return nil, domain.FileInfo{}, domain.ErrPhotoNotFound
+	}
+	if m.videosDenied {
+		return nil, domain.FileInfo{}, domain.ErrVideoDenied
+	}
+	return nopCloser{bytes.NewReader(data)}, domain.FileInfo{Name: path.Base(photoToken), Size: int64(len(data))}, nil
+}
+
+func (m *mockAlbumService) OpenMotion(_ context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	if m.denied {
+		return nil, domain.FileInfo{}, domain.ErrOriginalDenied
+	}
+	if clip, ok := m.motions[albumKey+"/"+photoToken]; ok {
+		return nopCloser{bytes.NewReader(clip)}, domain.FileInfo{Name: "clip.mov", Size: int64(len(clip))}, nil
+	}
+	if _, ok := m.files[albumKey+"/"+photoToken]; ok {
+		return nil, domain.FileInfo{}, domain.ErrNoMotion
+	}
+	return nil, domain.FileInfo{}, domain.ErrPhotoNotFound
+}
+
+func (m *mockAlbumService) MetadataPolicy(context.Context, string, string) (domain.MetadataPolicy, error) {
+	return m.policy, nil
+}
+
+func (m *mockAlbumService) ArchivePhotos(_ context.Context, albumKey string, _ domain.ListOptions, tokens []string, originals bool) (domain.Archive, error) {
+	m.archived = tokens
+	if originals && m.denied {
+		return domain.Archive{}, domain.ErrOriginalDenied
+	}
+	photos, ok := m.photos[albumKey]
+	if !ok {
+		return domain.Archive{}, domain.ErrAlbumNotFound
+	}
+	if len(tokens) > 0 {
+		photos = tokens
+	}
+	archive := domain.Archive{Name: "2024/Kenting"}
+	for _, p := range photos {
+		archive.Entries = append(archive.Entries, domain.ArchiveEntry{Token: p, Name: p})
+	}
+	return archive, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func setupAlbumRouter(svc *mockAlbumService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	api := NewAlbumAPI(svc, photo.NewImageCompressor(), photo.NewFixedSizeMapCacher(4), photo.NewEXIFExtractor())
+	return SetupRouter(embed.FS{}, api, NewSourceAPI(&mockSourceService{}), NewSmartAlbumAPI(nil), NewPlaylistAPI(nil), NewFlagAPI(nil), NewDuplicateAPI(nil), NewSearchAPI(nil), NewHistoryAPI(nil), NewStreamAPI(nil))
+}
+
+// --- ListAlbums ---
+
+func TestListAlbums_Flat(t *testing.T) {
+	svc := &mockAlbumService{albums: []domain.AlbumItem{{Name: "trip", Key: "k1"}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums", nil)
+	r.ServeHTTP(w, req)
+
+	var got []domain.AlbumItem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if len(got) != 1 || got[0].Key != "k1" {
+		t.Errorf("body = %s, want flat album list", w.Body.String())
+	}
+}
+
+func TestListAlbums_Tree(t *testing.T) {
+	svc := &mockAlbumService{tree: []domain.AlbumNode{{
+		Name:     "2024",
+		Key:      "k1",
+		Count:    3,
+		Children: []domain.AlbumNode{{Name: "2024/summer", Key: "k2", ParentKey: "k1", Count: 2}},
+	}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums?view=tree", nil)
+	r.ServeHTTP(w, req)
+
+	var got []domain.AlbumNode
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if len(got) != 1 || len(got[0].Children) != 1 || got[0].Children[0].ParentKey != "k1" {
+		t.Errorf("body = %s, want nested tree", w.Body.String())
+	}
+}
+
+func TestListAlbums_Filter(t *testing.T) {
+	svc := &mockAlbumService{}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums?name=trip&taken=2019..2020&min_count=3&min_bytes=1024&sort=date&desc=true", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	want := domain.AlbumFilter{
+		Name:      "trip",
+		TakenFrom: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		TakenTo:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		MinCount:  3,
+		MinBytes:  1024,
+		Sort:      "date",
+		Desc:      true,
+	}
+	if svc.filter != want {
+		t.Errorf("filter = %+v, want %+v", svc.filter, want)
+	}
+}
+
+func TestListAlbums_BadFilter(t *testing.T) {
+	for _, q := range []string{"sort=sideways", "taken=soon", "min_count=x", "min_bytes=x"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/albums?"+q, nil)
+		setupAlbumRouter(&mockAlbumService{}).ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// --- ListPhotos ---
+
+func TestListPhotos_FlagFilters(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1?favorites=true&min_rating=3", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	got := svc.listOpts
+	got.Seed = 0      // picked per request, see TestListPhotos_Seed
+	got.Snapshot = "" // picked per listing, see TestListPhotos_Pages
+	if want := (domain.ListOptions{FavoritesOnly: true, MinRating: 3}); got != want {
+		t.Errorf("opts = %+v, want %+v", got, want)
+	}
+}
+
+func TestListPhotos_CollapseDuplicates(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1?collapse=true", nil)
+	r.ServeHTTP(w, req)
+
+	if !svc.listOpts.CollapseDuplicates {
+		t.Errorf("opts = %+v, want CollapseDuplicates", svc.listOpts)
+	}
+}
+
+func TestListPhotos_Order(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?order=taken_desc", "taken_desc"},
+		{"?order=fresh&viewer=kitchen", "fresh"},
+		{"?shuffle=true", "random"},
+		{"?order=name&shuffle=true", "name"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+		r := setupAlbumRouter(svc)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/albums/k1"+tt.query, nil)
+		r.ServeHTTP(w, req)
+
+		if svc.listOpts.Order != tt.want {
+			t.Errorf("%q: order = %q, want %q", tt.query, svc.listOpts.Order, tt.want)
+		}
+	}
+}
+
+func TestListPhotos_InvalidOrder(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}, listErr: domain.ErrInvalidOrder}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1?order=sideways", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListPhotos_Seed(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1?shuffle=true&seed=42", nil)
+	r.ServeHTTP(w, req)
+
+	if svc.listOpts.Seed != 42 || w.Header().Get("X-Shuffle-Seed") != "42" {
+		t.Errorf("seed = %d, header = %q; want 42", svc.listOpts.Seed, w.Header().Get("X-Shuffle-Seed"))
+	}
+
+	// Without a seed the server picks one and hands it out.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/albums/k1?shuffle=true", nil)
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Shuffle-Seed"); got == "" || got != strconv.FormatUint(svc.listOpts.Seed, 10) {
+		t.Errorf("header = %q, want the seed used (%d)", got, svc.listOpts.Seed)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/albums/k1?seed=-1", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListPhotos_InvalidMinRating(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1?min_rating=lots", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListPhotos_Pages(t *testing.T) {
+	svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg", "b.jpg", "c.jpg"}}}
+	r := setupAlbumRouter(svc)
+
+	get := func(url string) domain.PhotoPage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", url, w.Code, http.StatusOK)
+		}
+		var page domain.PhotoPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		return page
+	}
+
+	first := get("/api/albums/k1?shuffle=true&limit=2")
+	if first.Total != 3 || len(first.Photos) != 2 || first.Photos[0].Key != "a.jpg" || first.NextCursor == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+	seed := svc.listOpts.Seed
+	if first.Seed != strconv.FormatUint(seed, 10) {
+		t.Errorf("Seed = %q, want %d", first.Seed, seed)
+	}
+
+	snapshot := svc.listOpts.Snapshot
+	if snapshot == "" {
+		t.Error("first page has no snapshot")
+	}
+
+	// The cursor carries the seed and snapshot, so the next page continues
+	// the same order.
+	last := get("/api/albums/k1?shuffle=true&limit=2&cursor=" + first.NextCursor)
+	if svc.offset != 2 || svc.listOpts.Seed != seed || svc.listOpts.Snapshot != snapshot {
+		t.Errorf("offset, seed, snapshot = %d, %d, %q; want 2, %d, %q", svc.offset, svc.listOpts.Seed, svc.listOpts.Snapshot, seed, snapshot)
+	}
+	if len(last.Photos) != 1 || last.Photos[0].Key != "c.jpg" || last.NextCursor != "" {
+		t.Errorf("last page = %+v", last)
+	}
+
+	if get("/api/albums/k1"); svc.limit != defaultPageLimit {
+		t.Errorf("limit = %d, want %d", svc.limit, defaultPageLimit)
+	}
+}
+
+func TestListPhotos_BadPages(t *testing.T) {
+	for _, q := range []string{"limit=0", "limit=5000", "cursor=nope", "cursor=" + encodeCursor(-1, 0, "")} {
+		svc := &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/albums/k1?"+q, nil)
+		setupAlbumRouter(svc).ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// --- ReadPhoto ---
+
+func TestReadPhoto_EscapedSlashInToken(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{"k1/summer/beach.jpg": []byte("img")}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/summer%2Fbeach.jpg", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if svc.readToken != "summer/beach.jpg" {
+		t.Errorf("token = %q, want %q", svc.readToken, "summer/beach.jpg")
+	}
+}
+
+func TestReadPhoto_Renditions(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	svc := &mockAlbumService{files: map[string][]byte{"k1/a.jpg": buf.Bytes()}}
+	r := setupAlbumRouter(svc)
+
+	tests := []struct {
+		query  string
+		status int
+		w, h   int
+	}{
+		{"", http.StatusOK, 800, 400},
+		{"?size=thumb", http.StatusOK, 256, 128},
+		{"?w=256&h=256&mode=fill", http.StatusOK, 256, 256},
+		{"?size=original", http.StatusOK, 800, 400},
+		{"?size=huge", http.StatusBadRequest, 0, 0},
+		{"?w=300", http.StatusBadRequest, 0, 0},
+		{"?w=x", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/photos/k1/a.jpg"+tt.query, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(w.Body)
+		if err != nil || cfg.Width != tt.w || cfg.Height != tt.h {
+			t.Errorf("%q: got %dx%d (%v), want %dx%d", tt.query, cfg.Width, cfg.Height, err, tt.w, tt.h)
+		}
+	}
+
+	// The thumbnail is cached apart from the default rendition.
+	svc.files = nil
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/a.jpg?size=thumb", nil)
+	r.ServeHTTP(w, req)
+	if cfg, _, _ := image.DecodeConfig(w.Body); cfg.Width != 256 {
+		t.Errorf("cached thumb width = %d, want 256", cfg.Width)
+	}
+}
+
+func TestReadOriginal(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{"k1/IMG 1.jpg": []byte("0123456789")}}
+	r := setupAlbumRouter(svc)
+
+	tests := []struct {
+		name        string
+		url         string
+		rangeHeader string
+		status      int
+		body        string
+		disposition string
+	}{
+		{"whole file", "/photos/k1/IMG%201.jpg/original", "", http.StatusOK, "0123456789", `inline; filename="IMG 1.jpg"`},
+		{"size=original", "/photos/k1/IMG%201.jpg?size=original", "", http.StatusOK, "0123456789", `inline; filename="IMG 1.jpg"`},
+		{"range", "/photos/k1/IMG%201.jpg/original", "bytes=2-5", http.StatusPartialContent, "2345", `inline; filename="IMG 1.jpg"`},
+		{"download", "/photos/k1/IMG%201.jpg/original?download=true", "", http.StatusOK, "0123456789", `attachment; filename="IMG 1.jpg"`},
+		{"unsatisfiable range", "/photos/k1/IMG%201.jpg/original", "bytes=20-", http.StatusRequestedRangeNotSatisfiable, "", ""},
+		{"missing", "/photos/k1/nope.jpg/original", "", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.body == "" {
+			continue
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(tt.body)) {
+			t.Errorf("%s: Content-Length = %q, want %d", tt.name, got, len(tt.body))
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/jpeg" {
+			t.Errorf("%s: Content-Type = %q, want image/jpeg", tt.name, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%s: Content-Disposition = %q, want %q", tt.name, got, tt.disposition)
+		}
+	}
+}
+
+func TestReadOriginal_Denied(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{"k1/a.jpg": []byte("img")}, denied: true}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/a.jpg/original", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestReadVideo(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{"k1/clip.webm": []byte("0123456789"), "k1/a.jpg": []byte("img")}, denied: true}
+	r := setupAlbumRouter(svc)
+
+	tests := []struct {
+		name        string
+		url         string
+		rangeHeader string
+		status      int
+		body        string
+	}{
+		{"private originals", "/photos/k1/clip.webm/video", "", http.StatusOK, "0123456789"},
+		{"range", "/photos/k1/clip.webm/video", "bytes=2-5", http.StatusPartialContent, "2345"},
+		{"photo", "/photos/k1/a.jpg/video", "", http.StatusNotFound, ""},
+		{"videos denied", "/photos/k1/clip.webm/video", "", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		svc.videosDenied = tt.name == "videos denied"
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+// cameraJPEG is a JPEG whose EXIF names the camera and its serial number.
+func cameraJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	// A big-endian TIFF with Model and BodySerialNumber, stored after the IFD.
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x02" +
+		"\x01\x10\x00\x02\x00\x00\x00\x08\x00\x00\x00\x26" +
+		"\xa4\x31\x00\x02\x00\x00\x00\x0c\x00\x00\x00\x2e" +
+		"\x00\x00\x00\x00Pixel 8\x00SERIAL-0042\x00")
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}, app1...)
+	return bytes.Join([][]byte{buf.Bytes()[:2], segment, buf.Bytes()[2:]}, nil)
+}
+
+func TestReadPhoto_MetadataPolicy(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{
+		"k1/a.jpg": cameraJPEG(t),
+		"k1/b.cr2": []byte("II*\x00raw"),
+	}}
+	r := setupAlbumRouter(svc)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("/photos/k1/a.jpg?size=thumb"); w.Header().Get("X-Photo-Model") != "Pixel 8" {
+		t.Fatalf("X-Photo-Model = %q without a policy, want Pixel 8", w.Header().Get("X-Photo-Model"))
+	}
+
+	svc.policy = domain.MetadataPolicy{Strip: true}
+	for _, url := range []string{"/photos/k1/a.jpg", "/photos/k1/a.jpg/original"} {
+		w := get(url)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", url, w.Code, http.StatusOK)
+			continue
+		}
+		if got := w.Header().Get("X-Photo-Model"); got != "" {
+			t.Errorf("%s: X-Photo-Model = %q, want none", url, got)
+		}
+		if bytes.Contains(w.Body.Bytes(), []byte("SERIAL-0042")) || bytes.Contains(w.Body.Bytes(), []byte("Pixel 8")) {
+			t.Errorf("%s: body still holds the EXIF", url)
+		}
+		if cfg, _, err := image.DecodeConfig(w.Body); err != nil || cfg.Width != 16 {
+			t.Errorf("%s: body does not decode: %v", url, err)
+		}
+	}
+
+	// A RAW file cannot be cleaned, so it is not served at all.
+	if w := get("/photos/k1/b.cr2/original"); w.Code != http.StatusForbidden {
+		t.Errorf("raw original: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestReadPhoto_VideoPlaceholder(t *testing.T) {
+	svc := &mockAlbumService{}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/clip.mp4?size=thumb", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	img, _, err := image.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 144 {
+		t.Errorf("placeholder = %dx%d, want 256x144", b.Dx(), b.Dy())
+	}
+}
+
+func TestReadPhoto_UndecodableHEIC(t *testing.T) {
+	// A HEIC file whose images are all HEVC is sent as it is.
+	heic := append([]byte("\x00\x00\x00\x14ftypheic\x00\x00\x00\x00mif1"), "\x00\x00\x00\x08mdat"...)
+	svc := &mockAlbumService{files: map[string][]byte{"k1/IMG_0001.HEIC": heic}}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/IMG_0001.HEIC", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/heic" {
+		t.Errorf("Content-Type = %q, want image/heic", ct)
+	}
+	if !bytes.Equal(w.Body.Bytes(), heic) {
+		t.Error("body is not the HEIC file")
+	}
+}
+
+func TestReadMotion(t *testing.T) {
+	var still bytes.Buffer
+	if err := jpeg.Encode(&still, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	mp4 := []byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00isommp42\x00\x00\x00\x0emdatframes")
+	svc := &mockAlbumService{
+		files: map[string][]byte{
+			"k1/IMG_1.HEIC": []byte("heic"),
+			"k1/PXL_2.jpg":  append(bytes.Clone(still.Bytes()), mp4...),
+			"k1/still.jpg":  still.Bytes(),
+		},
+		motions: map[string][]byte{"k1/IMG_1.HEIC": []byte("live-clip")},
+	}
+	r := setupAlbumRouter(svc)
+
+	tests := []struct {
+		name     string
+		url      string
+		rangeHdr string
+		status   int
+		body     string
+	}{
+		{"live photo", "/photos/k1/IMG_1.HEIC/motion", "", http.StatusOK, "live-clip"},
+		{"motion photo", "/photos/k1/PXL_2.jpg/motion", "", http.StatusOK, string(mp4)},
+		{"range", "/photos/k1/PXL_2.jpg/motion", "bytes=4-7", http.StatusPartialContent, "ftyp"},
+		{"still", "/photos/k1/still.jpg/motion", "", http.StatusNotFound, ""},
+		{"missing", "/photos/k1/nope.jpg/motion", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if tt.rangeHdr != "" {
+			req.Header.Set("Range", tt.rangeHdr)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+	}
+
+	svc.denied = true
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/photos/k1/IMG_1.HEIC/motion", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("denied: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// --- Download ---
+
+// unzip returns the entries of a ZIP body by name.
+func unzip(t *testing.T, body []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	entries := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		entries[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	return entries
+}
+
+func TestDownload_Originals(t *testing.T) {
+	svc := &mockAlbumService{
+		photos: map[string][]string{"k1": {"a.jpg", "sub/b.jpg", "gone.jpg"}},
+		files:  map[string][]byte{"k1/a.jpg": []byte("aaa"), "k1/sub/b.jpg": []byte("bbb")},
+	}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1/download", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="2024 - Kenting.zip"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	entries := unzip(t, w.Body.Bytes())
+	// gone.jpg cannot be read and is left out.
+	if len(entries) != 2 || string(entries["a.jpg"]) != "aaa" || string(entries["sub/b.jpg"]) != "bbb" {
+		t.Errorf("entries = %q, want a.jpg and sub/b.jpg", entries)
+	}
+}
+
+func TestDownload_Selection(t *testing.T) {
+	svc := &mockAlbumService{
+		photos: map[string][]string{"k1": {"a.jpg", "b.jpg"}},
+		files:  map[string][]byte{"k1/a.jpg": []byte("aaa"), "k1/b.jpg": []byte("bbb")},
+	}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/albums/k1/download", bytes.NewBufferString(`{"photos": ["b.jpg"]}`))
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(svc.archived) != 1 || svc.archived[0] != "b.jpg" {
+		t.Errorf("selection = %q, want [b.jpg]", svc.archived)
+	}
+	if entries := unzip(t, w.Body.Bytes()); len(entries) != 1 || string(entries["b.jpg"]) != "bbb" {
+		t.Errorf("entries = %q, want only b.jpg", entries)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/albums/k1/download", bytes.NewBufferString(`{"photos": []}`))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty selection: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDownload_Renditions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 800, 400))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	svc := &mockAlbumService{
+		photos: map[string][]string{"k1": {"a.png"}},
+		files:  map[string][]byte{"k1/a.png": buf.Bytes()},
+	}
+	r := setupAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1/download?size=thumb", nil)
+	r.ServeHTTP(w, req)
+
+	entries := unzip(t, w.Body.Bytes())
+	data, ok := entries["a.jpg"]
+	if !ok {
+		t.Fatalf("entries = %v, want a.jpg", entries)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 256 {
+		t.Errorf("a.jpg: width %d (%v), want a 256 px JPEG", cfg.Width, err)
+	}
+}
+
+func TestDownload_StopsWhenClientGoesAway(t *testing.T) {
+	svc := &mockAlbumService{
+		photos: map[string][]string{"k1": {"a.jpg"}},
+		files:  map[string][]byte{"k1/a.jpg": []byte("aaa")},
+	}
+	r := setupAlbumRouter(svc)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/albums/k1/download", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Body.Len() != 0 {
+		t.Errorf("wrote %d bytes after the client went away", w.Body.Len())
+	}
+}
+
+func TestDownload_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		svc    *mockAlbumService
+		url    string
+		status int
+	}{
+		{"missing album", &mockAlbumService{}, "/api/albums/nope/download", http.StatusNotFound},
+		{"denied originals", &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}, denied: true}, "/api/albums/k1/download", http.StatusForbidden},
+		{"bad size", &mockAlbumService{photos: map[string][]string{"k1": {"a.jpg"}}}, "/api/albums/k1/download?size=huge", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		setupAlbumRouter(tt.svc).ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestReadPhoto_CachesPerAccept(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	svc := &mockAlbumService{files: map[string][]byte{
+		"k1/a.jpg": cameraJPEG(t),
+		"k1/b.png": buf.Bytes(),
+	}}
+	r := setupAlbumRouter(svc)
+	get := func(token, accept string) (string, string) {
+		svc.readToken = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/photos/k1/"+token, nil)
+		req.Header.Set("Accept", accept)
+		r.ServeHTTP(w, req)
+		return svc.readToken, w.Header().Get("Content-Type")
+	}
+
+	// Both may become WebP, so each client gets its own copy.
+	for _, token := range []string{"a.jpg", "b.png"} {
+		get(token, "image/jpeg")
+		if read, typ := get(token, "image/webp"); read != token || typ != "image/webp" {
+			t.Errorf("%s: served %s from the copy made without WebP", token, typ)
+		}
+		if read, _ := get(token, "image/webp"); read != "" {
+			t.Errorf("%s: read again for a client with WebP", token)
+		}
+		if read, typ := get(token, "image/jpeg"); read != "" || typ == "image/webp" {
+			t.Errorf("%s: read again or sent %s for a client without WebP", token, typ)
+		}
+	}
+}
+
+func TestReadPhoto_PassthroughNotCached(t *testing.T) {
+	svc := &mockAlbumService{files: map[string][]byte{"k1/a.heic": []byte("undecodable")}}
+	r := setupAlbumRouter(svc)
+
+	for i := range 2 {
+		svc.readToken = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/photos/k1/a.heic", nil)
+		r.ServeHTTP(w, req)
+		if w.Body.String() != "undecodable" {
+			t.Fatalf("request %d: body = %q, want the file as it is", i, w.Body.String())
+		}
+		if svc.readToken != "a.heic" {
+			t.Errorf("request %d: served from the cache", i)
+		}
+	}
+}
+
+func TestReadPhoto_NegotiatesWebP(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	svc := &mockAlbumService{files: map[string][]byte{"k1/a.png": buf.Bytes()}}
+	r := setupAlbumRouter(svc)
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"image/avif,image/webp,*/*", "image/webp"},
+		{"image/webp;q=0, image/*", "image/jpeg"},
+		{"*/*", "image/jpeg"},
+		{"", "image/jpeg"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/photos/k1/a.png", nil)
+		req.Header.Set("Accept", tt.accept)
+		r.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", tt.accept, got, tt.want)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("Accept %q: Vary = %q, want Accept", tt.accept, got)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type duplicateService interface {
+	Duplicates(ctx context.Context) []domain.DuplicateGroup
+}
+
+type DuplicateAPI struct {
+	svc duplicateService
+}
+
+func NewDuplicateAPI(svc duplicateService) *DuplicateAPI {
+	return &DuplicateAPI{svc: svc}
+}
+
+func (h *DuplicateAPI) listDuplicates(c *gin.Context) {
+	groups := h.svc.Duplicates(c.Request.Context())
+	if groups == nil {
+		groups = []domain.DuplicateGroup{}
+	}
+	c.JSON(http.StatusOK, groups)
+}
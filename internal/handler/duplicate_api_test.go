@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockDuplicateService struct {
+	groups []domain.DuplicateGroup
+}
+
+func (m *mockDuplicateService) Duplicates(_ context.Context) []domain.DuplicateGroup {
+	return m.groups
+}
+
+func serveDuplicates(svc *mockDuplicateService) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/duplicates", NewDuplicateAPI(svc).listDuplicates)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/duplicates", nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestListDuplicates(t *testing.T) {
+	svc := &mockDuplicateService{groups: []domain.DuplicateGroup{{
+		Exact:  true,
+		Photos: []domain.PhotoRecord{{SourceID: "s", Path: "a.jpg"}, {SourceID: "s", Path: "b/a.jpg"}},
+	}}}
+	w := serveDuplicates(svc)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var got []domain.DuplicateGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(got) != 1 || !got[0].Exact || len(got[0].Photos) != 2 {
+		t.Errorf("groups = %+v", got)
+	}
+}
+
+func TestListDuplicates_EmptyIsArray(t *testing.T) {
+	w := serveDuplicates(&mockDuplicateService{})
+
+	if w.Body.String() != "[]" {
+		t.Errorf("body = %s, want []", w.Body.String())
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type flagRequest struct {
+	Favorite *bool `json:"favorite"`
+	Rating   *int  `json:"rating"`
+	Hidden   *bool `json:"hidden"`
+}
+
+type flagService interface {
+	GetFlags(ctx context.Context, albumKey, photoToken string) (domain.PhotoFlags, error)
+	SetFlags(ctx context.Context, albumKey, photoToken string, update domain.FlagUpdate) (domain.PhotoFlags, error)
+}
+
+type FlagAPI struct {
+	svc flagService
+}
+
+func NewFlagAPI(svc flagService) *FlagAPI {
+	return &FlagAPI{svc: svc}
+}
+
+func (h *FlagAPI) getFlags(c *gin.Context) {
+	flags, err := h.svc.GetFlags(c.Request.Context(), c.Param("albumkey"), c.Param("key"))
+	if err != nil {
+		writeFlagError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+func (h *FlagAPI) setFlags(c *gin.Context) {
+	var req flagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	update := domain.FlagUpdate{Favorite: req.Favorite, Rating: req.Rating, Hidden: req.Hidden}
+	flags, err := h.svc.SetFlags(c.Request.Context(), c.Param("albumkey"), c.Param("key"), update)
+	if err != nil {
+		writeFlagError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+func writeFlagError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidRating):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrAlbumNotFound), errors.Is(err, domain.ErrPhotoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
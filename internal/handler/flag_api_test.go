@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockFlagService struct {
+	flags  domain.PhotoFlags
+	setErr error
+	update domain.FlagUpdate
+	token  string
+}
+
+func (m *mockFlagService) GetFlags(_ context.Context, _, photoToken string) (domain.PhotoFlags, error) {
+	m.token = photoToken
+	return m.flags, nil
+}
+
+func (m *mockFlagService) SetFlags(_ context.Context, _, photoToken string, update domain.FlagUpdate) (domain.PhotoFlags, error) {
+	m.token = photoToken
+	m.update = update
+	return m.flags, m.setErr
+}
+
+func setupFlagRouter(svc *mockFlagService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.UseRawPath = true
+	api := NewFlagAPI(svc)
+	r.GET("/api/albums/:albumkey/photos/:key/flags", api.getFlags)
+	r.PUT("/api/albums/:albumkey/photos/:key/flags", api.setFlags)
+	return r
+}
+
+func TestSetFlags_PartialUpdate(t *testing.T) {
+	svc := &mockFlagService{}
+	r := setupFlagRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/albums/k1/photos/sub%2Fa.jpg/flags", strings.NewReader(`{"rating":4}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if svc.token != "sub/a.jpg" {
+		t.Errorf("token = %q, want %q", svc.token, "sub/a.jpg")
+	}
+	if svc.update.Rating == nil || *svc.update.Rating != 4 || svc.update.Favorite != nil || svc.update.Hidden != nil {
+		t.Errorf("update = %+v, want only rating set", svc.update)
+	}
+}
+
+func TestSetFlags_InvalidRating(t *testing.T) {
+	r := setupFlagRouter(&mockFlagService{setErr: domain.ErrInvalidRating})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/albums/k1/photos/a.jpg/flags", strings.NewReader(`{"rating":9}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSetFlags_PhotoNotFound(t *testing.T) {
+	r := setupFlagRouter(&mockFlagService{setErr: domain.ErrPhotoNotFound})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/albums/k1/photos/a.jpg/flags", strings.NewReader(`{"hidden":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetFlags_ReturnsFlags(t *testing.T) {
+	r := setupFlagRouter(&mockFlagService{flags: domain.PhotoFlags{Favorite: true, Rating: 3}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/albums/k1/photos/a.jpg/flags", nil)
+	r.ServeHTTP(w, req)
+
+	if body := w.Body.String(); !strings.Contains(body, `"Favorite":true`) || !strings.Contains(body, `"Rating":3`) {
+		t.Errorf("body = %s, want flags", body)
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type historyService interface {
+	RecordShown(ctx context.Context, viewer, albumKey, photoToken string) error
+}
+
+// HistoryAPI takes "shown" events from clients. The photo route does not
+// record them itself because clients preload photos they may never show.
+type HistoryAPI struct {
+	svc historyService
+}
+
+func NewHistoryAPI(svc historyService) *HistoryAPI {
+	return &HistoryAPI{svc: svc}
+}
+
+func (h *HistoryAPI) recordShown(c *gin.Context) {
+	err := h.svc.RecordShown(c.Request.Context(), c.Query("viewer"), c.Param("albumkey"), c.Param("key"))
+	if errors.Is(err, domain.ErrAlbumNotFound) || errors.Is(err, domain.ErrPhotoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
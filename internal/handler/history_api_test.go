@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockHistoryService struct {
+	viewer, albumKey, token string
+	err                     error
+}
+
+func (m *mockHistoryService) RecordShown(_ context.Context, viewer, albumKey, photoToken string) error {
+	m.viewer, m.albumKey, m.token = viewer, albumKey, photoToken
+	return m.err
+}
+
+func serveShown(svc *mockHistoryService, url string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.UseRawPath = true
+	r.POST("/api/albums/:albumkey/photos/:key/shown", NewHistoryAPI(svc).recordShown)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", url, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecordShown(t *testing.T) {
+	svc := &mockHistoryService{}
+	w := serveShown(svc, "/api/albums/k1/photos/sub%2Fa.jpg/shown?viewer=kitchen")
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if svc.viewer != "kitchen" || svc.albumKey != "k1" || svc.token != "sub/a.jpg" {
+		t.Errorf("RecordShown(%q, %q, %q)", svc.viewer, svc.albumKey, svc.token)
+	}
+}
+
+func TestRecordShown_NotFound(t *testing.T) {
+	w := serveShown(&mockHistoryService{err: domain.ErrPhotoNotFound}, "/api/albums/k1/photos/a.jpg/shown")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
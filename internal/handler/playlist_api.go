@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type playlistPhoto struct {
+	Album string `json:"album" binding:"required"`
+	Key   string `json:"key" binding:"required"`
+}
+
+type playlistRequest struct {
+	Name   string          `json:"name" binding:"required"`
+	Photos []playlistPhoto `json:"photos" binding:"dive"`
+}
+
+func (r playlistRequest) albumPhotos() []domain.AlbumPhoto {
+	photos := make([]domain.AlbumPhoto, 0, len(r.Photos))
+	for _, p := range r.Photos {
+		photos = append(photos, domain.AlbumPhoto{AlbumKey: p.Album, Token: p.Key})
+	}
+	return photos
+}
+
+type playlistService interface {
+	ListPlaylists(ctx context.Context) []domain.Playlist
+	GetPlaylist(ctx context.Context, id string) (domain.Playlist, error)
+	CreatePlaylist(ctx context.Context, name string, photos []domain.AlbumPhoto) (domain.Playlist, error)
+	UpdatePlaylist(ctx context.Context, id, name string, photos []domain.AlbumPhoto) (domain.Playlist, error)
+	DeletePlaylist(ctx context.Context, id string) error
+}
+
+type PlaylistAPI struct {
+	svc playlistService
+}
+
+func NewPlaylistAPI(svc playlistService) *PlaylistAPI {
+	return &PlaylistAPI{svc: svc}
+}
+
+func (h *PlaylistAPI) listPlaylists(c *gin.Context) {
+	c.JSON(http.StatusOK, h.svc.ListPlaylists(c.Request.Context()))
+}
+
+func (h *PlaylistAPI) getPlaylist(c *gin.Context) {
+	pl, err := h.svc.GetPlaylist(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pl)
+}
+
+func (h *PlaylistAPI) createPlaylist(c *gin.Context) {
+	var req playlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pl, err := h.svc.CreatePlaylist(c.Request.Context(), req.Name, req.albumPhotos())
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, pl)
+}
+
+func (h *PlaylistAPI) updatePlaylist(c *gin.Context) {
+	var req playlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pl, err := h.svc.UpdatePlaylist(c.Request.Context(), c.Param("id"), req.Name, req.albumPhotos())
+	if err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pl)
+}
+
+func (h *PlaylistAPI) deletePlaylist(c *gin.Context) {
+	if err := h.svc.DeletePlaylist(c.Request.Context(), c.Param("id")); err != nil {
+		writePlaylistError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func writePlaylistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrPlaylistNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrAlbumNotFound), errors.Is(err, domain.ErrPhotoNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockPlaylistService struct {
+	playlists map[string]domain.Playlist
+	createErr error
+	photos    []domain.AlbumPhoto
+}
+
+func (m *mockPlaylistService) ListPlaylists(_ context.Context) []domain.Playlist {
+	out := make([]domain.Playlist, 0, len(m.playlists))
+	for _, pl := range m.playlists {
+		out = append(out, pl)
+	}
+	return out
+}
+
+func (m *mockPlaylistService) GetPlaylist(_ context.Context, id string) (domain.Playlist, error) {
+	pl, ok := m.playlists[id]
+	if !ok {
+		return domain.Playlist{}, domain.ErrPlaylistNotFound
+	}
+	return pl, nil
+}
+
+func (m *mockPlaylistService) CreatePlaylist(_ context.Context, name string, photos []domain.AlbumPhoto) (domain.Playlist, error) {
+	m.photos = photos
+	return domain.Playlist{ID: "p1", Name: name}, m.createErr
+}
+
+func (m *mockPlaylistService) UpdatePlaylist(_ context.Context, id, name string, photos []domain.AlbumPhoto) (domain.Playlist, error) {
+	if _, ok := m.playlists[id]; !ok {
+		return domain.Playlist{}, domain.ErrPlaylistNotFound
+	}
+	m.photos = photos
+	return domain.Playlist{ID: id, Name: name}, nil
+}
+
+func (m *mockPlaylistService) DeletePlaylist(_ context.Context, id string) error {
+	if _, ok := m.playlists[id]; !ok {
+		return domain.ErrPlaylistNotFound
+	}
+	return nil
+}
+
+func setupPlaylistRouter(svc *mockPlaylistService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := NewPlaylistAPI(svc)
+	r.GET("/api/playlists", api.listPlaylists)
+	r.POST("/api/playlists", api.createPlaylist)
+	r.GET("/api/playlists/:id", api.getPlaylist)
+	r.PUT("/api/playlists/:id", api.updatePlaylist)
+	r.DELETE("/api/playlists/:id", api.deletePlaylist)
+	return r
+}
+
+func TestCreatePlaylist_Success(t *testing.T) {
+	svc := &mockPlaylistService{}
+	r := setupPlaylistRouter(svc)
+
+	w := httptest.NewRecorder()
+	body := `{"name":"Best of 2024","photos":[{"album":"k1","key":"a.jpg"},{"album":"k2","key":"b.jpg"}]}`
+	req, _ := http.NewRequest("POST", "/api/playlists", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if len(svc.photos) != 2 || svc.photos[1] != (domain.AlbumPhoto{AlbumKey: "k2", Token: "b.jpg"}) {
+		t.Errorf("photos = %+v", svc.photos)
+	}
+}
+
+func TestCreatePlaylist_MissingPhotoKey(t *testing.T) {
+	r := setupPlaylistRouter(&mockPlaylistService{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/playlists", strings.NewReader(`{"name":"x","photos":[{"album":"k1"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCreatePlaylist_UnknownPhoto(t *testing.T) {
+	r := setupPlaylistRouter(&mockPlaylistService{createErr: domain.ErrPhotoNotFound})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/playlists", strings.NewReader(`{"name":"x","photos":[{"album":"k1","key":"nope.jpg"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetPlaylist_NotFound(t *testing.T) {
+	r := setupPlaylistRouter(&mockPlaylistService{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/playlists/missing", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestUpdatePlaylist_Success(t *testing.T) {
+	svc := &mockPlaylistService{playlists: map[string]domain.Playlist{"p1": {ID: "p1"}}}
+	r := setupPlaylistRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/playlists/p1", strings.NewReader(`{"name":"Renamed","photos":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestDeletePlaylist_Success(t *testing.T) {
+	svc := &mockPlaylistService{playlists: map[string]domain.Playlist{"p1": {ID: "p1"}}}
+	r := setupPlaylistRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/playlists/p1", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(staticFS embed.FS, api *AlbumAPI, sourceAPI *SourceAPI) *gin.Engine {
+func SetupRouter(staticFS embed.FS, api *AlbumAPI, sourceAPI *SourceAPI, smartAPI *SmartAlbumAPI, playlistAPI *PlaylistAPI, flagAPI *FlagAPI, duplicateAPI *DuplicateAPI, searchAPI *SearchAPI, historyAPI *HistoryAPI, streamAPI *StreamAPI) *gin.Engine {
 	r := gin.Default()
+	// Photo tokens of recursive albums contain subfolders; match on the raw
+	// path so an escaped "/" stays inside the :key parameter.
+	r.UseRawPath = true
 
 	// Serve index.html at root
 	indexHTML, _ := staticFS.ReadFile("static/index.html")
@@ -24,9 +27,28 @@ func SetupRouter(staticFS embed.FS, api *AlbumAPI, sourceAPI *SourceAPI) *gin.En
 	r.GET("/api/sources", sourceAPI.listSources)
 	r.POST("/api/sources", sourceAPI.createSource)
 	r.DELETE("/api/sources", sourceAPI.deleteSource)
+	r.GET("/api/smart-albums", smartAPI.listSmartAlbums)
+	r.POST("/api/smart-albums", smartAPI.createSmartAlbum)
+	r.DELETE("/api/smart-albums", smartAPI.deleteSmartAlbum)
+	r.GET("/api/playlists", playlistAPI.listPlaylists)
+	r.POST("/api/playlists", playlistAPI.createPlaylist)
+	r.GET("/api/playlists/:id", playlistAPI.getPlaylist)
+	r.PUT("/api/playlists/:id", playlistAPI.updatePlaylist)
+	r.DELETE("/api/playlists/:id", playlistAPI.deletePlaylist)
+	r.GET("/api/duplicates", duplicateAPI.listDuplicates)
+	r.GET("/api/search", searchAPI.search)
+	r.GET("/api/stream", streamAPI.stream)
 	r.GET("/api/albums", api.listAlbums)
 	r.GET("/api/albums/:albumkey", api.listPhotos)
+	r.GET("/api/albums/:albumkey/download", api.download)
+	r.POST("/api/albums/:albumkey/download", api.download)
+	r.GET("/api/albums/:albumkey/photos/:key/flags", flagAPI.getFlags)
+	r.PUT("/api/albums/:albumkey/photos/:key/flags", flagAPI.setFlags)
+	r.POST("/api/albums/:albumkey/photos/:key/shown", historyAPI.recordShown)
 	r.GET("/photos/:albumkey/:key", api.readPhoto)
+	r.GET("/photos/:albumkey/:key/original", api.readOriginal)
+	r.GET("/photos/:albumkey/:key/video", api.readVideo)
+	r.GET("/photos/:albumkey/:key/motion", api.readMotion)
 
 	return r
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+type searchService interface {
+	Search(ctx context.Context, q string, offset, limit int) (domain.SearchResult, error)
+}
+
+type SearchAPI struct {
+	svc searchService
+}
+
+func NewSearchAPI(svc searchService) *SearchAPI {
+	return &SearchAPI{svc: svc}
+}
+
+func (h *SearchAPI) search(c *gin.Context) {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := queryInt(c, "limit", defaultSearchLimit)
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	result, err := h.svc.Search(c.Request.Context(), c.Query("q"), offset, limit)
+	if errors.Is(err, domain.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// queryInt returns the integer query parameter key, or def when it is absent.
+func queryInt(c *gin.Context, key string, def int) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
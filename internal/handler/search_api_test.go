@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockSearchService struct {
+	q             string
+	offset, limit int
+}
+
+func (m *mockSearchService) Search(_ context.Context, q string, offset, limit int) (domain.SearchResult, error) {
+	m.q, m.offset, m.limit = q, offset, limit
+	if q == "bad:" {
+		return domain.SearchResult{}, fmt.Errorf("%w: empty value", domain.ErrInvalidQuery)
+	}
+	return domain.SearchResult{Total: 1, Album: "lib", Photos: []domain.SearchHit{{Key: "k"}}}, nil
+}
+
+func serveSearch(svc *mockSearchService, rawQuery string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/search", NewSearchAPI(svc).search)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/search?"+rawQuery, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSearch_PassesQueryAndPage(t *testing.T) {
+	svc := &mockSearchService{}
+	w := serveSearch(svc, "q="+url.QueryEscape("kenting taken:2023-05")+"&offset=20&limit=10")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if svc.q != "kenting taken:2023-05" || svc.offset != 20 || svc.limit != 10 {
+		t.Errorf("Search(%q, %d, %d)", svc.q, svc.offset, svc.limit)
+	}
+}
+
+func TestSearch_DefaultLimit(t *testing.T) {
+	svc := &mockSearchService{}
+	serveSearch(svc, "q=beach")
+
+	if svc.offset != 0 || svc.limit != defaultSearchLimit {
+		t.Errorf("offset, limit = %d, %d; want 0, %d", svc.offset, svc.limit, defaultSearchLimit)
+	}
+}
+
+func TestSearch_BadRequests(t *testing.T) {
+	for _, q := range []string{"q=bad:", "limit=0", "limit=9999", "offset=-1", "offset=x"} {
+		if w := serveSearch(&mockSearchService{}, q); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type smartAlbumRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Query string `json:"query"`
+}
+
+type smartAlbumService interface {
+	ListSmartAlbums(ctx context.Context) []domain.SmartAlbum
+	AddSmartAlbum(ctx context.Context, def domain.SmartAlbum) error
+	DeleteSmartAlbum(ctx context.Context, name string) error
+}
+
+type SmartAlbumAPI struct {
+	svc smartAlbumService
+}
+
+func NewSmartAlbumAPI(svc smartAlbumService) *SmartAlbumAPI {
+	return &SmartAlbumAPI{svc: svc}
+}
+
+func (h *SmartAlbumAPI) listSmartAlbums(c *gin.Context) {
+	c.JSON(http.StatusOK, h.svc.ListSmartAlbums(c.Request.Context()))
+}
+
+func (h *SmartAlbumAPI) createSmartAlbum(c *gin.Context) {
+	var req smartAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.svc.AddSmartAlbum(c.Request.Context(), domain.SmartAlbum{Name: req.Name, Query: req.Query})
+	if errors.Is(err, domain.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+func (h *SmartAlbumAPI) deleteSmartAlbum(c *gin.Context) {
+	var req smartAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.svc.DeleteSmartAlbum(c.Request.Context(), req.Name)
+	if errors.Is(err, domain.ErrAlbumNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
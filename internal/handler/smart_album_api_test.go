@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockSmartAlbumService struct {
+	albums    []domain.SmartAlbum
+	addErr    error
+	deleteErr error
+	added     domain.SmartAlbum
+}
+
+func (m *mockSmartAlbumService) ListSmartAlbums(_ context.Context) []domain.SmartAlbum {
+	return m.albums
+}
+
+func (m *mockSmartAlbumService) AddSmartAlbum(_ context.Context, def domain.SmartAlbum) error {
+	m.added = def
+	return m.addErr
+}
+
+func (m *mockSmartAlbumService) DeleteSmartAlbum(_ context.Context, _ string) error {
+	return m.deleteErr
+}
+
+func setupSmartAlbumRouter(svc *mockSmartAlbumService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := NewSmartAlbumAPI(svc)
+	r.GET("/api/smart-albums", api.listSmartAlbums)
+	r.POST("/api/smart-albums", api.createSmartAlbum)
+	r.DELETE("/api/smart-albums", api.deleteSmartAlbum)
+	return r
+}
+
+func TestCreateSmartAlbum_Success(t *testing.T) {
+	svc := &mockSmartAlbumService{}
+	r := setupSmartAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/smart-albums", strings.NewReader(`{"name":"Summer","query":"taken:2019-06"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if svc.added.Name != "Summer" || svc.added.Query != "taken:2019-06" {
+		t.Errorf("added = %+v", svc.added)
+	}
+}
+
+func TestCreateSmartAlbum_InvalidQuery(t *testing.T) {
+	svc := &mockSmartAlbumService{addErr: domain.ErrInvalidQuery}
+	r := setupSmartAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/smart-albums", strings.NewReader(`{"name":"Bad","query":"color:red"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeleteSmartAlbum_NotFound(t *testing.T) {
+	svc := &mockSmartAlbumService{deleteErr: domain.ErrAlbumNotFound}
+	r := setupSmartAlbumRouter(svc)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/smart-albums", strings.NewReader(`{"name":"Gone"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
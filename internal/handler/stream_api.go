@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type streamService interface {
+	Stream(ctx context.Context, keys []string, mode string, opts domain.ListOptions) (domain.PhotoStream, error)
+}
+
+// StreamAPI lists the photos of several albums as one stream.
+type StreamAPI struct {
+	svc streamService
+}
+
+func NewStreamAPI(svc streamService) *StreamAPI {
+	return &StreamAPI{svc: svc}
+}
+
+func (h *StreamAPI) stream(c *gin.Context) {
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var keys []string
+	if v := c.Query("albums"); v != "" {
+		keys = strings.Split(v, ",")
+	}
+	stream, err := h.svc.Stream(c.Request.Context(), keys, c.Query("mode"), opts)
+	if errors.Is(err, domain.ErrInvalidMode) || errors.Is(err, domain.ErrInvalidOrder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("X-Shuffle-Seed", strconv.FormatUint(opts.Seed, 10))
+	c.JSON(http.StatusOK, stream)
+}
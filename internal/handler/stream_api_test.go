@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type mockStreamService struct {
+	keys []string
+	mode string
+	opts domain.ListOptions
+}
+
+func (m *mockStreamService) Stream(_ context.Context, keys []string, mode string, opts domain.ListOptions) (domain.PhotoStream, error) {
+	m.keys, m.mode, m.opts = keys, mode, opts
+	switch {
+	case mode == "bogus":
+		return domain.PhotoStream{}, domain.ErrInvalidMode
+	case slices.Contains(keys, "missing"):
+		return domain.PhotoStream{}, domain.ErrAlbumNotFound
+	}
+	return domain.PhotoStream{Album: "lib", Photos: []domain.StreamPhoto{{Key: "k", AlbumKey: "a"}}}, nil
+}
+
+func serveStream(svc *mockStreamService, rawQuery string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/stream", NewStreamAPI(svc).stream)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/stream?"+rawQuery, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStream_PassesAlbumsModeAndSeed(t *testing.T) {
+	svc := &mockStreamService{}
+	w := serveStream(svc, "albums=a,b&mode=proportional&seed=7&favorites=true")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !slices.Equal(svc.keys, []string{"a", "b"}) || svc.mode != "proportional" {
+		t.Errorf("Stream(%q, %q)", svc.keys, svc.mode)
+	}
+	if svc.opts.Seed != 7 || !svc.opts.FavoritesOnly {
+		t.Errorf("opts = %+v", svc.opts)
+	}
+	if got := w.Header().Get("X-Shuffle-Seed"); got != "7" {
+		t.Errorf("X-Shuffle-Seed = %q, want 7", got)
+	}
+}
+
+func TestStream_AllAlbumsByDefault(t *testing.T) {
+	svc := &mockStreamService{}
+	serveStream(svc, "")
+
+	if svc.keys != nil || svc.mode != "" {
+		t.Errorf("Stream(%q, %q), want all albums in the default mode", svc.keys, svc.mode)
+	}
+}
+
+func TestStream_Errors(t *testing.T) {
+	cases := map[string]int{
+		"mode=bogus":     http.StatusBadRequest,
+		"seed=x":         http.StatusBadRequest,
+		"albums=missing": http.StatusNotFound,
+	}
+	for q, want := range cases {
+		if w := serveStream(&mockStreamService{}, q); w.Code != want {
+			t.Errorf("%s: status = %d, want %d", q, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+const (
+	opPut        = "put"
+	opDelete     = "del"
+	opDropSource = "drop"
+)
+
+// recordVersion is the version of the records a scan writes. It goes up
+// whenever scans learn to read something new, such as motion photos in
+// version 1, so that records put by an older version are read again rather
+// than reused.
+const recordVersion = 1
+
+// logEntry is one line of the index file. Put carries a full record and the
+// recordVersion it was read with; delete and drop only name what they
+// remove.
+type logEntry struct {
+	Op       string              `json:"op"`
+	Version  int                 `json:"v,omitempty"`
+	Record   *domain.PhotoRecord `json:"record,omitempty"`
+	SourceID string              `json:"source,omitempty"`
+	Path     string              `json:"path,omitempty"`
+}
+
+// logFile is an append-only JSON-lines file of index changes. Replaying it
+// from the start yields the current records.
+type logFile struct {
+	path string
+}
+
+type recordSet map[string]map[string]domain.PhotoRecord // sourceID -> path -> record
+
+func (s recordSet) apply(e logEntry) {
+	switch e.Op {
+	case opPut:
+		if e.Record == nil {
+			return
+		}
+		// An outdated record is forgotten, so the file is scanned again.
+		if e.Version < recordVersion {
+			delete(s[e.Record.SourceID], e.Record.Path)
+			return
+		}
+		if s[e.Record.SourceID] == nil {
+			s[e.Record.SourceID] = make(map[string]domain.PhotoRecord)
+		}
+		s[e.Record.SourceID][e.Record.Path] = *e.Record
+	case opDelete:
+		delete(s[e.SourceID], e.Path)
+	case opDropSource:
+		delete(s, e.SourceID)
+	}
+}
+
+func (s recordSet) len() int {
+	n := 0
+	for _, recs := range s {
+		n += len(recs)
+	}
+	return n
+}
+
+// load replays the file. A missing file is an empty index, and lines that do
+// not decode, such as one cut short by a crash, are skipped. It also returns
+// the number of lines so callers can decide when to compact.
+func (l *logFile) load() (recordSet, int, error) {
+	set := make(recordSet)
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return set, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		lines++
+		var e logEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		set.apply(e)
+	}
+	return set, lines, sc.Err()
+}
+
+func (l *logFile) append(entries []logEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := writeEntries(w, entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compact rewrites the file as one put per record, replacing it atomically.
+func (l *logFile) compact(set recordSet) error {
+	var entries []logEntry
+	for _, recs := range set {
+		for _, rec := range recs {
+			entries = append(entries, logEntry{Op: opPut, Version: recordVersion, Record: &rec})
+		}
+	}
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := writeEntries(w, entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func writeEntries(w *bufio.Writer, entries []logEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
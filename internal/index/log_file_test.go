@@ -0,0 +1,174 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+var mtime = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func openIndex(t *testing.T, path string) *MemoryIndex {
+	t.Helper()
+	x, err := NewPersistentIndex(path, stubExtractor{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return x
+}
+
+func tripSnaps(files ...domain.FileInfo) []domain.DirSnapshot {
+	return []domain.DirSnapshot{{Path: "trip", Files: files}}
+}
+
+func TestPersistentIndex_ReopenSkipsUnchangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ctx := context.Background()
+	files := map[string][]byte{"trip/a.jpg": []byte("X100"), "trip/b.jpg": []byte("R5")}
+	snaps := tripSnaps(
+		domain.FileInfo{Name: "a.jpg", Size: 4, ModTime: mtime},
+		domain.FileInfo{Name: "b.jpg", Size: 2, ModTime: mtime},
+	)
+
+	first := &stubProvider{files: files}
+	_ = openIndex(t, path).IndexSource(ctx, &domain.Source{ID: "src", Provider: first}, snaps)
+	if first.reads != 2 {
+		t.Fatalf("first scan read %d files, want 2", first.reads)
+	}
+
+	// b.jpg was edited while the server was down.
+	snaps[0].Files[1].ModTime = mtime.Add(time.Hour)
+	second := &stubProvider{files: files}
+	x := openIndex(t, path)
+	if err := x.IndexSource(ctx, &domain.Source{ID: "src", Provider: second}, snaps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.reads != 1 {
+		t.Errorf("rescan read %d files, want only the changed one", second.reads)
+	}
+	if rec, ok := x.Get("src", "trip/a.jpg"); !ok || rec.Model != "X100" || rec.TakenAt == nil {
+		t.Errorf("reused record = %+v, %v", rec, ok)
+	}
+}
+
+func TestPersistentIndex_RescansOutdatedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ctx := context.Background()
+	// a.jpg was indexed before records carried a version, b.jpg since.
+	a := domain.PhotoRecord{SourceID: "src", Path: "trip/a.jpg", Size: 4, ModTime: mtime, Hash: "h"}
+	b := domain.PhotoRecord{SourceID: "src", Path: "trip/b.jpg", Size: 2, ModTime: mtime, Hash: "h", Model: "R5"}
+	if err := (&logFile{path: path}).append([]logEntry{{Op: opPut, Record: &a}, {Op: opPut, Version: recordVersion, Record: &b}}); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &stubProvider{files: map[string][]byte{"trip/a.jpg": []byte("X100"), "trip/b.jpg": []byte("R5")}}
+	x := openIndex(t, path)
+	snaps := tripSnaps(
+		domain.FileInfo{Name: "a.jpg", Size: 4, ModTime: mtime},
+		domain.FileInfo{Name: "b.jpg", Size: 2, ModTime: mtime},
+	)
+	if err := x.IndexSource(ctx, &domain.Source{ID: "src", Provider: provider}, snaps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.reads != 1 {
+		t.Errorf("rescan read %d files, want only the outdated one", provider.reads)
+	}
+	if rec, _ := x.Get("src", "trip/a.jpg"); rec.Model != "X100" {
+		t.Errorf("outdated record = %+v, want it read again", rec)
+	}
+
+	// The new record is current from then on.
+	reopened := &stubProvider{files: provider.files}
+	_ = openIndex(t, path).IndexSource(ctx, &domain.Source{ID: "src", Provider: reopened}, snaps)
+	if reopened.reads != 0 {
+		t.Errorf("reopened index read %d files, want none", reopened.reads)
+	}
+}
+
+func TestPersistentIndex_UnscannedSourcesStayHidden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ctx := context.Background()
+	src := newSource("src", map[string][]byte{"trip/a.jpg": []byte("X100")})
+	_ = openIndex(t, path).IndexSource(ctx, src, tripSnaps(domain.FileInfo{Name: "a.jpg", Size: 4, ModTime: mtime}))
+
+	x := openIndex(t, path)
+	if n := len(x.Records(ctx)); n != 0 {
+		t.Errorf("reopened index lists %d records before any scan, want 0", n)
+	}
+}
+
+func TestPersistentIndex_DeletesAndDrops(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ctx := context.Background()
+	files := map[string][]byte{"trip/a.jpg": []byte("X100"), "trip/b.jpg": []byte("R5")}
+	a := domain.FileInfo{Name: "a.jpg", Size: 4, ModTime: mtime}
+	b := domain.FileInfo{Name: "b.jpg", Size: 2, ModTime: mtime}
+
+	x := openIndex(t, path)
+	_ = x.IndexSource(ctx, newSource("src", files), tripSnaps(a, b))
+	_ = x.IndexSource(ctx, newSource("other", files), tripSnaps(a))
+	_ = x.IndexSource(ctx, newSource("src", files), tripSnaps(a))
+	x.RemoveSource("other")
+
+	known, _, err := (&logFile{path: path}).load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := known["src"]["trip/b.jpg"]; ok {
+		t.Error("deleted file still in the log")
+	}
+	if _, ok := known["other"]; ok {
+		t.Error("removed source still in the log")
+	}
+	if _, ok := known["src"]["trip/a.jpg"]; !ok {
+		t.Error("trip/a.jpg missing from the log")
+	}
+}
+
+func TestPersistentIndex_IgnoresTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ctx := context.Background()
+	src := newSource("src", map[string][]byte{"trip/a.jpg": []byte("X100")})
+	_ = openIndex(t, path).IndexSource(ctx, src, tripSnaps(domain.FileInfo{Name: "a.jpg", Size: 4, ModTime: mtime}))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"put","record":{"SourceID":"src","Pa`)
+	f.Close()
+
+	known, _, err := (&logFile{path: path}).load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(known["src"]) != 1 {
+		t.Errorf("loaded %d records, want 1", len(known["src"]))
+	}
+}
+
+func TestPersistentIndex_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	log := &logFile{path: path}
+	rec := domain.PhotoRecord{SourceID: "src", Path: "a.jpg", Hash: "h"}
+	var entries []logEntry
+	for range 1500 {
+		entries = append(entries, logEntry{Op: opPut, Version: recordVersion, Record: &rec})
+	}
+	if err := log.append(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	openIndex(t, path)
+	known, lines, err := log.load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines != 1 || known["src"]["a.jpg"].Hash != "h" {
+		t.Errorf("after compaction: %d lines, records %+v", lines, known)
+	}
+}
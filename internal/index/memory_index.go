@@ -0,0 +1,214 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// MemoryIndex keeps the metadata of every scanned photo in memory. Files
+// whose size and modification time are unchanged since the last scan are not
+// read again.
+type MemoryIndex struct {
+	mu            sync.RWMutex
+	extractor     domain.MetaExtractor
+	fingerprinter domain.Fingerprinter
+	video         domain.VideoMetaExtractor
+	records       recordSet
+	// known holds records loaded from the log; a source only becomes part of
+	// records once it is scanned, so stale sources never show up.
+	known recordSet
+	log   *logFile
+}
+
+// NewMemoryIndex creates an index; fingerprinter may be nil to skip
+// dimensions and perceptual hashes.
+func NewMemoryIndex(extractor domain.MetaExtractor, fingerprinter domain.Fingerprinter) *MemoryIndex {
+	return &MemoryIndex{
+		extractor:     extractor,
+		fingerprinter: fingerprinter,
+		records:       make(recordSet),
+		known:         make(recordSet),
+	}
+}
+
+// NewPersistentIndex creates an index backed by the append-only file at path,
+// so a restart only reads photos that changed in the meantime.
+func NewPersistentIndex(path string, extractor domain.MetaExtractor, fingerprinter domain.Fingerprinter) (*MemoryIndex, error) {
+	x := NewMemoryIndex(extractor, fingerprinter)
+	x.log = &logFile{path: path}
+	known, lines, err := x.log.load()
+	if err != nil {
+		return nil, err
+	}
+	x.known = known
+	// Every rescan appends its changes; rewrite once the history dominates.
+	if lines > 2*known.len()+1000 {
+		if err := x.log.compact(known); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// SetVideoExtractor sets the extractor reading video metadata. Without one,
+// videos are indexed by hash alone.
+func (x *MemoryIndex) SetVideoExtractor(e domain.VideoMetaExtractor) {
+	x.video = e
+}
+
+// IndexSource replaces the records of src with the images found in snaps.
+// Photos that cannot be read are still indexed, just without metadata.
+func (x *MemoryIndex) IndexSource(ctx context.Context, src *domain.Source, snaps []domain.DirSnapshot) error {
+	x.mu.RLock()
+	prev := x.known[src.ID]
+	x.mu.RUnlock()
+
+	recs := make(map[string]domain.PhotoRecord)
+	var changes []logEntry
+	for _, snap := range snaps {
+		for _, f := range snap.Files {
+			if f.IsDir || !domain.IsMedia(f.Name) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := path.Join(snap.Path, f.Name)
+			if rec, ok := prev[p]; ok && unchanged(rec, f) {
+				recs[p] = rec
+				continue
+			}
+			rec := x.scan(ctx, src, p, f)
+			recs[p] = rec
+			changes = append(changes, logEntry{Op: opPut, Version: recordVersion, Record: &rec})
+		}
+	}
+	for p := range prev {
+		if _, ok := recs[p]; !ok {
+			changes = append(changes, logEntry{Op: opDelete, SourceID: src.ID, Path: p})
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.records[src.ID] = recs
+	x.known[src.ID] = recs
+	x.persist(changes)
+	return nil
+}
+
+// unchanged reports whether f is still the file rec was read from. Providers
+// that do not report modification times always trigger a rescan.
+func unchanged(rec domain.PhotoRecord, f domain.FileInfo) bool {
+	return rec.Hash != "" && !f.ModTime.IsZero() && rec.Size == f.Size && rec.ModTime.Equal(f.ModTime)
+}
+
+// persist appends changes to the log, if any. A failed write only costs a
+// rescan after restart, so it is logged rather than returned.
+func (x *MemoryIndex) persist(changes []logEntry) {
+	if x.log == nil {
+		return
+	}
+	if err := x.log.append(changes); err != nil {
+		log.Printf("error writing photo index: %v", err)
+	}
+}
+
+func (x *MemoryIndex) scan(ctx context.Context, src *domain.Source, p string, f domain.FileInfo) domain.PhotoRecord {
+	rec := domain.PhotoRecord{SourceID: src.ID, Path: p, Size: f.Size, ModTime: f.ModTime}
+	if domain.IsVideo(p) {
+		x.scanVideo(ctx, src, &rec)
+		return rec
+	}
+	data, err := src.Provider.ReadFile(ctx, p)
+	if err != nil {
+		return rec
+	}
+	sum := sha256.Sum256(data)
+	rec.Hash = hex.EncodeToString(sum[:])
+	if meta, err := x.extractor.Extract(ctx, data); err == nil && meta != nil {
+		rec.TakenAt = meta.TakenAt
+		rec.Model = meta.Model
+		rec.Rating = meta.Rating
+		rec.Keywords = meta.Keywords
+		rec.Caption = meta.Caption
+		rec.Motion = meta.Motion
+	}
+	if x.fingerprinter != nil {
+		if fp, err := x.fingerprinter.Fingerprint(ctx, data); err == nil {
+			rec.Width, rec.Height, rec.DHash = fp.Width, fp.Height, fp.DHash
+			rec.Animation = fp.Animation
+		}
+	}
+	return rec
+}
+
+// scanVideo hashes a video while streaming it, as videos are too large to
+// read whole, then reads its metadata from the file.
+func (x *MemoryIndex) scanVideo(ctx context.Context, src *domain.Source, rec *domain.PhotoRecord) {
+	f, _, err := src.Provider.Open(ctx, rec.Path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return
+	}
+	rec.Hash = hex.EncodeToString(h.Sum(nil))
+	if x.video == nil {
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if meta, err := x.video.ExtractVideo(ctx, f); err == nil && meta != nil {
+		rec.TakenAt = meta.TakenAt
+		rec.Model = meta.Model
+	}
+}
+
+func (x *MemoryIndex) RemoveSource(sourceID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.records, sourceID)
+	if _, ok := x.known[sourceID]; ok {
+		delete(x.known, sourceID)
+		x.persist([]logEntry{{Op: opDropSource, SourceID: sourceID}})
+	}
+}
+
+// Records returns every indexed photo ordered by source and path.
+func (x *MemoryIndex) Records(_ context.Context) []domain.PhotoRecord {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var out []domain.PhotoRecord
+	for _, recs := range x.records {
+		for _, rec := range recs {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SourceID != out[j].SourceID {
+			return out[i].SourceID < out[j].SourceID
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+func (x *MemoryIndex) Get(sourceID, p string) (domain.PhotoRecord, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	rec, ok := x.records[sourceID][p]
+	return rec, ok
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+type stubProvider struct {
+	files map[string][]byte
+	reads int
+	opens int
+}
+
+func (p *stubProvider) ListDir(_ context.Context, _ string) ([]domain.FileInfo, error) {
+	return nil, nil
+}
+
+func (p *stubProvider) Walk(_ context.Context, _ string, _ int) ([]domain.DirSnapshot, error) {
+	return nil, nil
+}
+
+func (p *stubProvider) ReadFile(_ context.Context, filePath string) ([]byte, error) {
+	p.reads++
+	data, ok := p.files[filePath]
+	if !ok {
+		return nil, errors.New("file not found: " + filePath)
+	}
+	return data, nil
+}
+
+func (p *stubProvider) Open(_ context.Context, filePath string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	p.opens++
+	data, ok := p.files[filePath]
+	if !ok {
+		return nil, domain.FileInfo{}, errors.New("file not found: " + filePath)
+	}
+	return nopCloser{bytes.NewReader(data)}, domain.FileInfo{Path: filePath, Size: int64(len(data))}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+// stubVideoExtractor reports the first bytes of a video as the camera model.
+type stubVideoExtractor struct{}
+
+func (stubVideoExtractor) ExtractVideo(_ context.Context, r io.ReadSeeker) (*domain.PhotoMeta, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	return &domain.PhotoMeta{Model: string(head)}, nil
+}
+
+// stubExtractor reports the file content as the camera model.
+type stubExtractor struct{}
+
+func (stubExtractor) Extract(_ context.Context, data []byte) (*domain.PhotoMeta, error) {
+	tm := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	return &domain.PhotoMeta{TakenAt: &tm, Model: string(data)}, nil
+}
+
+func newSource(id string, files map[string][]byte) *domain.Source {
+	return &domain.Source{ID: id, Provider: &stubProvider{files: files}}
+}
+
+func TestMemoryIndex_IndexSource(t *testing.T) {
+	x := NewMemoryIndex(stubExtractor{}, nil)
+	src := newSource("src1", map[string][]byte{"trip/a.jpg": []byte("X100")})
+	snaps := []domain.DirSnapshot{
+		{Path: "trip", Files: []domain.FileInfo{
+			{Name: "a.jpg"},
+			{Name: "missing.png"},
+			{Name: "notes.txt"},
+			{Name: "sub", IsDir: true},
+		}},
+	}
+
+	if err := x.IndexSource(context.Background(), src, snaps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recs := x.Records(context.Background())
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+	rec, ok := x.Get("src1", "trip/a.jpg")
+	if !ok || rec.Model != "X100" || rec.TakenAt == nil {
+		t.Errorf("Get() = %+v, %v; want metadata for trip/a.jpg", rec, ok)
+	}
+	// sha256("X100")
+	if want := "ef48329a38ae9ca45fe95d4ab41db16bb3e173d921c712a1d1e1884d51e861c4"; rec.Hash != want {
+		t.Errorf("Hash = %q, want %q", rec.Hash, want)
+	}
+	// Unreadable photos are indexed without metadata.
+	if rec, ok := x.Get("src1", "trip/missing.png"); !ok || rec.TakenAt != nil || rec.Hash != "" {
+		t.Errorf("Get(missing) = %+v, %v; want bare record", rec, ok)
+	}
+}
+
+func TestMemoryIndex_IndexesVideosWithoutReadingThemWhole(t *testing.T) {
+	x := NewMemoryIndex(stubExtractor{}, nil)
+	x.SetVideoExtractor(stubVideoExtractor{})
+	provider := &stubProvider{files: map[string][]byte{"trip/clip.mp4": []byte("X100")}}
+	src := &domain.Source{ID: "src1", Provider: provider}
+	snaps := []domain.DirSnapshot{{Path: "trip", Files: []domain.FileInfo{{Name: "clip.mp4"}}}}
+
+	if err := x.IndexSource(context.Background(), src, snaps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec, ok := x.Get("src1", "trip/clip.mp4")
+	// sha256("X100")
+	if !ok || rec.Model != "X100" || rec.Hash != "ef48329a38ae9ca45fe95d4ab41db16bb3e173d921c712a1d1e1884d51e861c4" {
+		t.Errorf("Get() = %+v, %v; want the hash and video metadata", rec, ok)
+	}
+	if provider.reads != 0 || provider.opens != 1 {
+		t.Errorf("reads = %d, opens = %d; want the video streamed once", provider.reads, provider.opens)
+	}
+}
+
+func TestMemoryIndex_ReindexReplacesSource(t *testing.T) {
+	x := NewMemoryIndex(stubExtractor{}, nil)
+	src := newSource("src1", nil)
+	ctx := context.Background()
+
+	_ = x.IndexSource(ctx, src, []domain.DirSnapshot{{Files: []domain.FileInfo{{Name: "old.jpg"}}}})
+	_ = x.IndexSource(ctx, src, []domain.DirSnapshot{{Files: []domain.FileInfo{{Name: "new.jpg"}}}})
+
+	if _, ok := x.Get("src1", "old.jpg"); ok {
+		t.Error("old.jpg should have been dropped by the rescan")
+	}
+	if _, ok := x.Get("src1", "new.jpg"); !ok {
+		t.Error("new.jpg should be indexed")
+	}
+}
+
+func TestMemoryIndex_RecordsSortedAcrossSources(t *testing.T) {
+	x := NewMemoryIndex(stubExtractor{}, nil)
+	ctx := context.Background()
+	_ = x.IndexSource(ctx, newSource("b", nil), []domain.DirSnapshot{{Files: []domain.FileInfo{{Name: "1.jpg"}}}})
+	_ = x.IndexSource(ctx, newSource("a", nil), []domain.DirSnapshot{{Files: []domain.FileInfo{{Name: "2.jpg"}, {Name: "1.jpg"}}}})
+
+	recs := x.Records(ctx)
+	want := []string{"a/1.jpg", "a/2.jpg", "b/1.jpg"}
+	for i, rec := range recs {
+		if got := rec.SourceID + "/" + rec.Path; got != want[i] {
+			t.Errorf("Records()[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+
+	x.RemoveSource("a")
+	if n := len(x.Records(ctx)); n != 1 {
+		t.Errorf("after RemoveSource: %d records, want 1", n)
+	}
+}
@@ -0,0 +1,170 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// maxPassthroughAnimation is the size up to which animations are served
+// as they are; resizing every frame costs more than sending a small file.
+const maxPassthroughAnimation = 512 << 10
+
+// minFrameDelay is what browsers show frames for whose delay is 10 ms or
+// less, so loop lengths match what viewers see.
+const minFrameDelay = 100 * time.Millisecond
+
+// animation reports how long one loop of an animated GIF or WebP lasts. It
+// returns false for stills and other formats.
+func animation(data []byte) (time.Duration, bool) {
+	if d, ok := webpAnimation(data); ok {
+		return d, true
+	}
+	if !bytes.HasPrefix(data, []byte("GIF8")) {
+		return 0, false
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(g.Image) < 2 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, delay := range g.Delay {
+		total += frameDelay(time.Duration(delay) * 10 * time.Millisecond)
+	}
+	return total, true
+}
+
+// webpAnimation sums the frame durations of an animated WebP, read from the
+// ANMF chunks of its RIFF container.
+func webpAnimation(data []byte) (time.Duration, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, false
+	}
+	var total time.Duration
+	frames := 0
+	for p := 12; p+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[p+4 : p+8]))
+		body := data[p+8 : min(p+8+size, len(data))]
+		// An ANMF payload starts with the frame offset and size, 3 bytes
+		// each, then the 24-bit duration in milliseconds.
+		if string(data[p:p+4]) == "ANMF" && len(body) >= 15 {
+			frames++
+			ms := uint32(body[12]) | uint32(body[13])<<8 | uint32(body[14])<<16
+			total += frameDelay(time.Duration(ms) * time.Millisecond)
+		}
+		// Chunks are padded to an even size.
+		p += 8 + size + size&1
+	}
+	return total, frames > 1
+}
+
+// webpFirstFrame decodes the first frame of an animated WebP and draws it on
+// a canvas the size of the animation, for a still rendition of animations
+// too large to send as they are.
+func webpFirstFrame(data []byte) (image.Image, bool) {
+	var canvas *image.NRGBA
+	for p := 12; p+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[p+4 : p+8]))
+		if size < 0 || p+8+size > len(data) {
+			return nil, false
+		}
+		body := data[p+8 : p+8+size]
+		switch string(data[p : p+4]) {
+		case "VP8X":
+			if len(body) < 10 {
+				return nil, false
+			}
+			canvas = image.NewNRGBA(image.Rect(0, 0, uint24(body[4:])+1, uint24(body[7:])+1))
+		case "ANMF":
+			// The frame's position, halved, size less one and duration, 3
+			// bytes each, and a flag byte precede its ALPH and VP8 or VP8L
+			// chunks.
+			if canvas == nil || len(body) < 24 {
+				return nil, false
+			}
+			frame := body[16:]
+			if string(frame[:4]) == "ALPH" {
+				// Lossy frames keep their alpha in a chunk of its own, which
+				// only an extended file may hold.
+				vp8x := append([]byte{0x10, 0, 0, 0}, body[6:12]...)
+				frame = append(riffChunk("VP8X", vp8x), frame...)
+			}
+			file := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(4+len(frame)))
+			img, err := webp.Decode(bytes.NewReader(append(append(file, "WEBP"...), frame...)))
+			if err != nil {
+				return nil, false
+			}
+			at := image.Pt(2*uint24(body[0:]), 2*uint24(body[3:]))
+			draw.Draw(canvas, img.Bounds().Add(at), img, img.Bounds().Min, draw.Over)
+			return canvas, true
+		}
+		p += 8 + size + size&1
+	}
+	return nil, false
+}
+
+// uint24 reads the little-endian 24-bit number at the start of b.
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func frameDelay(d time.Duration) time.Duration {
+	if d <= 10*time.Millisecond {
+		return minFrameDelay
+	}
+	return d
+}
+
+// resizeGIF resizes every frame of an animated GIF, keeping frame delays and
+// the loop count. Frames are composited first, as a frame may only cover
+// the part of the canvas that changed, so each output frame is whole.
+func resizeGIF(data []byte, r Rendition) ([]byte, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// Quantizing every frame to the global palette keeps colors from
+	// flickering between frames.
+	global, _ := g.Config.ColorModel.(color.Palette)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	out := &gif.GIF{LoopCount: g.LoopCount}
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		small := resize(canvas, r)
+		pal := frame.Palette
+		if len(global) > 0 {
+			pal = global
+		}
+		dst := image.NewPaletted(small.Bounds(), pal)
+		draw.Draw(dst, dst.Bounds(), small, small.Bounds().Min, draw.Src)
+		out.Image = append(out.Image, dst)
+		out.Delay = append(out.Delay, g.Delay[i])
+		// Output frames cover the whole canvas, so each replaces the last.
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
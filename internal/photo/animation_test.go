@@ -0,0 +1,178 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// makeGIF encodes an animation of frames of w x h noise, each shown for
+// delay hundredths of a second.
+func makeGIF(t *testing.T, w, h, frames, delay int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	g := &gif.GIF{LoopCount: 3}
+	for range frames {
+		img := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(rng.IntN(len(palette.Plan9)))
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, delay)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// makeAnimatedWebP builds the container of an animated WebP whose frames last
+// the given milliseconds. Frames carry no image data, which is all the
+// container parsing needs.
+func makeAnimatedWebP(durations ...int) []byte {
+	vp8x := []byte{0x02, 0, 0, 0, 99, 0, 0, 49, 0, 0} // animation flag, 100x50
+	body := append([]byte("WEBP"), riffChunk("VP8X", vp8x)...)
+	body = append(body, riffChunk("ANIM", make([]byte, 6))...)
+	for _, ms := range durations {
+		anmf := make([]byte, 16)
+		anmf[12], anmf[13], anmf[14] = byte(ms), byte(ms>>8), byte(ms>>16)
+		body = append(body, riffChunk("ANMF", anmf)...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+func TestAnimation(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		want     time.Duration
+		animated bool
+	}{
+		{"animated gif", makeGIF(t, 8, 8, 3, 20), 600 * time.Millisecond, true},
+		{"zero delays", makeGIF(t, 8, 8, 2, 0), 200 * time.Millisecond, true},
+		{"still gif", makeGIF(t, 8, 8, 1, 0), 0, false},
+		{"animated webp", makeAnimatedWebP(40, 1000), 1040 * time.Millisecond, true},
+		{"still webp", makeAnimatedWebP(40), 0, false},
+		{"jpeg", makeJPEG(t, 8, 8), 0, false},
+	}
+	for _, tt := range tests {
+		got, animated := animation(tt.data)
+		if got != tt.want || animated != tt.animated {
+			t.Errorf("%s: animation() = %v, %v; want %v, %v", tt.name, got, animated, tt.want, tt.animated)
+		}
+	}
+}
+
+func TestImageCompressor_SmallAnimationsPassThrough(t *testing.T) {
+	c := NewImageCompressor()
+	for name, data := range map[string][]byte{
+		"gif":  makeGIF(t, 64, 64, 3, 10),
+		"webp": makeAnimatedWebP(100, 100),
+	} {
+		out, err := c.Compress(context.Background(), data, Rendition{Width: 256, Height: 256, Mode: ModeFit, WebP: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: animation was re-encoded", name)
+		}
+	}
+}
+
+func TestImageCompressor_ResizesAnimatedGIF(t *testing.T) {
+	data := makeGIF(t, 600, 400, 3, 25)
+	if len(data) <= maxPassthroughAnimation {
+		t.Fatalf("fixture is %d bytes, too small to be resized", len(data))
+	}
+	c := NewImageCompressor()
+	out, err := c.Compress(context.Background(), data, Rendition{Width: 256, Height: 256, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if len(g.Image) != 3 || g.LoopCount != 3 {
+		t.Fatalf("got %d frames looping %d times, want 3 frames looping 3 times", len(g.Image), g.LoopCount)
+	}
+	for i, frame := range g.Image {
+		if b := frame.Bounds(); b.Dx() != 256 || b.Dy() != 170 {
+			t.Errorf("frame %d = %dx%d, want 256x170", i, b.Dx(), b.Dy())
+		}
+		if g.Delay[i] != 25 {
+			t.Errorf("frame %d delay = %d, want 25", i, g.Delay[i])
+		}
+	}
+}
+
+// encodeAnimatedWebP builds a real animated WebP of w x h noisy frames,
+// each a lossless still wrapped in an ANMF chunk.
+func encodeAnimatedWebP(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	vp8x := []byte{0x02, 0, 0, 0, byte(w - 1), byte((w - 1) >> 8), 0, byte(h - 1), byte((h - 1) >> 8), 0}
+	body := append([]byte("WEBP"), riffChunk("VP8X", vp8x)...)
+	body = append(body, riffChunk("ANIM", make([]byte, 6))...)
+	for range frames {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(rng.IntN(64)*4) | 0xff*uint8(i%4/3)
+		}
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		anmf := []byte{0, 0, 0, 0, 0, 0, vp8x[4], vp8x[5], 0, vp8x[7], vp8x[8], 0, 100, 0, 0, 0}
+		body = append(body, riffChunk("ANMF", append(anmf, buf.Bytes()[12:]...))...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+func TestImageCompressor_LargeAnimatedWebPBecomesStill(t *testing.T) {
+	data := encodeAnimatedWebP(t, 400, 300, 2)
+	if len(data) <= maxPassthroughAnimation {
+		t.Fatalf("fixture is %d bytes, too small to be resized", len(data))
+	}
+	out, err := NewImageCompressor().Compress(context.Background(), data, Rendition{Width: 256, Height: 256, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, animated := animation(out); animated {
+		t.Error("output is still animated")
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || format != "jpeg" || cfg.Width != 256 || cfg.Height != 192 {
+		t.Errorf("output is %s %dx%d (%v), want a 256x192 jpeg", format, cfg.Width, cfg.Height, err)
+	}
+}
+
+func TestImageFingerprinter_Animations(t *testing.T) {
+	f := NewImageFingerprinter()
+	fp, err := f.Fingerprint(context.Background(), makeGIF(t, 32, 16, 2, 50))
+	if err != nil {
+		t.Fatalf("gif: unexpected error: %v", err)
+	}
+	if fp.Width != 32 || fp.Height != 16 || fp.Animation != time.Second {
+		t.Errorf("gif: fingerprint = %+v, want 32x16 lasting 1s", fp)
+	}
+	// Animated WebPs cannot be decoded, so they get no dimensions or hash
+	// that could match them with other images.
+	fp, err = f.Fingerprint(context.Background(), makeAnimatedWebP(500, 500))
+	if err != nil {
+		t.Fatalf("webp: unexpected error: %v", err)
+	}
+	if fp != (domain.Fingerprint{Animation: time.Second}) {
+		t.Errorf("webp: fingerprint = %+v, want only the loop length", fp)
+	}
+}
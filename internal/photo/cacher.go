@@ -13,6 +13,9 @@ var ErrCacheMiss = errors.New("cache miss")
 type CachedPhoto struct {
 	Data []byte
 	Meta *domain.PhotoMeta
+	// WebPCandidate is set when clients accepting WebP may get a different
+	// rendition of the same photo, as reported by WebPCandidate.
+	WebPCandidate bool
 }
 
 type Cacher interface {
@@ -8,16 +8,23 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 
+	"github.com/HugoSmits86/nativewebp"
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
 )
 
 const (
 	maxLongEdge = 1920
 	jpegQuality = 80
+	// maxHEIFThumbnailEdge is the longest edge of the renditions that HEIC
+	// files holding only HEVC images are sent their thumbnail for.
+	maxHEIFThumbnailEdge = 640
 )
 
+// Compressor re-encodes a photo at the given rendition. Data it cannot
+// decode or encode is returned unchanged.
 type Compressor interface {
-	Compress(ctx context.Context, data []byte) ([]byte, error)
+	Compress(ctx context.Context, data []byte, r Rendition) ([]byte, error)
 }
 
 type ImageCompressor struct{}
@@ -26,31 +33,141 @@ func NewImageCompressor() *ImageCompressor {
 	return &ImageCompressor{}
 }
 
-func (c *ImageCompressor) Compress(_ context.Context, data []byte) ([]byte, error) {
+// Compress resizes a photo to r and encodes it in the smallest format r
+// allows: JPEG, or PNG for images with transparency, and WebP when r.WebP
+// is set. RAW and HEIC files are rendered from the JPEG they embed.
+func (c *ImageCompressor) Compress(_ context.Context, data []byte, r Rendition) ([]byte, error) {
+	if r.IsOriginal() {
+		return data, nil
+	}
+	if preview, ok := embeddedPreview(data); ok {
+		data = preview
+	} else if r.Width > 0 && r.Height > 0 && max(r.Width, r.Height) <= maxHEIFThumbnailEdge {
+		if thumb, ok := heifThumbnail(data); ok {
+			return thumb, nil
+		}
+	}
 	_, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return data, nil
 	}
-
-	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
-	if err != nil {
+	switch format {
+	case "jpeg", "png", "webp", "gif":
+	default:
+		return data, nil
+	}
+	var img image.Image
+	if _, ok := animation(data); ok {
+		if len(data) <= maxPassthroughAnimation {
+			return data, nil
+		}
+		if format == "gif" {
+			if out, err := resizeGIF(data, r); err == nil {
+				return out, nil
+			}
+			return data, nil
+		}
+		if img, ok = webpFirstFrame(data); !ok {
+			return data, nil
+		}
+	} else if img, err = imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true)); err != nil {
 		return data, nil
 	}
 
-	img = imaging.Fit(img, maxLongEdge, maxLongEdge, imaging.CatmullRom)
+	img, profile := manageColor(resize(img, r), iccProfile(data))
 
+	var best []byte
+	if r.WebP {
+		if format == "png" || !opaque(img) {
+			best, _ = encodeWebP(img)
+		}
+		if opaque(img) {
+			if out, err := encodeLossyWebP(img); err == nil && (best == nil || len(out) < len(best)) {
+				best = out
+			}
+		}
+	}
 	var buf bytes.Buffer
-	switch format {
-	case "jpeg":
+	if opaque(img) {
 		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(jpegQuality))
-	case "png":
+	} else if best == nil {
 		err = imaging.Encode(&buf, img, imaging.PNG)
-	default:
+	}
+	if err == nil && buf.Len() > 0 && (best == nil || buf.Len() < len(best)) {
+		best = buf.Bytes()
+	}
+	if best == nil {
 		return data, nil
 	}
+	if profile != nil {
+		best = withICC(best, profile)
+	}
+	return best, nil
+}
+
+// WebPCandidate reports whether Compress may return WebP for data when the
+// rendition allows it, so callers know whether the output depends on it.
+func WebPCandidate(data []byte) bool {
+	if preview, ok := embeddedPreview(data); ok {
+		data = preview
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return data, nil
+		return false
+	}
+	switch format {
+	case "jpeg", "png", "gif", "webp":
+		return true
+	}
+	return false
+}
+
+// encodeWebP encodes img as lossless WebP, which beats lossy WebP and JPEG
+// on screenshots and other flat images and keeps transparency. The encoder panics on some
+// inputs, which counts as a failure.
+func encodeWebP(img image.Image) (out []byte, ok bool) {
+	defer func() {
+		if recover() != nil {
+			out, ok = nil, false
+		}
+	}()
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// embeddedPreview returns the JPEG standing in for a RAW or HEIF file, which
+// cannot be decoded themselves.
+func embeddedPreview(data []byte) ([]byte, bool) {
+	if preview, ok := rawPreview(data); ok {
+		return preview, true
 	}
+	return heifPreview(data)
+}
 
-	return buf.Bytes(), nil
+func resize(img image.Image, r Rendition) image.Image {
+	switch r.Mode {
+	case ModeFill:
+		return imaging.Fill(img, r.Width, r.Height, imaging.Center, imaging.CatmullRom)
+	case ModeCrop:
+		return imaging.CropCenter(img, r.Width, r.Height)
+	}
+	w, h := r.Width, r.Height
+	if w == 0 {
+		w = img.Bounds().Dx()
+	}
+	if h == 0 {
+		h = img.Bounds().Dy()
+	}
+	return imaging.Fit(img, w, h, imaging.CatmullRom)
+}
+
+// opaque reports whether img has no transparent pixels.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
 }
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"image"
+	"image/color"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"math/rand/v2"
 	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
 )
 
 func makeJPEG(t *testing.T, w, h int) []byte {
@@ -40,7 +45,7 @@ func imageSize(data []byte) (int, int) {
 func TestImageCompressor_InvalidInput(t *testing.T) {
 	c := NewImageCompressor()
 	input := []byte("not an image")
-	out, err := c.Compress(context.Background(), input)
+	out, err := c.Compress(context.Background(), input, DefaultRendition)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -49,28 +54,25 @@ func TestImageCompressor_InvalidInput(t *testing.T) {
 	}
 }
 
-func TestImageCompressor_UnsupportedFormat(t *testing.T) {
-	// Minimal valid GIF89a (1x1 pixel)
-	gif1x1 := []byte{
-		0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00,
-		0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00,
-		0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02,
-		0x00, 0x3b,
+func TestImageCompressor_StillGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewGray(image.Rect(0, 0, 512, 512)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
 	}
 	c := NewImageCompressor()
-	out, err := c.Compress(context.Background(), gif1x1)
+	out, err := c.Compress(context.Background(), buf.Bytes(), Rendition{Width: 256, Height: 256, Mode: ModeFit})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !bytes.Equal(out, gif1x1) {
-		t.Error("expected original GIF data to be returned unchanged")
+	if w, h := imageSize(out); w != 256 || h != 256 || formatOf(out) != "jpeg" {
+		t.Errorf("got %s %dx%d, want a 256x256 jpeg", formatOf(out), w, h)
 	}
 }
 
 func TestImageCompressor_SmallJPEG(t *testing.T) {
 	input := makeJPEG(t, 100, 100)
 	c := NewImageCompressor()
-	out, err := c.Compress(context.Background(), input)
+	out, err := c.Compress(context.Background(), input, DefaultRendition)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -86,7 +88,7 @@ func TestImageCompressor_SmallJPEG(t *testing.T) {
 func TestImageCompressor_LargeJPEG(t *testing.T) {
 	input := makeJPEG(t, 3000, 2000)
 	c := NewImageCompressor()
-	out, err := c.Compress(context.Background(), input)
+	out, err := c.Compress(context.Background(), input, DefaultRendition)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -102,7 +104,7 @@ func TestImageCompressor_LargeJPEG(t *testing.T) {
 func TestImageCompressor_LargePNG(t *testing.T) {
 	input := makePNG(t, 2500, 3000)
 	c := NewImageCompressor()
-	out, err := c.Compress(context.Background(), input)
+	out, err := c.Compress(context.Background(), input, DefaultRendition)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -114,3 +116,148 @@ func TestImageCompressor_LargePNG(t *testing.T) {
 		t.Errorf("large PNG was not resized: got %dx%d, want long edge ≤ %d", w, h, maxLongEdge)
 	}
 }
+
+func TestImageCompressor_Renditions(t *testing.T) {
+	input := makeJPEG(t, 400, 200)
+	tests := []struct {
+		r     Rendition
+		wantW int
+		wantH int
+	}{
+		{Rendition{Width: 100, Height: 100, Mode: ModeFit}, 100, 50},
+		{Rendition{Height: 100, Mode: ModeFit}, 200, 100},
+		{Rendition{Width: 100, Height: 100, Mode: ModeFill}, 100, 100},
+		{Rendition{Width: 100, Height: 100, Mode: ModeCrop}, 100, 100},
+	}
+	c := NewImageCompressor()
+	for _, tt := range tests {
+		out, err := c.Compress(context.Background(), input, tt.r)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.r.Key(), err)
+		}
+		if w, h := imageSize(out); w != tt.wantW || h != tt.wantH {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.r.Key(), w, h, tt.wantW, tt.wantH)
+		}
+	}
+
+	if out, _ := c.Compress(context.Background(), input, Rendition{}); !bytes.Equal(out, input) {
+		t.Error("original rendition should return the file unchanged")
+	}
+}
+
+func formatOf(data []byte) string {
+	_, format, _ := image.DecodeConfig(bytes.NewReader(data))
+	return format
+}
+
+// makeScreenshot returns a flat two-tone image, which compresses far better
+// losslessly than as JPEG.
+func makeScreenshot(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if (x/40+y/40)%2 == 0 {
+				c = color.NRGBA{R: 30, G: 60, B: 90, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestImageCompressor_ResizesWebP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, makeScreenshot(3000, 1000), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	out, err := NewImageCompressor().Compress(context.Background(), buf.Bytes(), DefaultRendition)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, _ := imageSize(out); w != maxLongEdge {
+		t.Errorf("width = %d, want %d", w, maxLongEdge)
+	}
+}
+
+func TestImageCompressor_OutputFormats(t *testing.T) {
+	var screenshot bytes.Buffer
+	if err := png.Encode(&screenshot, makeScreenshot(800, 600)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var photoJPEG bytes.Buffer
+	if err := jpeg.Encode(&photoJPEG, makePhoto(800, 600), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	transparent := image.NewNRGBA(image.Rect(0, 0, 50, 50))
+	var clear bytes.Buffer
+	if err := png.Encode(&clear, transparent); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	webp := DefaultRendition
+	webp.WebP = true
+
+	tests := []struct {
+		name  string
+		input []byte
+		r     Rendition
+		want  string
+	}{
+		{"opaque PNG falls back to JPEG", screenshot.Bytes(), DefaultRendition, "jpeg"},
+		{"flat PNG is smaller as WebP", screenshot.Bytes(), webp, "webp"},
+		{"JPEG stays JPEG", photoJPEG.Bytes(), DefaultRendition, "jpeg"},
+		{"JPEG is smaller as lossy WebP", photoJPEG.Bytes(), webp, "webp"},
+		{"transparent PNG stays PNG", clear.Bytes(), DefaultRendition, "png"},
+		{"transparent PNG as WebP", clear.Bytes(), webp, "webp"},
+	}
+	c := NewImageCompressor()
+	for _, tt := range tests {
+		out, err := c.Compress(context.Background(), tt.input, tt.r)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if got := formatOf(out); got != tt.want {
+			t.Errorf("%s: format = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebPCandidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  bool
+	}{
+		{"PNG", makePNG(t, 10, 10), true},
+		{"JPEG", makeJPEG(t, 10, 10), true},
+		{"not an image", []byte("hello"), false},
+	}
+	for _, tt := range tests {
+		if got := WebPCandidate(tt.input); got != tt.want {
+			t.Errorf("%s: WebPCandidate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImageCompressor_NoisyPNGAsWebP(t *testing.T) {
+	// The WebP encoder panics on noise like this; Compress falls back to
+	// JPEG instead.
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.IntN(256)) | 0xff*uint8(i%4/3)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	r := DefaultRendition
+	r.WebP = true
+	out, err := NewImageCompressor().Compress(context.Background(), buf.Bytes(), r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := formatOf(out); got != "jpeg" {
+		t.Errorf("format = %q, want jpeg", got)
+	}
+}
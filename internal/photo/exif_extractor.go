@@ -3,6 +3,10 @@ package photo
 import (
 	"bytes"
 	"context"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/Aquila-f/photo-slider/internal/domain"
 	"github.com/rwcarlsen/goexif/exif"
@@ -16,17 +20,64 @@ func NewEXIFExtractor() *EXIFExtractor {
 
 const maxEXIFBytes = 64 * 1024
 
+// xmpRating matches both the attribute and the element form of xmp:Rating.
+var xmpRating = regexp.MustCompile(`xmp:Rating(?:\s*=\s*["']|>)\s*(-?\d)`)
+
+var (
+	xmpSubject     = regexp.MustCompile(`(?s)<dc:subject>(.*?)</dc:subject>`)
+	xmpDescription = regexp.MustCompile(`(?s)<dc:description>(.*?)</dc:description>`)
+	rdfItem        = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+)
+
 func (e *EXIFExtractor) Extract(_ context.Context, data []byte) (*domain.PhotoMeta, error) {
 	meta := &domain.PhotoMeta{}
 
-	if len(data) > maxEXIFBytes {
-		data = data[:maxEXIFBytes]
+	// TIFF-based RAW files keep their EXIF in IFDs that can lie anywhere in
+	// the file, so they are decoded whole. RAF files are not TIFF; their
+	// EXIF is the preview's. HEIF files keep EXIF and XMP in items of their
+	// own.
+	exifData, xmpData := data, data
+	switch {
+	case bytes.HasPrefix(data, rafMagic):
+		if preview, ok := rawPreview(data); ok {
+			exifData = preview
+		}
+	case IsHEIF(data):
+		if tiff, ok := heifExif(data); ok {
+			exifData = tiff
+		}
+		if xmp, ok := heifXMP(data); ok {
+			xmpData = xmp
+		}
+	}
+	if len(xmpData) > maxEXIFBytes {
+		xmpData = xmpData[:maxEXIFBytes]
 	}
+	if !isTIFF(exifData) && len(exifData) > maxEXIFBytes {
+		exifData = exifData[:maxEXIFBytes]
+	}
+	parseXMP(meta, xmpData)
+	parseEXIF(meta, exifData)
+	return meta, nil
+}
+
+// parseXMP fills meta from an XMP packet, or from data holding one.
+func parseXMP(meta *domain.PhotoMeta, xmp []byte) {
+	meta.Rating = parseXMPRating(xmp)
+	meta.Motion = motionPhotoXMP.Match(xmp)
+	meta.Keywords = parseXMPList(xmpSubject, xmp)
+	if captions := parseXMPList(xmpDescription, xmp); len(captions) > 0 {
+		meta.Caption = captions[0]
+	}
+}
+
+// parseEXIF fills meta from a JPEG or TIFF structure holding EXIF, and
+// returns the orientation it gives, 0 if none.
+func parseEXIF(meta *domain.PhotoMeta, data []byte) (orientation int) {
 	x, err := exif.Decode(bytes.NewReader(data))
 	if err != nil {
-		return meta, nil
+		return 0
 	}
-
 	if tm, err := x.DateTime(); err == nil {
 		meta.TakenAt = &tm
 	}
@@ -35,6 +86,38 @@ func (e *EXIFExtractor) Extract(_ context.Context, data []byte) (*domain.PhotoMe
 			meta.Model = s
 		}
 	}
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		orientation, _ = tag.Int(0)
+	}
+	return orientation
+}
 
-	return meta, nil
+// parseXMPRating returns the 1-5 star rating from an embedded XMP packet, or 0
+// when the photo is unrated or rejected (-1).
+func parseXMPRating(data []byte) int {
+	m := xmpRating.FindSubmatch(data)
+	if m == nil {
+		return 0
+	}
+	rating, err := strconv.Atoi(string(m[1]))
+	if err != nil || rating < 0 || rating > 5 {
+		return 0
+	}
+	return rating
+}
+
+// parseXMPList returns the rdf:li items of the first XMP property matched by
+// re, such as the keywords of dc:subject.
+func parseXMPList(re *regexp.Regexp, data []byte) []string {
+	m := re.FindSubmatch(data)
+	if m == nil {
+		return nil
+	}
+	var items []string
+	for _, li := range rdfItem.FindAllSubmatch(m[1], -1) {
+		if item := strings.TrimSpace(html.UnescapeString(string(li[1]))); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,61 @@
+package photo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEXIFExtractor_XMPRating(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"attribute", `<rdf:Description xmp:Rating="4" xmp:Label="Red"/>`, 4},
+		{"element", `<xmp:Rating>5</xmp:Rating>`, 5},
+		{"rejected", `<rdf:Description xmp:Rating="-1"/>`, 0},
+		{"out of range", `<rdf:Description xmp:Rating="9"/>`, 0},
+		{"no xmp", "not an image", 0},
+	}
+
+	e := NewEXIFExtractor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := e.Extract(context.Background(), []byte(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if meta.Rating != tt.want {
+				t.Errorf("Rating = %d, want %d", meta.Rating, tt.want)
+			}
+		})
+	}
+}
+
+func TestEXIFExtractor_XMPKeywordsAndCaption(t *testing.T) {
+	xmp := `<rdf:Description>
+  <dc:subject><rdf:Bag><rdf:li>beach</rdf:li><rdf:li>Sunset &amp; sea</rdf:li></rdf:Bag></dc:subject>
+  <dc:description><rdf:Alt><rdf:li xml:lang="x-default">Last day in Kenting</rdf:li></rdf:Alt></dc:description>
+</rdf:Description>`
+
+	meta, err := NewEXIFExtractor().Extract(context.Background(), []byte(xmp))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(meta.Keywords) != 2 || meta.Keywords[0] != "beach" || meta.Keywords[1] != "Sunset & sea" {
+		t.Errorf("Keywords = %q", meta.Keywords)
+	}
+	if meta.Caption != "Last day in Kenting" {
+		t.Errorf("Caption = %q", meta.Caption)
+	}
+}
+
+func TestEXIFExtractor_NoEXIF(t *testing.T) {
+	meta, err := NewEXIFExtractor().Extract(context.Background(), makeJPEG(t, 8, 8))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.TakenAt != nil || meta.Model != "" {
+		t.Errorf("meta = %+v, want empty", meta)
+	}
+}
@@ -0,0 +1,57 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"image"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageFingerprinter computes the oriented dimensions and a 64-bit difference
+// hash (dHash) of an image. Visually similar images have dHashes that differ
+// in only a few bits.
+type ImageFingerprinter struct{}
+
+func NewImageFingerprinter() *ImageFingerprinter {
+	return &ImageFingerprinter{}
+}
+
+// Fingerprint hashes the first frame of animated GIFs. Animated WebPs cannot
+// be decoded, so only their loop length is reported. RAW and HEIC files are
+// hashed from their embedded preview.
+func (f *ImageFingerprinter) Fingerprint(_ context.Context, data []byte) (domain.Fingerprint, error) {
+	if preview, ok := embeddedPreview(data); ok {
+		data = preview
+	}
+	loop, animated := animation(data)
+	if animated && bytes.HasPrefix(data, []byte("RIFF")) {
+		return domain.Fingerprint{Animation: loop}, nil
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return domain.Fingerprint{}, err
+	}
+	b := img.Bounds()
+	return domain.Fingerprint{Width: b.Dx(), Height: b.Dy(), DHash: dHash(img), Animation: loop}, nil
+}
+
+// dHash shrinks img to 9x8 grey pixels and sets one bit per pixel that is
+// darker than its right neighbour.
+func dHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left < right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,79 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// gradient draws a diagonal gradient with a bright square, so it has
+// structure a dHash can pick up.
+func gradient(w, h int, invert bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*255/h) / 2)
+			if x > w/4 && x < w/2 && y > h/4 && y < h/2 {
+				v = 255
+			}
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageFingerprinter_NearDuplicates(t *testing.T) {
+	f := NewImageFingerprinter()
+	ctx := context.Background()
+	original := gradient(320, 240, false)
+
+	var resized bytes.Buffer
+	if err := jpeg.Encode(&resized, imaging.Resize(original, 160, 120, imaging.Lanczos), &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := f.Fingerprint(ctx, encodePNG(t, original))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := f.Fingerprint(ctx, resized.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, _ := f.Fingerprint(ctx, encodePNG(t, gradient(320, 240, true)))
+
+	if a.Width != 320 || a.Height != 240 || b.Width != 160 || b.Height != 120 {
+		t.Errorf("dimensions = %dx%d and %dx%d", a.Width, a.Height, b.Width, b.Height)
+	}
+	if d := bits.OnesCount64(a.DHash ^ b.DHash); d > 5 {
+		t.Errorf("resized copy differs in %d bits, want at most 5", d)
+	}
+	if d := bits.OnesCount64(a.DHash ^ c.DHash); d <= 5 {
+		t.Errorf("different image differs in only %d bits", d)
+	}
+}
+
+func TestImageFingerprinter_InvalidImage(t *testing.T) {
+	if _, err := NewImageFingerprinter().Fingerprint(context.Background(), []byte("nope")); err == nil {
+		t.Error("expected error for non-image data")
+	}
+}
@@ -0,0 +1,503 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+)
+
+// heifBrands are the ftyp brands of HEIF still images, the container of
+// HEIC photos.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+// IsHEIF reports whether data is a HEIF image, such as an iPhone's HEIC
+// photos.
+func IsHEIF(data []byte) bool {
+	boxes := readBoxes(data)
+	if len(boxes) == 0 || boxes[0].typ != "ftyp" || len(boxes[0].body) < 8 {
+		return false
+	}
+	brands := boxes[0].body
+	if heifBrands[string(brands[:4])] {
+		return true
+	}
+	// Compatible brands follow the major brand and its minor version.
+	for p := 8; p+4 <= len(brands); p += 4 {
+		if heifBrands[string(brands[p:p+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// heifPreview returns the largest JPEG a HEIF file holds, as the primary
+// image, a thumbnail or an image derived from the primary. Most HEIC photos
+// only hold HEVC images, which cannot be decoded in pure Go; ok is false for
+// them. The JPEG is turned the way the file's irot property says.
+func heifPreview(data []byte) (preview []byte, ok bool) {
+	h, ok := parseHEIF(data)
+	if !ok {
+		return nil, false
+	}
+	var best *heifItem
+	bestArea := 0
+	for _, it := range h.items {
+		if it.typ != "jpeg" && (it.typ != "mime" || it.mime != "image/jpeg") {
+			continue
+		}
+		b, ok := h.itemData(it)
+		if !ok {
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		if area := cfg.Width * cfg.Height; area > bestArea {
+			best, bestArea, preview = it, area, b
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return withOrientation(preview, h.orientation(best)), true
+}
+
+// heifThumbnail returns a HEIF file holding only the thumbnail of data's
+// primary image, which small renditions of HEVC-only photos are sent instead
+// of the full file. It is still HEVC: a smaller download for clients that
+// can show HEIC, not a way to show it elsewhere. ok is false when there is
+// no HEVC thumbnail.
+func heifThumbnail(data []byte) ([]byte, bool) {
+	h, ok := parseHEIF(data)
+	if !ok || h.primary == 0 {
+		return nil, false
+	}
+	for _, it := range h.items {
+		if it.thumbOf != h.primary || it.typ != "hvc1" {
+			continue
+		}
+		b, ok := h.itemData(it)
+		if !ok {
+			continue
+		}
+		var props [][]byte
+		for _, p := range it.props {
+			if p >= 1 && p <= len(h.props) {
+				props = append(props, encodeBox(h.props[p-1].typ, h.props[p-1].body))
+			}
+		}
+		return buildHEIF(it.typ, props, b), true
+	}
+	return nil, false
+}
+
+// buildHEIF writes a HEIF file whose only item, the primary image, is of
+// type typ with the given properties and data.
+func buildHEIF(typ string, props [][]byte, data []byte) []byte {
+	ftyp := encodeBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	ipma := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 1, byte(len(props))}
+	for i, p := range props {
+		// The codec configuration and transformations are essential;
+		// descriptions such as the image size are not.
+		assoc := byte(i + 1)
+		switch string(p[4:8]) {
+		case "hvcC", "irot", "imir", "clap":
+			assoc |= 0x80
+		}
+		ipma = append(ipma, assoc)
+	}
+	meta := func(off uint32) []byte {
+		iloc := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 0, 0, 1}
+		iloc = binary.BigEndian.AppendUint32(iloc, off)
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(data)))
+		infe := append([]byte{2, 0, 0, 0, 0, 1, 0, 0}, typ...)
+		return encodeBox("meta", []byte{0, 0, 0, 0},
+			encodeBox("hdlr", make([]byte, 8), []byte("pict"), make([]byte, 13)),
+			encodeBox("pitm", []byte{0, 0, 0, 0, 0, 1}),
+			encodeBox("iinf", []byte{0, 0, 0, 0, 0, 1}, encodeBox("infe", infe, []byte{0})),
+			encodeBox("iloc", iloc),
+			encodeBox("iprp", encodeBox("ipco", props...), encodeBox("ipma", ipma)),
+		)
+	}
+	off := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(uint32(off)), encodeBox("mdat", data)}, nil)
+}
+
+// encodeBox writes a box of the given type holding body.
+func encodeBox(typ string, body ...[]byte) []byte {
+	n := 8
+	for _, b := range body {
+		n += len(b)
+	}
+	out := binary.BigEndian.AppendUint32(make([]byte, 0, n), uint32(n))
+	out = append(out, typ...)
+	for _, b := range body {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// heifExif returns the TIFF structure of the Exif item of a HEIF file.
+func heifExif(data []byte) ([]byte, bool) {
+	h, ok := parseHEIF(data)
+	if !ok {
+		return nil, false
+	}
+	for _, it := range h.items {
+		if it.typ != "Exif" {
+			continue
+		}
+		b, ok := h.itemData(it)
+		// The payload starts with the offset of the TIFF header past the
+		// 4-byte offset itself, which skips the "Exif\0\0" prefix.
+		if !ok || len(b) < 4 {
+			continue
+		}
+		off := uint64(binary.BigEndian.Uint32(b)) + 4
+		if off < uint64(len(b)) && isTIFF(b[off:]) {
+			return b[off:], true
+		}
+	}
+	return nil, false
+}
+
+// heifXMP returns the XMP packet of a HEIF file, stored as an item of MIME
+// type application/rdf+xml.
+func heifXMP(data []byte) ([]byte, bool) {
+	h, ok := parseHEIF(data)
+	if !ok {
+		return nil, false
+	}
+	for _, it := range h.items {
+		if it.typ == "mime" && it.mime == "application/rdf+xml" {
+			return h.itemData(it)
+		}
+	}
+	return nil, false
+}
+
+// isoBox is an ISO base media file format box.
+type isoBox struct {
+	typ  string
+	body []byte
+}
+
+// readBoxes splits data into the boxes it holds, stopping at the first one
+// that does not fit.
+func readBoxes(data []byte) []isoBox {
+	var out []isoBox
+	for len(data) >= 8 {
+		size, hdr := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 1:
+			if len(data) < 16 {
+				return out
+			}
+			size, hdr = binary.BigEndian.Uint64(data[8:]), 16
+		case 0:
+			size = uint64(len(data))
+		}
+		if size < hdr || size > uint64(len(data)) {
+			return out
+		}
+		out = append(out, isoBox{string(data[4:8]), data[hdr:size]})
+		data = data[size:]
+	}
+	return out
+}
+
+// fields reads the big-endian fields of a box, remembering whether any ran
+// past its end.
+type fields struct {
+	b   []byte
+	bad bool
+}
+
+func (f *fields) uint(n int) uint64 {
+	if len(f.b) < n {
+		f.bad = true
+		f.b = nil
+		return 0
+	}
+	var v uint64
+	for _, c := range f.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	f.b = f.b[n:]
+	return v
+}
+
+// str reads a NUL-terminated string.
+func (f *fields) str() string {
+	i := bytes.IndexByte(f.b, 0)
+	if i < 0 {
+		f.bad = true
+		f.b = nil
+		return ""
+	}
+	s := string(f.b[:i])
+	f.b = f.b[i+1:]
+	return s
+}
+
+type extent struct{ off, n uint64 }
+
+type heifItem struct {
+	id   uint32
+	typ  string
+	mime string
+	// method is 0 for extents in the file and 1 for extents in idat.
+	method  int
+	extents []extent
+	// props are the 1-based indexes of the item's properties in ipco.
+	props []int
+	// thumbOf is the item this one is a thumbnail of, or 0.
+	thumbOf uint32
+}
+
+// heif is the item structure of a HEIF file's meta box.
+type heif struct {
+	data    []byte
+	idat    []byte
+	items   []*heifItem
+	props   []isoBox
+	primary uint32
+}
+
+func parseHEIF(data []byte) (*heif, bool) {
+	if !IsHEIF(data) {
+		return nil, false
+	}
+	var meta []byte
+	for _, b := range readBoxes(data) {
+		if b.typ == "meta" && len(b.body) >= 4 {
+			meta = b.body[4:] // skip version and flags
+		}
+	}
+	if meta == nil {
+		return nil, false
+	}
+	h := &heif{data: data}
+	byID := make(map[uint32]*heifItem)
+	item := func(id uint32) *heifItem {
+		if byID[id] == nil {
+			byID[id] = &heifItem{id: id}
+			h.items = append(h.items, byID[id])
+		}
+		return byID[id]
+	}
+	for _, b := range readBoxes(meta) {
+		switch b.typ {
+		case "iinf":
+			f := &fields{b: b.body}
+			idSize := 2
+			if f.uint(1) > 0 {
+				idSize = 4
+			}
+			f.uint(3)
+			f.uint(idSize) // entry count
+			if f.bad {
+				continue
+			}
+			for _, e := range readBoxes(f.b) {
+				if e.typ == "infe" {
+					parseInfe(e.body, item)
+				}
+			}
+		case "pitm":
+			f := &fields{b: b.body}
+			idSize := 2
+			if f.uint(1) > 0 {
+				idSize = 4
+			}
+			f.uint(3)
+			if id := uint32(f.uint(idSize)); !f.bad {
+				h.primary = id
+			}
+		case "iref":
+			parseIref(b.body, item)
+		case "iloc":
+			parseIloc(b.body, item)
+		case "iprp":
+			for _, p := range readBoxes(b.body) {
+				switch p.typ {
+				case "ipco":
+					h.props = readBoxes(p.body)
+				case "ipma":
+					parseIpma(p.body, item)
+				}
+			}
+		case "idat":
+			h.idat = b.body
+		}
+	}
+	return h, true
+}
+
+// parseInfe reads an item info entry of version 2 or 3, the versions HEIF
+// requires.
+func parseInfe(body []byte, item func(uint32) *heifItem) {
+	f := &fields{b: body}
+	version := f.uint(1)
+	f.uint(3)
+	if version < 2 {
+		return
+	}
+	idSize := 2
+	if version > 2 {
+		idSize = 4
+	}
+	id := uint32(f.uint(idSize))
+	f.uint(2) // protection index
+	typ := string(f.b[:min(4, len(f.b))])
+	f.uint(4)
+	f.str() // name
+	if f.bad {
+		return
+	}
+	it := item(id)
+	it.typ = typ
+	if typ == "mime" {
+		it.mime = f.str()
+	}
+}
+
+// parseIref reads which items are thumbnails of which; other references
+// are skipped.
+func parseIref(body []byte, item func(uint32) *heifItem) {
+	f := &fields{b: body}
+	idSize := 2
+	if f.uint(1) > 0 {
+		idSize = 4
+	}
+	f.uint(3)
+	if f.bad {
+		return
+	}
+	for _, ref := range readBoxes(f.b) {
+		if ref.typ != "thmb" {
+			continue
+		}
+		r := &fields{b: ref.body}
+		from := uint32(r.uint(idSize))
+		to := uint32(r.uint(2)) // reference count
+		if to > 0 {
+			to = uint32(r.uint(idSize))
+		}
+		if !r.bad {
+			item(from).thumbOf = to
+		}
+	}
+}
+
+// parseIloc reads where the data of each item lies.
+func parseIloc(body []byte, item func(uint32) *heifItem) {
+	f := &fields{b: body}
+	version := f.uint(1)
+	f.uint(3)
+	sizes := f.uint(2)
+	offSize, lenSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseSize, indexSize := int(sizes>>4&0xf), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := f.uint(idSize)
+	for range count {
+		it := item(uint32(f.uint(idSize)))
+		if version == 1 || version == 2 {
+			it.method = int(f.uint(2) & 0xf)
+		}
+		f.uint(2) // data reference index
+		base := f.uint(baseSize)
+		extents := f.uint(2)
+		for range extents {
+			f.uint(indexSize)
+			off, n := f.uint(offSize), f.uint(lenSize)
+			it.extents = append(it.extents, extent{base + off, n})
+		}
+		if f.bad {
+			return
+		}
+	}
+}
+
+// parseIpma reads which properties belong to each item.
+func parseIpma(body []byte, item func(uint32) *heifItem) {
+	f := &fields{b: body}
+	version := f.uint(1)
+	flags := f.uint(3)
+	idSize := 2
+	if version > 0 {
+		idSize = 4
+	}
+	count := f.uint(4)
+	for range count {
+		it := item(uint32(f.uint(idSize)))
+		n := f.uint(1)
+		for range n {
+			// The top bit marks essential properties.
+			if flags&1 != 0 {
+				it.props = append(it.props, int(f.uint(2)&0x7fff))
+			} else {
+				it.props = append(it.props, int(f.uint(1)&0x7f))
+			}
+		}
+		if f.bad {
+			return
+		}
+	}
+}
+
+// itemData joins the extents of an item. An extent of length 0 runs to the
+// end of the data it lies in.
+func (h *heif) itemData(it *heifItem) ([]byte, bool) {
+	src := h.data
+	switch it.method {
+	case 0:
+	case 1:
+		src = h.idat
+	default:
+		return nil, false
+	}
+	var out []byte
+	for _, e := range it.extents {
+		n := e.n
+		if n == 0 && e.off <= uint64(len(src)) {
+			n = uint64(len(src)) - e.off
+		}
+		if n == 0 || e.off+n > uint64(len(src)) || e.off+n < e.off {
+			return nil, false
+		}
+		if len(it.extents) == 1 {
+			return src[e.off : e.off+n], true
+		}
+		out = append(out, src[e.off:e.off+n]...)
+	}
+	return out, len(out) > 0
+}
+
+// orientation turns the irot property of an item, an anticlockwise rotation
+// in quarter turns, into an EXIF orientation.
+func (h *heif) orientation(it *heifItem) int {
+	for _, p := range it.props {
+		if p < 1 || p > len(h.props) || h.props[p-1].typ != "irot" || len(h.props[p-1].body) < 1 {
+			continue
+		}
+		switch h.props[p-1].body[0] & 3 {
+		case 1:
+			return 8
+		case 2:
+			return 3
+		case 3:
+			return 6
+		}
+	}
+	return 1
+}
@@ -0,0 +1,225 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fullBox encodes a box that starts with a version and flags.
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	vf := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags)
+	return box(typ, append([][]byte{vf}, payload...)...)
+}
+
+func infe(id uint16, typ, mime string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = append(body, 0, 0)
+	body = append(body, typ...)
+	body = append(body, 0) // empty name
+	if mime != "" {
+		body = append(append(body, mime...), 0)
+	}
+	return fullBox("infe", 2, 0, body)
+}
+
+// heifItemSpec is an item of makeHEIF: its type, MIME type and data, which
+// is stored in idat rather than mdat when inIdat is set. thumbOf makes it a
+// thumbnail of that item.
+type heifItemSpec struct {
+	typ, mime string
+	data      []byte
+	inIdat    bool
+	thumbOf   uint16
+}
+
+// makeHEIF builds a HEIC file holding items numbered from 1, with item 1 as
+// the primary image. rotation is the irot of item 2, in quarter turns.
+func makeHEIF(items []heifItemSpec, rotation byte) []byte {
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	build := func(mdatStart uint32) ([]byte, []byte) {
+		var infes, locs, mdat, idat, refs []byte
+		locs = binary.BigEndian.AppendUint16(nil, 0x4400) // 4-byte offsets and lengths
+		locs = binary.BigEndian.AppendUint16(locs, uint16(len(items)))
+		for i, it := range items {
+			id := uint16(i + 1)
+			infes = append(infes, infe(id, it.typ, it.mime)...)
+			method, off := uint16(0), mdatStart+uint32(len(mdat))
+			if it.inIdat {
+				method, off = 1, uint32(len(idat))
+				idat = append(idat, it.data...)
+			} else {
+				mdat = append(mdat, it.data...)
+			}
+			if it.thumbOf != 0 {
+				ref := binary.BigEndian.AppendUint16(nil, id)
+				ref = binary.BigEndian.AppendUint16(ref, 1)
+				refs = append(refs, box("thmb", binary.BigEndian.AppendUint16(ref, it.thumbOf))...)
+			}
+			locs = binary.BigEndian.AppendUint16(locs, id)
+			locs = binary.BigEndian.AppendUint16(locs, method)
+			locs = append(locs, 0, 0, 0, 1) // data reference, one extent
+			locs = binary.BigEndian.AppendUint32(locs, off)
+			locs = binary.BigEndian.AppendUint32(locs, uint32(len(it.data)))
+		}
+		ipma := binary.BigEndian.AppendUint32(nil, 1)
+		ipma = append(ipma, 0, 2, 1, 0x81) // item 2: essential property 1
+		meta := fullBox("meta", 0, 0,
+			fullBox("hdlr", 0, 0, []byte("\x00\x00\x00\x00pict\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")),
+			fullBox("pitm", 0, 0, []byte{0, 1}),
+			fullBox("iinf", 0, 0, binary.BigEndian.AppendUint16(nil, uint16(len(items))), infes),
+			fullBox("iloc", 1, 0, locs),
+			fullBox("iref", 0, 0, refs),
+			box("iprp", box("ipco", box("irot", []byte{rotation})), fullBox("ipma", 0, 0, ipma)),
+			box("idat", idat),
+		)
+		return meta, box("mdat", mdat)
+	}
+	meta, _ := build(0)
+	meta, mdat := build(uint32(len(ftyp) + len(meta) + 8))
+	return bytes.Join([][]byte{ftyp, meta, mdat}, nil)
+}
+
+// hevc stands in for HEVC image data, which is never decoded.
+var hevc = []byte("\x00\x00\x00\x01\x26\x01 not really HEVC")
+
+// exifItem wraps a TIFF structure the way HEIF Exif items store it.
+func exifItem(tiff []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, 6), append([]byte("Exif\x00\x00"), tiff...)...)
+}
+
+func TestIsHEIF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"heic", makeHEIF([]heifItemSpec{{typ: "hvc1", data: hevc}}, 0), true},
+		{"mif1 major brand", box("ftyp", []byte("mif1\x00\x00\x00\x00")), true},
+		{"mp4", box("ftyp", []byte("isom\x00\x00\x02\x00isomavc1")), false},
+		{"jpeg", makeJPEG(t, 8, 8), false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsHEIF(tt.data); got != tt.want {
+			t.Errorf("%s: IsHEIF() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHEIFPreview_UsesEmbeddedJPEG(t *testing.T) {
+	data := makeHEIF([]heifItemSpec{
+		{typ: "hvc1", data: hevc},
+		{typ: "jpeg", data: makeJPEG(t, 320, 240)},
+		{typ: "mime", mime: "image/jpeg", data: makeJPEG(t, 160, 120)},
+	}, 1)
+	preview, ok := heifPreview(data)
+	if !ok {
+		t.Fatal("no preview found")
+	}
+	if w, h := jpegSize(t, preview); w != 320 || h != 240 {
+		t.Errorf("preview = %dx%d, want 320x240", w, h)
+	}
+	// A quarter turn anticlockwise stands the image up.
+	fp, err := NewImageFingerprinter().Fingerprint(context.Background(), data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fp.Width != 240 || fp.Height != 320 {
+		t.Errorf("fingerprint = %dx%d, want 240x320", fp.Width, fp.Height)
+	}
+	out, err := NewImageCompressor().Compress(context.Background(), data, Rendition{Width: 160, Height: 160, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, h := jpegSize(t, out); w != 120 || h != 160 {
+		t.Errorf("rendition = %dx%d, want 120x160", w, h)
+	}
+}
+
+func TestHEIFPreview_HEVCOnly(t *testing.T) {
+	data := makeHEIF([]heifItemSpec{{typ: "hvc1", data: hevc}, {typ: "hvc1", data: hevc}}, 0)
+	if _, ok := heifPreview(data); ok {
+		t.Error("found a preview in a file without JPEGs")
+	}
+	out, err := NewImageCompressor().Compress(context.Background(), data, Rendition{Width: 160, Height: 160, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("undecodable HEIC was not sent as it is")
+	}
+	if _, err := NewImageFingerprinter().Fingerprint(context.Background(), data); err == nil {
+		t.Error("expected an error fingerprinting an undecodable HEIC")
+	}
+}
+
+func TestHEIFThumbnail(t *testing.T) {
+	thumb := []byte("\x00\x00\x00\x01\x26\x01 small HEVC")
+	data := makeHEIF([]heifItemSpec{{typ: "hvc1", data: hevc}, {typ: "hvc1", data: thumb, thumbOf: 1}}, 1)
+	c := NewImageCompressor()
+
+	out, err := c.Compress(context.Background(), data, Rendition{Width: 256, Height: 256, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h, ok := parseHEIF(out)
+	if !ok || len(h.items) != 1 {
+		t.Fatalf("thumbnail is not a HEIF of one item")
+	}
+	it := h.items[0]
+	if got, ok := h.itemData(it); !ok || !bytes.Equal(got, thumb) || it.id != h.primary || it.typ != "hvc1" {
+		t.Errorf("primary item = %s %q, want the hvc1 thumbnail", it.typ, got)
+	}
+	// The thumbnail keeps its properties, such as the rotation.
+	if got := h.orientation(it); got != 8 {
+		t.Errorf("orientation = %d, want 8", got)
+	}
+
+	out, err = c.Compress(context.Background(), data, Rendition{Width: 1280, Height: 1280, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("large rendition was not the file as it is")
+	}
+}
+
+func TestHEIFPreview_Malformed(t *testing.T) {
+	good := makeHEIF([]heifItemSpec{{typ: "hvc1", data: hevc}, {typ: "jpeg", data: makeJPEG(t, 8, 8)}}, 0)
+	for n := 0; n < len(good)-1; n += 7 {
+		// Truncated files must not panic; they may still hold the JPEG.
+		heifPreview(good[:n])
+		heifExif(good[:n])
+		heifThumbnail(good[:n])
+	}
+}
+
+func TestEXIFExtractor_HEIF(t *testing.T) {
+	tiff := tiffFile(binary.BigEndian, 1, [][]ifdEntry{{
+		{tag: 0x0110, text: "iPhone 15"},
+		{tag: 0x0132, text: "2024:07:14 18:05:00"},
+	}})
+	xmp := []byte(`<x:xmpmeta><rdf:Description xmp:Rating="4"/></x:xmpmeta>`)
+	data := makeHEIF([]heifItemSpec{
+		{typ: "hvc1", data: hevc},
+		{typ: "Exif", data: exifItem(tiff), inIdat: true},
+		{typ: "mime", mime: "application/rdf+xml", data: xmp},
+	}, 0)
+	meta, err := NewEXIFExtractor().Extract(context.Background(), data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Model != "iPhone 15" {
+		t.Errorf("Model = %q, want %q", meta.Model, "iPhone 15")
+	}
+	want := time.Date(2024, 7, 14, 18, 5, 0, 0, time.Local)
+	if meta.TakenAt == nil || !meta.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want %v", meta.TakenAt, want)
+	}
+	if meta.Rating != 4 {
+		t.Errorf("Rating = %d, want 4", meta.Rating)
+	}
+}
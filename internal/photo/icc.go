@@ -0,0 +1,428 @@
+package photo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// iccMarker starts the payload of the JPEG APP2 segments that carry an ICC
+// profile, followed by the segment's sequence number and the segment count.
+var iccMarker = []byte("ICC_PROFILE\x00")
+
+// maxICCChunk is the most profile data one APP2 segment holds.
+const maxICCChunk = 65519
+
+// iccProfile returns the ICC profile embedded in a JPEG (APP2), PNG (iCCP)
+// or WebP (ICCP), or nil if there is none.
+func iccProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return jpegICC(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return pngICC(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return webpICC(data)
+	}
+	return nil
+}
+
+// jpegICC joins the profile chunks of a JPEG's APP2 segments in sequence.
+func jpegICC(data []byte) []byte {
+	chunks := make(map[byte][]byte)
+	for p := 2; p+4 <= len(data) && data[p] == 0xff; {
+		marker := data[p+1]
+		if marker == 0xda { // start of scan
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if p+2+n > len(data) || n < 2 {
+			break
+		}
+		seg := data[p+4 : p+2+n]
+		if marker == 0xe2 && bytes.HasPrefix(seg, iccMarker) && len(seg) > len(iccMarker)+2 {
+			chunks[seg[len(iccMarker)]] = seg[len(iccMarker)+2:]
+		}
+		p += 2 + n
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, int(seq))
+	}
+	sort.Ints(seqs)
+	var profile []byte
+	for _, seq := range seqs {
+		profile = append(profile, chunks[byte(seq)]...)
+	}
+	return profile
+}
+
+// pngICC inflates the profile of a PNG's iCCP chunk, which holds a name, a
+// compression method and the zlib-compressed profile.
+func pngICC(data []byte) []byte {
+	for p := 8; p+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		typ := string(data[p+4 : p+8])
+		if n < 0 || p+12+n > len(data) || typ == "IDAT" {
+			return nil
+		}
+		if typ == "iCCP" {
+			body := data[p+8 : p+8+n]
+			i := bytes.IndexByte(body, 0)
+			if i < 0 || i+2 > len(body) {
+				return nil
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(body[i+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := io.ReadAll(io.LimitReader(zr, 4<<20))
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		p += 12 + n
+	}
+	return nil
+}
+
+// webpICC returns the payload of a WebP's ICCP chunk.
+func webpICC(data []byte) []byte {
+	for p := 12; p+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		if size < 0 || p+8+size > len(data) {
+			return nil
+		}
+		if string(data[p:p+4]) == "ICCP" {
+			return data[p+8 : p+8+size]
+		}
+		p += 8 + size + size&1
+	}
+	return nil
+}
+
+// srgbD50 holds the colorants of sRGB adapted to the D50 white of the ICC
+// profile connection space, as in the sRGB profiles cameras and phones embed.
+var srgbD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// colorTransform maps pixels of a matrix/TRC profile to sRGB: each channel
+// through its tone curve to linear light, then through a matrix to linear
+// sRGB.
+type colorTransform struct {
+	trc [3][256]float64
+	m   [3][3]float64
+}
+
+// newColorTransform reads an RGB matrix/TRC profile. ok is false for other
+// profiles, such as LUT-based, grey or CMYK ones.
+func newColorTransform(profile []byte) (t *colorTransform, ok bool) {
+	if len(profile) < 132 || string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil, false
+	}
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(profile); i++ {
+		e := profile[132+i*12:]
+		off, n := binary.BigEndian.Uint32(e[4:]), binary.BigEndian.Uint32(e[8:])
+		if body, ok := slice(profile, off, n); ok {
+			tags[string(e[:4])] = body
+		}
+	}
+
+	var colorants [3][3]float64
+	for col, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz := tags[sig]
+		if len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil, false
+		}
+		for row := range 3 {
+			colorants[row][col] = s15Fixed16(xyz[8+row*4:])
+		}
+	}
+	toSRGB, ok := invert(srgbD50)
+	if !ok {
+		return nil, false
+	}
+	t = &colorTransform{m: multiply(toSRGB, colorants)}
+	for ch, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, ok := toneCurve(tags[sig])
+		if !ok {
+			return nil, false
+		}
+		for v := range 256 {
+			t.trc[ch][v] = curve(float64(v) / 255)
+		}
+	}
+	return t, true
+}
+
+// isSRGB reports whether t leaves sRGB pixels as they are, within what 8-bit
+// output can show.
+func (t *colorTransform) isSRGB() bool {
+	for i := range 3 {
+		for j := range 3 {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(t.m[i][j]-want) > 0.002 {
+				return false
+			}
+		}
+	}
+	for ch := range 3 {
+		for v := 0; v < 256; v += 15 {
+			if math.Abs(t.trc[ch][v]-srgbToLinear(float64(v)/255)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply converts img to sRGB in place.
+func (t *colorTransform) apply(img *image.NRGBA) {
+	var out [4096]uint8
+	for i := range out {
+		out[i] = uint8(math.Round(linearToSRGB(float64(i)/4095) * 255))
+	}
+	encode := func(v float64) uint8 {
+		return out[int(math.Round(min(max(v, 0), 1)*4095))]
+	}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			r, g, b := t.trc[0][row[x]], t.trc[1][row[x+1]], t.trc[2][row[x+2]]
+			row[x] = encode(t.m[0][0]*r + t.m[0][1]*g + t.m[0][2]*b)
+			row[x+1] = encode(t.m[1][0]*r + t.m[1][1]*g + t.m[1][2]*b)
+			row[x+2] = encode(t.m[2][0]*r + t.m[2][1]*g + t.m[2][2]*b)
+		}
+	}
+}
+
+// manageColor brings img, resized from a photo carrying profile, to sRGB.
+// Photos with a matrix/TRC profile are converted. Those with another RGB
+// profile keep their colors, and the profile is returned to be embedded in
+// the output; nil means the output needs none.
+func manageColor(img image.Image, profile []byte) (image.Image, []byte) {
+	if len(profile) == 0 {
+		return img, nil
+	}
+	t, ok := newColorTransform(profile)
+	if !ok {
+		if len(profile) >= 20 && string(profile[16:20]) == "RGB " {
+			return img, profile
+		}
+		return img, nil
+	}
+	if t.isSRGB() {
+		return img, nil
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = imaging.Clone(img)
+	}
+	t.apply(nrgba)
+	return nrgba, nil
+}
+
+// toneCurve reads an ICC curv or para tag as a function from encoded to
+// linear values.
+func toneCurve(tag []byte) (func(float64) float64, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, true
+		case n == 1 && len(tag) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		case n > 1 && len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := min(int(pos), n-2)
+				return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+			}, true
+		}
+	case "para":
+		// Parametric curves have 1, 3, 4, 5 or 7 parameters by type.
+		counts := []int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(tag[8:]))
+		if kind >= len(counts) || len(tag) < 12+4*counts[kind] {
+			return nil, false
+		}
+		var p [7]float64
+		for i := range counts[kind] {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		pow := func(v float64) float64 { return math.Pow(max(v, 0), g) }
+		switch kind {
+		case 0:
+			return pow, true
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(a*x + b)
+				}
+				return 0
+			}, true
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(a*x+b) + c
+				}
+				return c
+			}, true
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x + b)
+				}
+				return c * x
+			}, true
+		case 4:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x+b) + e
+				}
+				return c*x + f
+			}, true
+		}
+	}
+	return nil, false
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var out [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				out[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func invert(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return [3][3]float64{}, false
+	}
+	var out [3][3]float64
+	for i := range 3 {
+		for j := range 3 {
+			// The inverse is the transposed cofactor matrix over the
+			// determinant.
+			r1, r2 := (j+1)%3, (j+2)%3
+			c1, c2 := (i+1)%3, (i+2)%3
+			out[i][j] = (m[r1][c1]*m[r2][c2] - m[r1][c2]*m[r2][c1]) / det
+		}
+	}
+	return out, true
+}
+
+// withICC embeds profile in an encoded JPEG, PNG or WebP.
+func withICC(data, profile []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		count := (len(profile) + maxICCChunk - 1) / maxICCChunk
+		out := append([]byte(nil), data[:2]...)
+		for i := range count {
+			chunk := profile[i*maxICCChunk : min((i+1)*maxICCChunk, len(profile))]
+			n := 2 + len(iccMarker) + 2 + len(chunk)
+			out = append(out, 0xff, 0xe2, byte(n>>8), byte(n))
+			out = append(out, iccMarker...)
+			out = append(out, byte(i+1), byte(count))
+			out = append(out, chunk...)
+		}
+		return append(out, data[2:]...)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) && len(data) >= 33:
+		// iCCP must come before the image data; right after IHDR will do.
+		var body bytes.Buffer
+		body.WriteString("iCCPICC Profile\x00\x00")
+		zw := zlib.NewWriter(&body)
+		zw.Write(profile)
+		zw.Close()
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(body.Len()-4))
+		chunk = append(chunk, body.Bytes()...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body.Bytes()))
+		return bytes.Join([][]byte{data[:33], chunk, data[33:]}, nil)
+	case len(data) >= 30 && string(data[:4]) == "RIFF" && (string(data[12:16]) == "VP8L" || string(data[12:16]) == "VP8 "):
+		// A simple WebP becomes an extended one, whose VP8X header announces
+		// the profile.
+		var w, h uint32
+		flags := byte(0x20)
+		if data[15] == 'L' {
+			bits := binary.LittleEndian.Uint32(data[21:])
+			w, h = bits&0x3fff, bits>>14&0x3fff
+			if bits>>28&1 == 1 {
+				flags |= 0x10 // alpha
+			}
+		} else {
+			// A lossy frame holds its size, not its size less one.
+			w = uint32(binary.LittleEndian.Uint16(data[26:])&0x3fff) - 1
+			h = uint32(binary.LittleEndian.Uint16(data[28:])&0x3fff) - 1
+		}
+		vp8x := []byte{flags, 0, 0, 0, byte(w), byte(w >> 8), byte(w >> 16), byte(h), byte(h >> 8), byte(h >> 16)}
+		body := append([]byte("WEBP"), riffChunk("VP8X", vp8x)...)
+		body = append(body, riffChunk("ICCP", profile)...)
+		body = append(body, data[12:]...)
+		return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+	}
+	return data
+}
+
+// riffChunk encodes a WebP RIFF chunk, padded to an even size.
+func riffChunk(id string, payload []byte) []byte {
+	out := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// iccTag is a tag of makeICC: its signature and encoded body.
+type iccTag struct {
+	sig  string
+	body []byte
+}
+
+// makeICC builds a version 2 display profile in the given color space.
+func makeICC(space string, tags ...iccTag) []byte {
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntr")
+	copy(header[16:], space)
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var bodies []byte
+	for _, tag := range tags {
+		off := 128 + 4 + 12*len(tags) + len(bodies)
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(off))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.body)))
+		bodies = append(bodies, tag.body...)
+		for len(bodies)%4 != 0 {
+			bodies = append(bodies, 0)
+		}
+	}
+	profile := bytes.Join([][]byte{header, table, bodies}, nil)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func fixed(v float64) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+}
+
+// matrixProfile builds an RGB profile from the D50 XYZ of its red, green and
+// blue primaries and one tone curve for all three channels.
+func matrixProfile(primaries [3][3]float64, trc []byte) []byte {
+	var tags []iccTag
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		body := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range primaries[i] {
+			body = append(body, fixed(v)...)
+		}
+		tags = append(tags, iccTag{sig, body})
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, iccTag{sig, trc})
+	}
+	return makeICC("RGB ", tags...)
+}
+
+// srgbCurve is the sRGB tone curve as a parametric curve of type 3.
+var srgbCurve = bytes.Join([][]byte{
+	[]byte("para\x00\x00\x00\x00\x00\x03\x00\x00"),
+	fixed(2.4), fixed(1 / 1.055), fixed(0.055 / 1.055), fixed(1 / 12.92), fixed(0.04045),
+}, nil)
+
+// Profiles as Apple and Adobe ship them.
+var (
+	displayP3 = matrixProfile([3][3]float64{
+		{0.515121, 0.241196, -0.001053},
+		{0.291977, 0.692245, 0.041885},
+		{0.157104, 0.066574, 0.784073},
+	}, srgbCurve)
+	adobeRGB = matrixProfile([3][3]float64{
+		{0.609741, 0.311111, 0.019470},
+		{0.205276, 0.625671, 0.060867},
+		{0.149185, 0.063217, 0.744568},
+	}, []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33\x00\x00")) // gamma 563/256
+	srgb = matrixProfile([3][3]float64{
+		{0.436075, 0.222504, 0.013932},
+		{0.385065, 0.716879, 0.097105},
+		{0.143080, 0.060617, 0.714173},
+	}, srgbCurve)
+	// lutProfile describes its colors with a lookup table only.
+	lutProfile  = makeICC("RGB ", iccTag{"A2B0", []byte("mft2\x00\x00\x00\x00 table")})
+	cmykProfile = makeICC("CMYK", iccTag{"A2B0", []byte("mft2\x00\x00\x00\x00 table")})
+)
+
+// solidJPEG encodes a JPEG of one color, carrying profile if it is set.
+func solidJPEG(t *testing.T, c color.NRGBA, profile []byte) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if profile == nil {
+		return buf.Bytes()
+	}
+	return withICC(buf.Bytes(), profile)
+}
+
+func TestICCProfile_Containers(t *testing.T) {
+	// A profile too large for one APP2 segment.
+	large := makeICC("RGB ", iccTag{"A2B0", bytes.Repeat([]byte("mft2"), 40000)})
+	img := makeScreenshot(40, 30)
+	var pngBuf, webpBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := nativewebp.Encode(&webpBuf, img, nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	lossy, err := encodeLossyWebP(img)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		profile []byte
+		format  string
+	}{
+		{"jpeg", makeJPEG(t, 40, 30), displayP3, "jpeg"},
+		{"jpeg in segments", makeJPEG(t, 40, 30), large, "jpeg"},
+		{"png", pngBuf.Bytes(), adobeRGB, "png"},
+		{"webp", webpBuf.Bytes(), displayP3, "webp"},
+		{"lossy webp", lossy, displayP3, "webp"},
+	}
+	for _, tt := range tests {
+		if iccProfile(tt.data) != nil {
+			t.Errorf("%s: found a profile before embedding one", tt.name)
+		}
+		data := withICC(tt.data, tt.profile)
+		if got := iccProfile(data); !bytes.Equal(got, tt.profile) {
+			t.Errorf("%s: read a %d-byte profile, want %d bytes", tt.name, len(got), len(tt.profile))
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != tt.format || cfg.Width != 40 || cfg.Height != 30 {
+			t.Errorf("%s: decoded as %s %dx%d (%v)", tt.name, format, cfg.Width, cfg.Height, err)
+		}
+	}
+}
+
+func TestImageCompressor_ConvertsToSRGB(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile []byte
+		in      color.NRGBA
+		want    color.NRGBA
+	}{
+		// The sRGB primaries as Display P3 and AdobeRGB write them.
+		{"display p3 red", displayP3, color.NRGBA{234, 51, 35, 255}, color.NRGBA{255, 0, 0, 255}},
+		{"adobe rgb green", adobeRGB, color.NRGBA{144, 255, 60, 255}, color.NRGBA{0, 255, 0, 255}},
+		{"adobe rgb grey", adobeRGB, color.NRGBA{128, 128, 128, 255}, color.NRGBA{128, 128, 128, 255}},
+		{"srgb", srgb, color.NRGBA{30, 60, 90, 255}, color.NRGBA{30, 60, 90, 255}},
+		{"no profile", nil, color.NRGBA{234, 51, 35, 255}, color.NRGBA{234, 51, 35, 255}},
+	}
+	r := Rendition{Width: 32, Height: 32, Mode: ModeFit}
+	for _, tt := range tests {
+		out, err := NewImageCompressor().Compress(context.Background(), solidJPEG(t, tt.in, tt.profile), r)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if iccProfile(out) != nil {
+			t.Errorf("%s: output carries a profile", tt.name)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		got := color.NRGBAModel.Convert(img.At(16, 16)).(color.NRGBA)
+		for i, pair := range [][2]uint8{{got.R, tt.want.R}, {got.G, tt.want.G}, {got.B, tt.want.B}} {
+			if d := int(pair[0]) - int(pair[1]); d < -4 || d > 4 {
+				t.Errorf("%s: channel %d = %d, want %d", tt.name, i, pair[0], pair[1])
+			}
+		}
+	}
+}
+
+func TestImageCompressor_KeepsOtherProfiles(t *testing.T) {
+	r := Rendition{Width: 32, Height: 32, Mode: ModeFit}
+	out, err := NewImageCompressor().Compress(context.Background(), solidJPEG(t, color.NRGBA{30, 60, 90, 255}, lutProfile), r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := iccProfile(out); !bytes.Equal(got, lutProfile) {
+		t.Error("output does not carry the original profile")
+	}
+	// A CMYK profile does not describe the RGB output.
+	out, err = NewImageCompressor().Compress(context.Background(), solidJPEG(t, color.NRGBA{30, 60, 90, 255}, cmykProfile), r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if iccProfile(out) != nil {
+		t.Error("output carries a CMYK profile")
+	}
+}
+
+func TestNewColorTransform_Malformed(t *testing.T) {
+	for n := 0; n < len(displayP3); n++ {
+		// Truncated profiles must not panic.
+		newColorTransform(displayP3[:n])
+	}
+}
@@ -0,0 +1,61 @@
+package photo
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// motionPhotoXMP matches the XMP of Google motion photos: the GCamera flags
+// of older phones, or a container item with the MotionPhoto semantic.
+var motionPhotoXMP = regexp.MustCompile(`GCamera:(?:MotionPhoto|MicroVideo)(?:\s*=\s*["']|>)\s*1|Item:Semantic\s*=\s*["']MotionPhoto`)
+
+var (
+	// microVideoOffset is where the clip starts, counted from the end of
+	// the file, in the GCamera XMP of older motion photos.
+	microVideoOffset = regexp.MustCompile(`GCamera:MicroVideoOffset(?:\s*=\s*["']|>)\s*(\d+)`)
+	containerItem    = regexp.MustCompile(`<Container:Item\b[^>]*>`)
+	itemLength       = regexp.MustCompile(`Item:Length\s*=\s*["'](\d+)`)
+)
+
+// MotionClip returns the MP4 clip a Google motion photo appends to its JPEG.
+// The clip's length comes from the XMP; files without it are searched for
+// an MP4 header after the image.
+func MotionClip(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil, false
+	}
+	head := data[:min(len(data), maxEXIFBytes)]
+	n := 0
+	if m := microVideoOffset.FindSubmatch(head); m != nil {
+		n, _ = strconv.Atoi(string(m[1]))
+	}
+	for _, item := range containerItem.FindAll(head, -1) {
+		if !bytes.Contains(item, []byte("MotionPhoto")) {
+			continue
+		}
+		if m := itemLength.FindSubmatch(item); m != nil {
+			n, _ = strconv.Atoi(string(m[1]))
+		}
+	}
+	if n > 0 && n < len(data) && isMP4(data[len(data)-n:]) {
+		return data[len(data)-n:], true
+	}
+	// The clip is an MP4 file, which starts with an ftyp box.
+	for from := 2; ; {
+		i := bytes.Index(data[from:], []byte("ftyp"))
+		if i < 0 {
+			return nil, false
+		}
+		if start := from + i - 4; start > 2 && isMP4(data[start:]) {
+			return data[start:], true
+		}
+		from += i + 4
+	}
+}
+
+// isMP4 reports whether data starts with an ftyp box.
+func isMP4(data []byte) bool {
+	boxes := readBoxes(data[:min(len(data), 64)])
+	return len(boxes) > 0 && boxes[0].typ == "ftyp"
+}
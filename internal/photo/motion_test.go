@@ -0,0 +1,68 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+)
+
+// mp4Clip stands in for the video of a motion photo.
+var mp4Clip = append(box("ftyp", []byte("isom\x00\x00\x00\x00isommp42")), box("mdat", []byte("frames"))...)
+
+// withXMP inserts an XMP packet into a JPEG.
+func withXMP(jpg []byte, xmp string) []byte {
+	payload := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmp...)
+	n := len(payload) + 2
+	segment := append([]byte{0xff, 0xe1, byte(n >> 8), byte(n)}, payload...)
+	return bytes.Join([][]byte{jpg[:2], segment, jpg[2:]}, nil)
+}
+
+func TestMotionClip(t *testing.T) {
+	jpg := makeJPEG(t, 16, 16)
+	length := strconv.Itoa(len(mp4Clip))
+	container := `<Container:Directory><rdf:Seq>
+		<rdf:li><Container:Item Item:Mime="image/jpeg" Item:Semantic="Primary"/></rdf:li>
+		<rdf:li><Container:Item Item:Mime="video/mp4" Item:Semantic="MotionPhoto" Item:Length="` + length + `"/></rdf:li>
+	</rdf:Seq></Container:Directory>`
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"container", append(withXMP(jpg, container), mp4Clip...), true},
+		{"micro video", append(withXMP(jpg, `GCamera:MicroVideo="1" GCamera:MicroVideoOffset="`+length+`"`), mp4Clip...), true},
+		{"no xmp", append(jpg, mp4Clip...), true},
+		{"wrong length", append(withXMP(jpg, `GCamera:MicroVideoOffset="3"`), mp4Clip...), true},
+		{"still", jpg, false},
+		{"heic", makeHEIF([]heifItemSpec{{typ: "hvc1", data: hevc}}, 0), false},
+	}
+	for _, tt := range tests {
+		clip, ok := MotionClip(tt.data)
+		if ok != tt.want {
+			t.Errorf("%s: MotionClip() ok = %v, want %v", tt.name, ok, tt.want)
+			continue
+		}
+		if ok && !bytes.Equal(clip, mp4Clip) {
+			t.Errorf("%s: clip is %d bytes, want the %d-byte MP4", tt.name, len(clip), len(mp4Clip))
+		}
+	}
+}
+
+func TestEXIFExtractor_MotionPhoto(t *testing.T) {
+	jpg := makeJPEG(t, 16, 16)
+	for xmp, want := range map[string]bool{
+		`<GCamera:MotionPhoto>1</GCamera:MotionPhoto>`:                  true,
+		`GCamera:MicroVideo="1"`:                                        true,
+		`<Container:Item Item:Semantic="MotionPhoto" Item:Length="9"/>`: true,
+		`GCamera:MotionPhoto="0"`:                                       false,
+	} {
+		meta, err := NewEXIFExtractor().Extract(context.Background(), withXMP(jpg, xmp))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if meta.Motion != want {
+			t.Errorf("%s: Motion = %v, want %v", xmp, meta.Motion, want)
+		}
+	}
+}
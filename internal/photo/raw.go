@@ -0,0 +1,226 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+)
+
+// TIFF tags read from RAW containers.
+const (
+	tagCompression    = 0x0103
+	tagStripOffsets   = 0x0111
+	tagOrientation    = 0x0112
+	tagStripCounts    = 0x0117
+	tagSubIFDs        = 0x014a
+	tagJPEGOffset     = 0x0201
+	tagJPEGLength     = 0x0202
+	compressionOldJPG = 6
+	compressionJPEG   = 7
+)
+
+// rafMagic starts Fujifilm RAF files, which are not TIFF based but point at
+// their JPEG preview from a fixed header.
+var rafMagic = []byte("FUJIFILMCCD-RAW")
+
+// rawPreview returns the largest JPEG preview embedded in a CR2, NEF, ARW,
+// DNG or RAF file. Previews without EXIF of their own get the RAW file's
+// orientation, so they are shown the right way up. ok is false for data that
+// is not a RAW file or has no preview that can be decoded.
+func rawPreview(data []byte) (preview []byte, ok bool) {
+	var candidates [][]byte
+	orientation := 1
+	switch {
+	case bytes.HasPrefix(data, rafMagic):
+		if len(data) < 92 {
+			return nil, false
+		}
+		off, n := binary.BigEndian.Uint32(data[84:]), binary.BigEndian.Uint32(data[88:])
+		if c, ok := slice(data, off, n); ok {
+			candidates = append(candidates, c)
+		}
+	default:
+		t, ok := newTIFF(data)
+		if !ok {
+			return nil, false
+		}
+		candidates, orientation = t.previews()
+	}
+
+	best, bestArea := []byte(nil), 0
+	for _, c := range candidates {
+		// Lossless JPEG, which CR2 and DNG use for the sensor data itself,
+		// fails here along with anything else that is not a viewable JPEG.
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(c))
+		if err != nil {
+			continue
+		}
+		if area := cfg.Width * cfg.Height; area > bestArea {
+			best, bestArea = c, area
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return withOrientation(best, orientation), true
+}
+
+// isTIFF reports whether data starts with a TIFF header, as CR2, NEF, ARW
+// and DNG files do.
+func isTIFF(data []byte) bool {
+	_, ok := newTIFF(data)
+	return ok
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTIFF(data []byte) (*tiff, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		return &tiff{data, binary.LittleEndian}, true
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		return &tiff{data, binary.BigEndian}, true
+	}
+	return nil, false
+}
+
+// previews collects the JPEG streams referenced from IFD0, the IFDs chained
+// after it and their SubIFDs, along with the orientation in IFD0.
+func (t *tiff) previews() ([][]byte, int) {
+	var found [][]byte
+	orientation := 1
+	seen := make(map[uint32]bool)
+	var walk func(off uint32, depth int)
+	walk = func(off uint32, depth int) {
+		// RAW files chain a handful of IFDs; the limits only guard against
+		// loops and garbage offsets.
+		for n := 0; off != 0 && n < 8 && depth < 4 && !seen[off]; n++ {
+			seen[off] = true
+			tags, next, ok := t.ifd(off)
+			if !ok {
+				return
+			}
+			if depth == 0 && n == 0 {
+				if o := tags[tagOrientation]; len(o) == 1 && o[0] >= 1 && o[0] <= 8 {
+					orientation = int(o[0])
+				}
+			}
+			if o, l := tags[tagJPEGOffset], tags[tagJPEGLength]; len(o) == 1 && len(l) == 1 {
+				if c, ok := slice(t.data, o[0], l[0]); ok {
+					found = append(found, c)
+				}
+			}
+			if c := tags[tagCompression]; len(c) == 1 && (c[0] == compressionOldJPG || c[0] == compressionJPEG) {
+				if o, l := tags[tagStripOffsets], tags[tagStripCounts]; len(o) == 1 && len(l) == 1 {
+					if c, ok := slice(t.data, o[0], l[0]); ok {
+						found = append(found, c)
+					}
+				}
+			}
+			for _, sub := range tags[tagSubIFDs] {
+				walk(sub, depth+1)
+			}
+			off = next
+		}
+	}
+	if len(t.data) >= 8 {
+		walk(t.order.Uint32(t.data[4:]), 0)
+	}
+	return found, orientation
+}
+
+// ifd reads the integer tags of the IFD at off and the offset of the next.
+func (t *tiff) ifd(off uint32) (map[uint16][]uint32, uint32, bool) {
+	if uint64(off)+2 > uint64(len(t.data)) {
+		return nil, 0, false
+	}
+	count := int(t.order.Uint16(t.data[off:]))
+	end := uint64(off) + 2 + uint64(count)*12
+	if end+4 > uint64(len(t.data)) {
+		return nil, 0, false
+	}
+	tags := make(map[uint16][]uint32, count)
+	for i := range count {
+		e := t.data[int(off)+2+i*12:]
+		tag, typ, n := t.order.Uint16(e), t.order.Uint16(e[2:]), t.order.Uint32(e[4:])
+		var size uint32
+		switch typ {
+		case 3: // SHORT
+			size = 2
+		case 4, 13: // LONG, IFD
+			size = 4
+		default:
+			continue
+		}
+		// Only a few values are ever needed; sensor strip tables can hold
+		// thousands.
+		if n == 0 || n > 64 {
+			continue
+		}
+		values := e[8:12]
+		if n*size > 4 {
+			v, ok := slice(t.data, t.order.Uint32(e[8:]), n*size)
+			if !ok {
+				continue
+			}
+			values = v
+		}
+		for j := uint32(0); j < n; j++ {
+			if size == 2 {
+				tags[tag] = append(tags[tag], uint32(t.order.Uint16(values[j*2:])))
+			} else {
+				tags[tag] = append(tags[tag], t.order.Uint32(values[j*4:]))
+			}
+		}
+	}
+	return tags, t.order.Uint32(t.data[end:]), true
+}
+
+// slice returns data[off:off+n], or false if that is out of range.
+func slice(data []byte, off, n uint32) ([]byte, bool) {
+	end := uint64(off) + uint64(n)
+	if n == 0 || end > uint64(len(data)) {
+		return nil, false
+	}
+	return data[off:end], true
+}
+
+// withOrientation inserts an EXIF segment holding only the orientation
+// after the start of a JPEG that has no EXIF segment of its own.
+func withOrientation(jpg []byte, orientation int) []byte {
+	if orientation == 1 || hasEXIF(jpg) {
+		return jpg
+	}
+	tiffIFD := []byte{
+		'M', 'M', 0, '*', 0, 0, 0, 8, // header, IFD0 at 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, // Orientation SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiffIFD...)
+	segment := append([]byte{0xff, 0xe1, 0, byte(len(payload) + 2)}, payload...)
+	out := make([]byte, 0, len(jpg)+len(segment))
+	out = append(out, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+// hasEXIF reports whether an APP1 EXIF segment comes before the image data
+// of a JPEG.
+func hasEXIF(jpg []byte) bool {
+	for p := 2; p+4 <= len(jpg) && jpg[p] == 0xff; {
+		marker := jpg[p+1]
+		if marker == 0xda { // start of scan
+			return false
+		}
+		n := int(binary.BigEndian.Uint16(jpg[p+2:]))
+		if marker == 0xe1 && bytes.HasPrefix(jpg[p+4:], []byte("Exif\x00")) {
+			return true
+		}
+		p += 2 + n
+	}
+	return false
+}
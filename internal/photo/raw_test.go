@@ -0,0 +1,283 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+// ifdEntry is a TIFF tag of a tiffFile. Its value is vals, text, or the
+// offset or length of the blob or IFD numbered from 1 in offsetOf, lengthOf
+// or ifd.
+type ifdEntry struct {
+	tag      uint16
+	vals     []uint32
+	short    bool
+	text     string
+	offsetOf int
+	lengthOf int
+	ifds     []int
+}
+
+// byteOrder is binary.LittleEndian or binary.BigEndian.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffFile lays out a TIFF: the header, IFDs, values too large for their
+// entries, then blobs. The first chained IFDs link to each other; the rest
+// are only reachable as SubIFDs.
+func tiffFile(order byteOrder, chained int, ifds [][]ifdEntry, blobs ...[]byte) []byte {
+	ifdOffsets := make([]uint32, len(ifds))
+	off := uint32(8)
+	for i, ifd := range ifds {
+		ifdOffsets[i] = off
+		off += 2 + 12*uint32(len(ifd)) + 4
+	}
+	type value struct {
+		typ   uint16
+		count uint32
+		data  []byte
+	}
+	values := make([][]value, len(ifds))
+	var extra []byte
+	extraStart := off
+	for i, ifd := range ifds {
+		for _, e := range ifd {
+			var v value
+			switch {
+			case e.text != "":
+				v = value{2, uint32(len(e.text) + 1), append([]byte(e.text), 0)}
+			case e.short:
+				v = value{typ: 3, count: uint32(len(e.vals))}
+				for _, n := range e.vals {
+					v.data = order.AppendUint16(v.data, uint16(n))
+				}
+			default:
+				v = value{typ: 4}
+				nums := e.vals
+				for _, n := range e.ifds {
+					nums = append(nums, ifdOffsets[n-1])
+				}
+				if e.offsetOf > 0 || e.lengthOf > 0 {
+					nums = append(nums, 0) // resolved once blobs are placed
+				}
+				v.count = uint32(len(nums))
+				for _, n := range nums {
+					v.data = order.AppendUint32(v.data, n)
+				}
+			}
+			if len(v.data) > 4 {
+				at := extraStart + uint32(len(extra))
+				extra = append(extra, v.data...)
+				v.data = order.AppendUint32(nil, at)
+			}
+			values[i] = append(values[i], v)
+		}
+	}
+	blobStart := extraStart + uint32(len(extra))
+	blobOffsets := make([]uint32, len(blobs))
+	for i, b := range blobs {
+		blobOffsets[i] = blobStart
+		blobStart += uint32(len(b))
+	}
+
+	out := []byte("II*\x00")
+	if order == binary.BigEndian {
+		out = []byte("MM\x00*")
+	}
+	out = order.AppendUint32(out, ifdOffsets[0])
+	for i, ifd := range ifds {
+		out = order.AppendUint16(out, uint16(len(ifd)))
+		for j, e := range ifd {
+			v := values[i][j]
+			data := append(v.data, make([]byte, 4-len(v.data))...)
+			switch {
+			case e.offsetOf > 0:
+				data = order.AppendUint32(nil, blobOffsets[e.offsetOf-1])
+			case e.lengthOf > 0:
+				data = order.AppendUint32(nil, uint32(len(blobs[e.lengthOf-1])))
+			}
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, v.typ)
+			out = order.AppendUint32(out, v.count)
+			out = append(out, data...)
+		}
+		var next uint32
+		if i+1 < chained {
+			next = ifdOffsets[i+1]
+		}
+		out = order.AppendUint32(out, next)
+	}
+	out = append(out, extra...)
+	for _, b := range blobs {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// losslessJPEG starts like the lossless JPEG sensor data of a CR2 or DNG.
+var losslessJPEG = []byte{0xff, 0xd8, 0xff, 0xc3, 0, 11, 8, 0, 16, 0, 16, 1, 1, 0x11, 0}
+
+// makeCR2 builds a little-endian RAW file shot rotated 90° clockwise: IFD0
+// holds a 300x200 preview as an old-style JPEG strip, IFD1 a 160x120
+// thumbnail and IFD2 lossless sensor data.
+func makeCR2(t *testing.T) []byte {
+	t.Helper()
+	return tiffFile(binary.LittleEndian, 3, [][]ifdEntry{
+		{
+			{tag: tagCompression, vals: []uint32{compressionOldJPG}, short: true},
+			{tag: 0x0110, text: "Canon EOS R6"},
+			{tag: tagStripOffsets, offsetOf: 1},
+			{tag: tagOrientation, vals: []uint32{6}, short: true},
+			{tag: tagStripCounts, lengthOf: 1},
+			{tag: 0x0132, text: "2023:05:01 10:20:30"},
+		},
+		{
+			{tag: tagJPEGOffset, offsetOf: 2},
+			{tag: tagJPEGLength, lengthOf: 2},
+		},
+		{
+			{tag: tagCompression, vals: []uint32{compressionOldJPG}, short: true},
+			{tag: tagStripOffsets, offsetOf: 3},
+			{tag: tagStripCounts, lengthOf: 3},
+		},
+	}, makeJPEG(t, 300, 200), makeJPEG(t, 160, 120), losslessJPEG)
+}
+
+// makeNEF builds a big-endian RAW file with a 160x120 thumbnail in IFD0 and
+// a 400x300 preview and lossless sensor data in its SubIFDs.
+func makeNEF(t *testing.T) []byte {
+	t.Helper()
+	return tiffFile(binary.BigEndian, 1, [][]ifdEntry{
+		{
+			{tag: tagSubIFDs, ifds: []int{2, 3}},
+			{tag: tagJPEGOffset, offsetOf: 1},
+			{tag: tagJPEGLength, lengthOf: 1},
+		},
+		{
+			{tag: tagJPEGOffset, offsetOf: 2},
+			{tag: tagJPEGLength, lengthOf: 2},
+		},
+		{
+			{tag: tagCompression, vals: []uint32{compressionJPEG}, short: true},
+			{tag: tagStripOffsets, offsetOf: 3},
+			{tag: tagStripCounts, lengthOf: 3},
+		},
+	}, makeJPEG(t, 160, 120), makeJPEG(t, 400, 300), losslessJPEG)
+}
+
+// makeRAF builds a RAF file whose header points at a 320x240 preview.
+func makeRAF(t *testing.T) []byte {
+	t.Helper()
+	preview := makeJPEG(t, 320, 240)
+	header := make([]byte, 100)
+	copy(header, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(header[84:], uint32(len(header)))
+	binary.BigEndian.PutUint32(header[88:], uint32(len(preview)))
+	return append(header, preview...)
+}
+
+func jpegSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode preview: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestRawPreview_PicksLargestJPEG(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		w, h int
+	}{
+		{"cr2", makeCR2(t), 300, 200},
+		{"nef", makeNEF(t), 400, 300},
+		{"raf", makeRAF(t), 320, 240},
+	}
+	for _, tt := range tests {
+		preview, ok := rawPreview(tt.data)
+		if !ok {
+			t.Errorf("%s: no preview found", tt.name)
+			continue
+		}
+		if w, h := jpegSize(t, preview); w != tt.w || h != tt.h {
+			t.Errorf("%s: preview = %dx%d, want %dx%d", tt.name, w, h, tt.w, tt.h)
+		}
+	}
+}
+
+func TestRawPreview_NotRaw(t *testing.T) {
+	noPreview := tiffFile(binary.LittleEndian, 1, [][]ifdEntry{{
+		{tag: tagCompression, vals: []uint32{compressionJPEG}, short: true},
+		{tag: tagStripOffsets, offsetOf: 1},
+		{tag: tagStripCounts, lengthOf: 1},
+	}}, losslessJPEG)
+	// An IFD whose next IFD is itself.
+	loop := []byte{'I', 'I', '*', 0, 8, 0, 0, 0, 0, 0, 8, 0, 0, 0}
+	for name, data := range map[string][]byte{
+		"jpeg":       makeJPEG(t, 8, 8),
+		"png":        makePNG(t, 8, 8),
+		"no preview": noPreview,
+		"loop":       loop,
+		"truncated":  makeCR2(t)[:40],
+		"short raf":  []byte("FUJIFILMCCD-RAW"),
+	} {
+		if _, ok := rawPreview(data); ok {
+			t.Errorf("%s: found a preview", name)
+		}
+	}
+}
+
+func TestRawPreview_KeepsOrientation(t *testing.T) {
+	preview, _ := rawPreview(makeCR2(t))
+	if !hasEXIF(preview) {
+		t.Fatal("preview has no EXIF segment")
+	}
+	fp, err := NewImageFingerprinter().Fingerprint(context.Background(), makeCR2(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fp.Width != 200 || fp.Height != 300 {
+		t.Errorf("fingerprint = %dx%d, want the preview rotated to 200x300", fp.Width, fp.Height)
+	}
+}
+
+func TestImageCompressor_Raw(t *testing.T) {
+	c := NewImageCompressor()
+	raw := makeNEF(t)
+	out, err := c.Compress(context.Background(), raw, Rendition{Width: 200, Height: 200, Mode: ModeFit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, h := jpegSize(t, out); w != 200 || h != 150 {
+		t.Errorf("rendition = %dx%d, want 200x150", w, h)
+	}
+	out, err = c.Compress(context.Background(), raw, Rendition{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(out, raw) {
+		t.Error("original rendition is not the RAW file")
+	}
+}
+
+func TestEXIFExtractor_Raw(t *testing.T) {
+	meta, err := NewEXIFExtractor().Extract(context.Background(), makeCR2(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Model != "Canon EOS R6" {
+		t.Errorf("Model = %q, want %q", meta.Model, "Canon EOS R6")
+	}
+	want := time.Date(2023, 5, 1, 10, 20, 30, 0, time.Local)
+	if meta.TakenAt == nil || !meta.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want %v", meta.TakenAt, want)
+	}
+}
@@ -0,0 +1,111 @@
+package photo
+
+import (
+	"fmt"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// Resize modes of a Rendition.
+const (
+	// ModeFit scales the photo down to fit within the box.
+	ModeFit = "fit"
+	// ModeFill scales the photo to cover the box and crops what overflows.
+	ModeFill = "fill"
+	// ModeCrop cuts the box out of the middle of the photo without scaling.
+	ModeCrop = "crop"
+)
+
+// Rendition says how to size a photo for serving. A zero Width or Height
+// leaves that side unbounded; a Rendition without either is the original
+// file. WebP allows encoding to WebP, for clients that accept it.
+type Rendition struct {
+	Width  int
+	Height int
+	Mode   string
+	WebP   bool
+}
+
+// DefaultRendition is served when a request names no rendition.
+var DefaultRendition = Rendition{Width: maxLongEdge, Height: maxLongEdge, Mode: ModeFit}
+
+func (r Rendition) IsOriginal() bool {
+	return r.Width == 0 && r.Height == 0
+}
+
+// Key identifies the rendition within cache keys.
+func (r Rendition) Key() string {
+	if r.IsOriginal() {
+		return "original"
+	}
+	key := fmt.Sprintf("%s:%dx%d", r.Mode, r.Width, r.Height)
+	if r.WebP {
+		key += "+webp"
+	}
+	return key
+}
+
+// DefaultSizes are the named sizes, by long edge in pixels, allowed unless
+// configured otherwise. 0 is the original.
+var DefaultSizes = map[string]int{"thumb": 256, "small": 640, "medium": 1280, "large": maxLongEdge, "original": 0}
+
+// DefaultDimensions are the widths and heights allowed unless configured
+// otherwise.
+var DefaultDimensions = []int{256, 640, 1280, maxLongEdge}
+
+// RenditionPolicy turns request parameters into renditions. It only allows
+// the named sizes and the dimensions it was given, so clients cannot make the
+// server render and cache arbitrarily many sizes.
+type RenditionPolicy struct {
+	sizes      map[string]int
+	dimensions map[int]bool
+}
+
+func NewRenditionPolicy(sizes map[string]int, dimensions []int) *RenditionPolicy {
+	p := &RenditionPolicy{sizes: sizes, dimensions: make(map[int]bool, len(dimensions))}
+	for _, d := range dimensions {
+		p.dimensions[d] = true
+	}
+	return p
+}
+
+// Resolve returns the rendition of the named size, or of w, h and mode when
+// no size is named, or DefaultRendition when neither is given.
+func (p *RenditionPolicy) Resolve(size string, w, h int, mode string) (Rendition, error) {
+	if size != "" {
+		if w != 0 || h != 0 || mode != "" {
+			return Rendition{}, fmt.Errorf("%w: size excludes w, h and mode", domain.ErrInvalidRendition)
+		}
+		edge, ok := p.sizes[size]
+		if !ok {
+			return Rendition{}, fmt.Errorf("%w: unknown size %q", domain.ErrInvalidRendition, size)
+		}
+		if edge == 0 {
+			return Rendition{}, nil
+		}
+		return Rendition{Width: edge, Height: edge, Mode: ModeFit}, nil
+	}
+	if w == 0 && h == 0 {
+		if mode != "" {
+			return Rendition{}, fmt.Errorf("%w: mode needs w or h", domain.ErrInvalidRendition)
+		}
+		return DefaultRendition, nil
+	}
+	for _, d := range []int{w, h} {
+		if d != 0 && !p.dimensions[d] {
+			return Rendition{}, fmt.Errorf("%w: dimension %d not allowed", domain.ErrInvalidRendition, d)
+		}
+	}
+	switch mode {
+	case "":
+		mode = ModeFit
+	case ModeFit:
+	case ModeFill, ModeCrop:
+		if w == 0 || h == 0 {
+			return Rendition{}, fmt.Errorf("%w: %s needs both w and h", domain.ErrInvalidRendition, mode)
+		}
+	default:
+		return Rendition{}, fmt.Errorf("%w: unknown mode %q", domain.ErrInvalidRendition, mode)
+	}
+	return Rendition{Width: w, Height: h, Mode: mode}, nil
+}
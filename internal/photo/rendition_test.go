@@ -0,0 +1,56 @@
+package photo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+func TestRenditionPolicy_Resolve(t *testing.T) {
+	p := NewRenditionPolicy(DefaultSizes, DefaultDimensions)
+	tests := []struct {
+		size string
+		w, h int
+		mode string
+		want Rendition
+	}{
+		{"", 0, 0, "", DefaultRendition},
+		{"thumb", 0, 0, "", Rendition{Width: 256, Height: 256, Mode: ModeFit}},
+		{"original", 0, 0, "", Rendition{}},
+		{"", 640, 0, "", Rendition{Width: 640, Mode: ModeFit}},
+		{"", 256, 256, "fill", Rendition{Width: 256, Height: 256, Mode: ModeFill}},
+		{"", 640, 256, "crop", Rendition{Width: 640, Height: 256, Mode: ModeCrop}},
+	}
+	for _, tt := range tests {
+		got, err := p.Resolve(tt.size, tt.w, tt.h, tt.mode)
+		if err != nil {
+			t.Errorf("Resolve(%q, %d, %d, %q) error: %v", tt.size, tt.w, tt.h, tt.mode, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q, %d, %d, %q) = %+v, want %+v", tt.size, tt.w, tt.h, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestRenditionPolicy_Rejects(t *testing.T) {
+	p := NewRenditionPolicy(DefaultSizes, DefaultDimensions)
+	tests := []struct {
+		size string
+		w, h int
+		mode string
+	}{
+		{"huge", 0, 0, ""},
+		{"thumb", 256, 0, ""},
+		{"", 1000, 0, ""},
+		{"", 256, 0, "fill"},
+		{"", 256, 256, "stretch"},
+		{"", 0, 0, "fit"},
+	}
+	for _, tt := range tests {
+		if _, err := p.Resolve(tt.size, tt.w, tt.h, tt.mode); !errors.Is(err, domain.ErrInvalidRendition) {
+			t.Errorf("Resolve(%q, %d, %d, %q) error = %v, want ErrInvalidRendition", tt.size, tt.w, tt.h, tt.mode, err)
+		}
+	}
+}
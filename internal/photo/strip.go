@@ -0,0 +1,604 @@
+package photo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	// xmpKeyword names the PNG iTXt chunk holding XMP.
+	xmpKeyword = "XML:com.adobe.xmp"
+)
+
+// StripMetadata removes the metadata policy does not keep from a JPEG, PNG,
+// WebP, GIF or HEIF file. EXIF and XMP blocks, comments and text chunks go,
+// as does anything appended to a JPEG; the fields the policy keeps are
+// written back as a minimal EXIF block (orientation, capture date, camera
+// model) and XMP packet (rating, keywords, caption). GIFs hold none of these
+// fields, and HEIF files have their Exif and XMP items blanked without
+// writing anything back. Color profiles are kept. ok is false for other
+// formats, such as RAW files, whose metadata cannot be removed.
+func StripMetadata(data []byte, policy domain.MetadataPolicy) (out []byte, ok bool) {
+	if !policy.Strip {
+		return data, true
+	}
+	var tiff, xmp []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		out, tiff, xmp, ok = stripJPEG(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		out, tiff, xmp, ok = stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		out, tiff, xmp, ok = stripWebP(data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return stripGIF(data)
+	case IsHEIF(data):
+		return blankHEIF(data)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	meta := &domain.PhotoMeta{}
+	orientation := 0
+	if tiff != nil {
+		orientation = parseEXIF(meta, tiff)
+	}
+	if xmp != nil {
+		parseXMP(meta, xmp)
+	}
+	meta = policy.Filter(meta)
+	if !policy.Keeps(domain.MetaOrientation) {
+		orientation = 0
+	}
+	return withMetadata(out, exifBlock(meta, orientation), xmpPacket(meta)), true
+}
+
+// StripOriginal wraps the original file name, read from f, so that it is
+// served without the metadata policy does not keep. Images are read whole
+// and cleaned by StripMetadata; MP4 and QuickTime videos are streamed with
+// their metadata boxes masked, see StripVideoMetadata. ok is false for files
+// whose metadata cannot be removed.
+func StripOriginal(f io.ReadSeeker, name string, policy domain.MetadataPolicy) (io.ReadSeeker, bool) {
+	if !policy.Strip {
+		return f, true
+	}
+	if domain.IsVideo(name) {
+		return StripVideoMetadata(f, policy)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, false
+	}
+	data, ok := StripMetadata(data, policy)
+	if !ok {
+		return nil, false
+	}
+	return bytes.NewReader(data), true
+}
+
+// stripJPEG drops the APP1 (EXIF and XMP), APP13 (IPTC) and other
+// application segments of a JPEG, its comments and anything after its end,
+// keeping the JFIF header, ICC profile and Adobe color transform. It returns
+// the TIFF structure and XMP packet it dropped.
+func stripJPEG(data []byte) (out, tiff, xmp []byte, ok bool) {
+	out = append(make([]byte, 0, len(data)), data[:2]...)
+	p := 2
+	for p+2 <= len(data) {
+		if data[p] != 0xff {
+			return nil, nil, nil, false
+		}
+		marker := data[p+1]
+		switch {
+		case marker == 0xff: // fill byte
+			p++
+			continue
+		case marker == 0xd9: // end of image
+			return append(out, data[p:p+2]...), tiff, xmp, true
+		case marker >= 0xd0 && marker <= 0xd7 || marker == 0x01: // no length
+			out = append(out, data[p:p+2]...)
+			p += 2
+			continue
+		}
+		if p+4 > len(data) {
+			return nil, nil, nil, false
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if n < 2 || p+2+n > len(data) {
+			return nil, nil, nil, false
+		}
+		seg := data[p+4 : p+2+n]
+		keep := true
+		switch {
+		case marker == 0xe1:
+			if bytes.HasPrefix(seg, exifHeader) && tiff == nil {
+				tiff = seg[len(exifHeader):]
+			} else if bytes.HasPrefix(seg, xmpHeader) && xmp == nil {
+				xmp = seg[len(xmpHeader):]
+			}
+			keep = false
+		case marker == 0xe2:
+			keep = bytes.HasPrefix(seg, iccMarker)
+		case marker >= 0xe3 && marker <= 0xef:
+			keep = marker == 0xee // Adobe: how to read the color channels
+		case marker == 0xfe: // comment
+			keep = false
+		}
+		if keep {
+			out = append(out, data[p:p+2+n]...)
+		}
+		p += 2 + n
+		if marker == 0xda {
+			// The entropy-coded scan runs to the next marker that is not a
+			// stuffed 0xff or a restart.
+			start := p
+			for p+1 < len(data) && (data[p] != 0xff || data[p+1] == 0 || data[p+1] >= 0xd0 && data[p+1] <= 0xd7) {
+				p++
+			}
+			if p+1 >= len(data) {
+				p = len(data)
+			}
+			out = append(out, data[start:p]...)
+		}
+	}
+	// A file cut short of its end marker keeps what it has.
+	return out, tiff, xmp, true
+}
+
+// stripPNG drops the text, eXIf and tIME chunks of a PNG and anything after
+// its end, returning the TIFF structure and XMP packet it dropped.
+func stripPNG(data []byte) (out, tiff, xmp []byte, ok bool) {
+	out = append(make([]byte, 0, len(data)), data[:8]...)
+	for p := 8; p+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if n < 0 || p+12+n > len(data) {
+			return nil, nil, nil, false
+		}
+		typ, body := string(data[p+4:p+8]), data[p+8:p+8+n]
+		switch typ {
+		case "eXIf":
+			tiff = body
+		case "iTXt":
+			if text, ok := pngText(body); ok {
+				xmp = text
+			}
+		case "tEXt", "zTXt", "tIME":
+		default:
+			out = append(out, data[p:p+12+n]...)
+		}
+		if typ == "IEND" {
+			return out, tiff, xmp, true
+		}
+		p += 12 + n
+	}
+	return nil, nil, nil, false
+}
+
+// pngText returns the text of an iTXt chunk holding XMP: keyword,
+// compression flag and method, language and translated keyword, then text.
+func pngText(body []byte) ([]byte, bool) {
+	keyword, rest, ok := bytes.Cut(body, []byte{0})
+	if !ok || string(keyword) != xmpKeyword || len(rest) < 2 {
+		return nil, false
+	}
+	compressed := rest[0] == 1
+	parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+	if len(parts) < 3 {
+		return nil, false
+	}
+	if !compressed {
+		return parts[2], true
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(parts[2]))
+	if err != nil {
+		return nil, false
+	}
+	text, err := io.ReadAll(io.LimitReader(zr, maxEXIFBytes))
+	return text, err == nil
+}
+
+// stripWebP drops the EXIF and XMP chunks of a WebP, returning what they
+// held.
+func stripWebP(data []byte) (out, tiff, xmp []byte, ok bool) {
+	out = append(make([]byte, 0, len(data)), data[:12]...)
+	for p := 12; p+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[p+4:]))
+		if n < 0 || p+8+n > len(data) {
+			return nil, nil, nil, false
+		}
+		id, body := string(data[p:p+4]), data[p+8:p+8+n]
+		switch id {
+		case "EXIF":
+			tiff = bytes.TrimPrefix(body, exifHeader)
+		case "XMP ":
+			xmp = body
+		default:
+			out = append(out, riffChunk(id, body)...)
+		}
+		p += 8 + n + n&1
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return webpFlags(out), tiff, xmp, true
+}
+
+// webpFlags sets the EXIF and XMP flags of an extended WebP's VP8X header to
+// match the chunks it has.
+func webpFlags(data []byte) []byte {
+	if len(data) < 21 || string(data[12:16]) != "VP8X" {
+		return data
+	}
+	flags := data[20] &^ 0x0c
+	if webpChunk(data, "EXIF") {
+		flags |= 0x08
+	}
+	if webpChunk(data, "XMP ") {
+		flags |= 0x04
+	}
+	data[20] = flags
+	return data
+}
+
+func webpChunk(data []byte, id string) bool {
+	for p := 12; p+8 <= len(data); {
+		if string(data[p:p+4]) == id {
+			return true
+		}
+		n := int(binary.LittleEndian.Uint32(data[p+4:]))
+		p += 8 + n + n&1
+	}
+	return false
+}
+
+// stripGIF drops the comments of a GIF and the application extensions other
+// than the loop count, which is where GIFs keep XMP.
+func stripGIF(data []byte) ([]byte, bool) {
+	if len(data) < 13 {
+		return nil, false
+	}
+	p := 13
+	if data[10]&0x80 != 0 {
+		p += 3 << (data[10]&7 + 1) // global color table
+	}
+	if p > len(data) {
+		return nil, false
+	}
+	out := append(make([]byte, 0, len(data)), data[:p]...)
+	// subBlocks returns where the sub-blocks starting at i end.
+	subBlocks := func(i int) int {
+		for i < len(data) && data[i] != 0 {
+			i += 1 + int(data[i])
+		}
+		if i >= len(data) {
+			return -1
+		}
+		return i + 1
+	}
+	for p < len(data) {
+		start := p
+		switch data[p] {
+		case 0x3b: // trailer
+			return append(out, 0x3b), true
+		case 0x21: // extension
+			if p+2 >= len(data) {
+				return nil, false
+			}
+			label := data[p+1]
+			if p = subBlocks(p + 2); p < 0 {
+				return nil, false
+			}
+			app := data[start+3 : min(start+14, len(data))]
+			loop := label == 0xff && (bytes.Equal(app, []byte("NETSCAPE2.0")) || bytes.Equal(app, []byte("ANIMEXTS1.0")))
+			if label == 0xfe || label == 0xff && !loop {
+				continue
+			}
+		case 0x2c: // image
+			if p+10 > len(data) {
+				return nil, false
+			}
+			packed := data[p+9]
+			p += 10
+			if packed&0x80 != 0 {
+				p += 3 << (packed&7 + 1) // local color table
+			}
+			if p = subBlocks(p + 1); p < 0 { // after the LZW code size
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+		out = append(out, data[start:p]...)
+	}
+	return append(out, 0x3b), true
+}
+
+// blankHEIF zeroes the Exif and XMP items of a HEIF file. Their space stays,
+// so every offset in the file still holds.
+func blankHEIF(data []byte) ([]byte, bool) {
+	out := bytes.Clone(data)
+	h, ok := parseHEIF(out)
+	if !ok {
+		return nil, false
+	}
+	for _, it := range h.items {
+		if it.typ != "Exif" && (it.typ != "mime" || it.mime != "application/rdf+xml") {
+			continue
+		}
+		src := h.data
+		switch it.method {
+		case 0:
+		case 1:
+			src = h.idat
+		default:
+			return nil, false
+		}
+		for _, e := range it.extents {
+			n := e.n
+			if n == 0 && e.off <= uint64(len(src)) {
+				n = uint64(len(src)) - e.off
+			}
+			if e.off+n > uint64(len(src)) || e.off+n < e.off {
+				return nil, false
+			}
+			clear(src[e.off : e.off+n])
+		}
+	}
+	return out, true
+}
+
+// EXIF tags written back by exifBlock.
+const (
+	tagModel    = 0x0110
+	tagDateTime = 0x0132
+)
+
+// exifBlock encodes the orientation, capture date and camera model of meta
+// as a big-endian TIFF structure, or returns nil if there are none.
+func exifBlock(meta *domain.PhotoMeta, orientation int) []byte {
+	type entry struct {
+		tag   uint16
+		short int
+		text  string
+	}
+	var entries []entry // in tag order
+	if meta.Model != "" {
+		entries = append(entries, entry{tag: tagModel, text: meta.Model})
+	}
+	if orientation > 1 && orientation <= 8 {
+		entries = append(entries, entry{tag: tagOrientation, short: orientation})
+	}
+	if meta.TakenAt != nil {
+		entries = append(entries, entry{tag: tagDateTime, text: meta.TakenAt.Format("2006:01:02 15:04:05")})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	ifd := binary.BigEndian.AppendUint16(nil, uint16(len(entries)))
+	var values []byte
+	valuesAt := 8 + 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		ifd = binary.BigEndian.AppendUint16(ifd, e.tag)
+		if e.text == "" {
+			ifd = binary.BigEndian.AppendUint16(ifd, 3) // SHORT
+			ifd = binary.BigEndian.AppendUint32(ifd, 1)
+			ifd = binary.BigEndian.AppendUint16(ifd, uint16(e.short))
+			ifd = append(ifd, 0, 0)
+			continue
+		}
+		text := append([]byte(e.text), 0)
+		ifd = binary.BigEndian.AppendUint16(ifd, 2) // ASCII
+		ifd = binary.BigEndian.AppendUint32(ifd, uint32(len(text)))
+		if len(text) <= 4 {
+			ifd = append(ifd, append(text, make([]byte, 4-len(text))...)...)
+			continue
+		}
+		ifd = binary.BigEndian.AppendUint32(ifd, uint32(valuesAt+len(values)))
+		values = append(values, text...)
+		if len(values)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	ifd = append(ifd, 0, 0, 0, 0) // no next IFD
+	return bytes.Join([][]byte{[]byte("MM\x00*\x00\x00\x00\x08"), ifd, values}, nil)
+}
+
+// xmpPacket encodes the rating, keywords and caption of meta as XMP, or
+// returns nil if there are none.
+func xmpPacket(meta *domain.PhotoMeta) []byte {
+	if meta.Rating == 0 && len(meta.Keywords) == 0 && meta.Caption == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`)
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"`)
+	if meta.Rating != 0 {
+		b.WriteString(` xmp:Rating="` + strconv.Itoa(meta.Rating) + `"`)
+	}
+	b.WriteString(">")
+	if len(meta.Keywords) > 0 {
+		b.WriteString("<dc:subject><rdf:Bag>")
+		for _, k := range meta.Keywords {
+			b.WriteString("<rdf:li>" + html.EscapeString(k) + "</rdf:li>")
+		}
+		b.WriteString("</rdf:Bag></dc:subject>")
+	}
+	if meta.Caption != "" {
+		b.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + html.EscapeString(meta.Caption) + "</rdf:li></rdf:Alt></dc:description>")
+	}
+	b.WriteString("</rdf:Description></rdf:RDF></x:xmpmeta>")
+	return []byte(b.String())
+}
+
+// withMetadata embeds a TIFF structure and an XMP packet, either of which
+// may be nil, in a stripped JPEG, PNG or WebP.
+func withMetadata(data, tiff, xmp []byte) []byte {
+	if tiff == nil && xmp == nil {
+		return data
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		var segs []byte
+		for _, payload := range [][]byte{appendNonNil(exifHeader, tiff), appendNonNil(xmpHeader, xmp)} {
+			if payload == nil || len(payload) > 0xfffd {
+				continue
+			}
+			n := len(payload) + 2
+			segs = append(append(segs, 0xff, 0xe1, byte(n>>8), byte(n)), payload...)
+		}
+		return bytes.Join([][]byte{data[:2], segs, data[2:]}, nil)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) && len(data) >= 33:
+		// After IHDR, before the image data.
+		var chunks []byte
+		if tiff != nil {
+			chunks = append(chunks, pngChunk("eXIf", tiff)...)
+		}
+		if xmp != nil {
+			chunks = append(chunks, pngChunk("iTXt", append([]byte(xmpKeyword+"\x00\x00\x00\x00\x00"), xmp...))...)
+		}
+		return bytes.Join([][]byte{data[:33], chunks, data[33:]}, nil)
+	case len(data) >= 16 && string(data[12:16]) == "VP8X":
+		// Metadata chunks come last in an extended WebP.
+		out := bytes.Clone(data)
+		if tiff != nil {
+			out = append(out, riffChunk("EXIF", tiff)...)
+		}
+		if xmp != nil {
+			out = append(out, riffChunk("XMP ", xmp)...)
+		}
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+		return webpFlags(out)
+	}
+	// Simple WebPs cannot have held metadata to write back.
+	return data
+}
+
+func appendNonNil(prefix, b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(bytes.Clone(prefix), b...)
+}
+
+// pngChunk encodes a PNG chunk with its CRC.
+func pngChunk(typ string, body []byte) []byte {
+	typed := append([]byte(typ), body...)
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	out = append(out, typed...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(typed))
+}
+
+// videoMetadataBoxes hold the metadata of MP4 and QuickTime files: user
+// data such as the location and camera, metadata item lists, and vendor
+// boxes such as XMP.
+var videoMetadataBoxes = map[string]bool{"udta": true, "meta": true, "uuid": true}
+
+// videoTimeBoxes are the movie, track and media headers, which start with
+// the creation and modification times of the video.
+var videoTimeBoxes = map[string]bool{"mvhd": true, "tkhd": true, "mdhd": true}
+
+// StripVideoMetadata masks the metadata boxes of an MP4 or QuickTime video,
+// at the top level, in the movie and in its tracks: they read as free space
+// filled with zeros. Unless policy keeps the capture date, the creation and
+// modification times of the movie, track and media headers read as zeros
+// too. Nothing moves, so the file streams with Range requests as before. ok
+// is false for other videos, such as WebM files.
+func StripVideoMetadata(r io.ReadSeeker, policy domain.MetadataPolicy) (io.ReadSeeker, bool) {
+	var masks, times []boxSpan
+	var walk func(start, end int64, depth int) bool
+	walk = func(start, end int64, depth int) bool {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return false
+		}
+		for first := true; ; first = false {
+			b, err := nextBox(r, end)
+			if err == errNoBox {
+				return !first || depth > 0
+			}
+			if err != nil {
+				return false
+			}
+			if depth == 0 && first && b.typ != "ftyp" {
+				return false
+			}
+			switch {
+			case videoMetadataBoxes[b.typ]:
+				masks = append(masks, b)
+			case depth > 0 && videoTimeBoxes[b.typ] && !policy.Keeps(domain.MetaTakenAt):
+				// version(1) flags(3), then two 32-bit times, or 64-bit in
+				// version 1.
+				var version [1]byte
+				if _, err := io.ReadFull(r, version[:]); err != nil {
+					return false
+				}
+				size := int64(8)
+				if version[0] == 1 {
+					size = 16
+				}
+				times = append(times, boxSpan{typ: b.typ, at: b.payload + 4, end: min(b.payload+4+size, b.end)})
+			case depth < 3 && (b.typ == "moov" || b.typ == "trak" || b.typ == "mdia"):
+				if !walk(b.payload, b.end, depth+1) {
+					return false
+				}
+			}
+			if end >= 0 && b.end >= end {
+				return true
+			}
+			if _, err := r.Seek(b.end, io.SeekStart); err != nil {
+				return false
+			}
+		}
+	}
+	if !walk(0, -1, 0) {
+		return nil, false
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	return &maskedReader{r: r, masks: masks, times: times}, true
+}
+
+// maskedReader reads the boxes at masks as free boxes full of zeros, and the
+// bytes from at to end of each of times as zeros.
+type maskedReader struct {
+	r     io.ReadSeeker
+	pos   int64
+	masks []boxSpan
+	times []boxSpan
+}
+
+func (m *maskedReader) Read(b []byte) (int, error) {
+	n, err := m.r.Read(b)
+	from, to := m.pos, m.pos+int64(n)
+	for _, box := range m.masks {
+		for i := max(box.at, from); i < min(box.at+4, to); i++ {
+			b[i-from] = "free"[i-box.at]
+		}
+		if lo, hi := max(box.payload, from), min(box.end, to); lo < hi {
+			clear(b[lo-from : hi-from])
+		}
+	}
+	for _, span := range m.times {
+		if lo, hi := max(span.at, from), min(span.end, to); lo < hi {
+			clear(b[lo-from : hi-from])
+		}
+	}
+	m.pos = to
+	return n, err
+}
+
+func (m *maskedReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := m.r.Seek(offset, whence)
+	if err == nil {
+		m.pos = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,249 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// cameraEXIF is the EXIF of a phone photo shot rotated 90° clockwise, with a
+// serial number and a GPS position that must not leak.
+var cameraEXIF = tiffFile(binary.BigEndian, 1, [][]ifdEntry{{
+	{tag: 0x0110, text: "Pixel 8"},
+	{tag: 0x0112, vals: []uint32{6}, short: true},
+	{tag: 0x0132, text: "2024:03:09 08:15:00"},
+	{tag: 0x8825, ifds: []int{2}},
+	{tag: 0xa431, text: "SERIAL-0042"},
+}, {
+	{tag: 0x0001, text: "N"},
+	{tag: 0x001d, text: "2024:03:09"},
+}})
+
+const cameraXMP = `<x:xmpmeta><rdf:Description xmp:Rating="4"><dc:subject><rdf:Bag><rdf:li>office</rdf:li></rdf:Bag></dc:subject>` +
+	`<dc:description><rdf:Alt><rdf:li>Team lunch</rdf:li></rdf:Alt></dc:description></rdf:Description></x:xmpmeta>`
+
+// leaks are strings of the fixtures that only a policy keeping everything
+// may serve.
+var leaks = []string{"SERIAL-0042", "2024:03:09\x00", "a comment"}
+
+// withSegment inserts a JPEG segment after the start of the image.
+func withSegment(jpg []byte, marker byte, payload []byte) []byte {
+	n := len(payload) + 2
+	segment := append([]byte{0xff, marker, byte(n >> 8), byte(n)}, payload...)
+	return bytes.Join([][]byte{jpg[:2], segment, jpg[2:]}, nil)
+}
+
+var (
+	orientationOnly = domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaOrientation}}
+	stripAll        = domain.MetadataPolicy{Strip: true}
+)
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	data := withXMP(makeJPEG(t, 16, 8), cameraXMP)
+	data = withSegment(data, 0xe1, append([]byte("Exif\x00\x00"), cameraEXIF...))
+	data = withSegment(data, 0xfe, []byte("a comment"))
+	data = append(data, mp4Clip...)
+
+	tests := []struct {
+		name        string
+		policy      domain.MetadataPolicy
+		orientation int
+		model       string
+		keywords    []string
+	}{
+		{"strip", stripAll, 0, "", nil},
+		{"orientation", orientationOnly, 6, "", nil},
+		{"allowlist", domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaModel, domain.MetaKeywords}}, 0, "Pixel 8", []string{"office"}},
+	}
+	for _, tt := range tests {
+		out, ok := StripMetadata(data, tt.policy)
+		if !ok {
+			t.Fatalf("%s: JPEG could not be stripped", tt.name)
+		}
+		for _, leak := range append(leaks, "ftyp", "Team lunch") {
+			if bytes.Contains(out, []byte(leak)) {
+				t.Errorf("%s: output still holds %q", tt.name, leak)
+			}
+		}
+		if w, h := jpegSize(t, out); w != 16 || h != 8 {
+			t.Errorf("%s: output is %dx%d, want 16x8", tt.name, w, h)
+		}
+		meta := &domain.PhotoMeta{}
+		if o := parseEXIF(meta, out); o != tt.orientation {
+			t.Errorf("%s: orientation = %d, want %d", tt.name, o, tt.orientation)
+		}
+		parseXMP(meta, out)
+		if meta.Model != tt.model || !slices.Equal(meta.Keywords, tt.keywords) || meta.TakenAt != nil || meta.Rating != 0 {
+			t.Errorf("%s: kept %+v, want model %q and keywords %v only", tt.name, meta, tt.model, tt.keywords)
+		}
+	}
+
+	if out, ok := StripMetadata(data, domain.MetadataPolicy{}); !ok || !bytes.Equal(out, data) {
+		t.Error("the zero policy changed the file")
+	}
+}
+
+func TestStripMetadata_Formats(t *testing.T) {
+	img := makeScreenshot(40, 30)
+	var pngBuf, webpBuf, gifBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := nativewebp.Encode(&webpBuf, img, nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := gif.Encode(&gifBuf, img, nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	pngData := withMetadata(pngBuf.Bytes(), cameraEXIF, []byte(cameraXMP))
+	pngData = bytes.Join([][]byte{pngData[:33], pngChunk("tEXt", []byte("Comment\x00a comment")), pngData[33:]}, nil)
+	webpData := withMetadata(withICC(webpBuf.Bytes(), displayP3), cameraEXIF, []byte(cameraXMP))
+	gifData := gifBuf.Bytes()
+	gifData = bytes.Join([][]byte{gifData[:len(gifData)-1], []byte("\x21\xfe\x09a comment\x00\x21\xff\x0bXMP DataXMP\x0bSERIAL-0042\x00\x3b")}, nil)
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{{"png", pngData}, {"webp", webpData}, {"gif", gifData}} {
+		if !bytes.Contains(tt.data, []byte("SERIAL-0042")) {
+			t.Fatalf("%s: fixture lacks the serial number", tt.name)
+		}
+		rating := domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaRating}}
+		out, ok := StripMetadata(tt.data, rating)
+		if !ok {
+			t.Fatalf("%s: could not be stripped", tt.name)
+		}
+		for _, leak := range append(leaks, "Pixel 8", "office") {
+			if bytes.Contains(out, []byte(leak)) {
+				t.Errorf("%s: output still holds %q", tt.name, leak)
+			}
+		}
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(out)); err != nil || cfg.Width != 40 {
+			t.Errorf("%s: output does not decode: %v", tt.name, err)
+		}
+		if tt.name != "gif" && !bytes.Contains(out, []byte(`xmp:Rating="4"`)) {
+			t.Errorf("%s: rating was not kept", tt.name)
+		}
+	}
+
+	if out, _ := StripMetadata(webpData, stripAll); !bytes.Equal(iccProfile(out), displayP3) {
+		t.Error("WebP lost its color profile")
+	}
+}
+
+func TestStripMetadata_KeepsGIFLoop(t *testing.T) {
+	data := makeGIF(t, 8, 8, 3, 10)
+	out, ok := StripMetadata(data, stripAll)
+	if !ok {
+		t.Fatal("GIF could not be stripped")
+	}
+	before, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	after, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode stripped: %v", err)
+	}
+	if len(after.Image) != len(before.Image) || after.LoopCount != before.LoopCount {
+		t.Errorf("stripped GIF has %d frames looping %d, want %d looping %d", len(after.Image), after.LoopCount, len(before.Image), before.LoopCount)
+	}
+}
+
+func TestStripMetadata_HEIFAndRaw(t *testing.T) {
+	data := makeHEIF([]heifItemSpec{
+		{typ: "hvc1", data: hevc},
+		{typ: "jpeg", data: makeJPEG(t, 32, 24)},
+		{typ: "Exif", data: exifItem(cameraEXIF), inIdat: true},
+		{typ: "mime", mime: "application/rdf+xml", data: []byte(cameraXMP)},
+	}, 0)
+	out, ok := StripMetadata(data, orientationOnly)
+	if !ok {
+		t.Fatal("HEIC could not be stripped")
+	}
+	if len(out) != len(data) || bytes.Contains(out, []byte("SERIAL-0042")) || bytes.Contains(out, []byte("office")) {
+		t.Error("HEIC metadata items were not blanked in place")
+	}
+	if _, ok := heifPreview(out); !ok {
+		t.Error("stripped HEIC lost its preview")
+	}
+	if !bytes.Contains(data, []byte("SERIAL-0042")) {
+		t.Error("stripping changed the input")
+	}
+
+	if _, ok := StripMetadata(makeCR2(t), stripAll); ok {
+		t.Error("RAW file reported as stripped")
+	}
+}
+
+func TestStripVideoMetadata(t *testing.T) {
+	const created = 3_600_000_000
+	location := box("\xa9xyz", []byte("+25.0330+121.5654/"))
+	video := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")),
+		box("moov",
+			mvhd(0, created),
+			box("udta", location),
+			box("trak",
+				box("tkhd", mvhd(0, created)[8:]),
+				box("meta", []byte("\x00\x00\x00\x00serial SERIAL-0042")),
+				box("mdia", box("mdhd", mvhd(1, created)[8:])))),
+		box("mdat", []byte("frames")),
+	}, nil)
+	stamp := binary.BigEndian.AppendUint32(nil, created)
+
+	r, ok := StripVideoMetadata(bytes.NewReader(video), stripAll)
+	if !ok {
+		t.Fatal("MP4 could not be stripped")
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(out) != len(video) || bytes.Contains(out, []byte("+25.0330")) || bytes.Contains(out, []byte("SERIAL-0042")) {
+		t.Error("video metadata was not masked in place")
+	}
+	if n := bytes.Count(out, []byte("free")); n != 2 {
+		t.Errorf("found %d free boxes, want 2", n)
+	}
+	if bytes.Contains(out, stamp) {
+		t.Error("video still holds its creation time")
+	}
+	if meta, _ := NewVideoExtractor().ExtractVideo(context.Background(), bytes.NewReader(out)); meta.TakenAt != nil {
+		t.Errorf("stripped video taken at %v", meta.TakenAt)
+	}
+
+	// A policy keeping the capture date leaves the headers alone.
+	kept, ok := StripVideoMetadata(bytes.NewReader(video), domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaTakenAt}})
+	if !ok {
+		t.Fatal("MP4 could not be stripped")
+	}
+	keptOut, err := io.ReadAll(kept)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if n := bytes.Count(keptOut, stamp); n != 6 || bytes.Contains(keptOut, []byte("SERIAL-0042")) {
+		t.Errorf("found the header times %d times, want 6", n)
+	}
+	// Range requests read from the middle.
+	if _, err := r.Seek(40, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	part := make([]byte, 60)
+	if _, err := io.ReadFull(r, part); err != nil || !bytes.Equal(part, out[40:100]) {
+		t.Errorf("reading from offset 40 gave %q, want %q", part, out[40:100])
+	}
+
+	if _, ok := StripVideoMetadata(bytes.NewReader([]byte("\x1a\x45\xdf\xa3webm")), stripAll); ok {
+		t.Error("WebM reported as stripped")
+	}
+}
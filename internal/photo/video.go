@@ -0,0 +1,170 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// VideoExtractor reads the capture date of MP4 and QuickTime videos from the
+// mvhd atom of their movie header. WebM files have no such atom and yield
+// empty metadata.
+type VideoExtractor struct{}
+
+func NewVideoExtractor() *VideoExtractor {
+	return &VideoExtractor{}
+}
+
+func (e *VideoExtractor) ExtractVideo(_ context.Context, r io.ReadSeeker) (*domain.PhotoMeta, error) {
+	meta := &domain.PhotoMeta{}
+	if created, err := movieCreationTime(r); err == nil {
+		meta.TakenAt = &created
+	}
+	return meta, nil
+}
+
+// mp4Epoch is the zero of the timestamps in MP4 and QuickTime headers.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var errNoBox = errors.New("box not found")
+
+// movieCreationTime returns the creation time of the moov/mvhd box. Cameras
+// that leave it unset write 0, which is reported as an error.
+func movieCreationTime(r io.ReadSeeker) (time.Time, error) {
+	moovEnd, err := findBox(r, "moov", -1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, err := findBox(r, "mvhd", moovEnd); err != nil {
+		return time.Time{}, err
+	}
+	// version(1) flags(3), then a 32-bit creation time, or 64-bit in version 1.
+	var buf [12]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return time.Time{}, err
+	}
+	secs := uint64(binary.BigEndian.Uint32(buf[4:8]))
+	if buf[0] == 1 {
+		secs = binary.BigEndian.Uint64(buf[4:12])
+	}
+	// Anything past the year 3000 is garbage rather than a date.
+	if secs == 0 || secs > 1<<35 {
+		return time.Time{}, errors.New("no creation time")
+	}
+	// secs may not fit in a time.Duration, which ends in 2196.
+	return time.Unix(mp4Epoch.Unix()+int64(secs), 0).UTC(), nil
+}
+
+// findBox looks for a box of type typ among the sibling boxes starting at the
+// current offset of r and ending at end, or at the end of the file if end is
+// negative. It leaves r at the box's payload and returns where the box ends.
+func findBox(r io.ReadSeeker, typ string, end int64) (int64, error) {
+	for {
+		b, err := nextBox(r, end)
+		if err != nil {
+			return 0, err
+		}
+		if b.typ == typ {
+			return b.end, nil
+		}
+		if _, err := r.Seek(b.end, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// boxSpan is where a box lies in a file: its type field at at, its payload
+// from payload to end.
+type boxSpan struct {
+	typ              string
+	at, payload, end int64
+}
+
+// nextBox reads the header of the box at the current offset of r, within a
+// parent ending at end, or at the end of the file if end is negative. It
+// leaves r at the box's payload.
+func nextBox(r io.ReadSeeker, end int64) (boxSpan, error) {
+	var hdr [16]byte
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return boxSpan{}, err
+	}
+	if end >= 0 && start+8 > end {
+		return boxSpan{}, errNoBox
+	}
+	if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+		return boxSpan{}, errNoBox
+	}
+	size, hdrLen := int64(binary.BigEndian.Uint32(hdr[:4])), int64(8)
+	switch size {
+	case 1:
+		// The real size follows as a 64-bit value.
+		if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+			return boxSpan{}, err
+		}
+		size, hdrLen = int64(binary.BigEndian.Uint64(hdr[8:16])), 16
+	case 0:
+		// The box runs to the end of its parent.
+		if end < 0 {
+			if end, err = r.Seek(0, io.SeekEnd); err != nil {
+				return boxSpan{}, err
+			}
+			if _, err := r.Seek(start+hdrLen, io.SeekStart); err != nil {
+				return boxSpan{}, err
+			}
+		}
+		size = end - start
+	}
+	if size < hdrLen {
+		return boxSpan{}, errors.New("malformed box")
+	}
+	return boxSpan{typ: string(hdr[4:8]), at: start + 4, payload: start + hdrLen, end: start + size}, nil
+}
+
+// posterAspect is the shape of video placeholders, 16:9 like most clips.
+const posterAspect = 16.0 / 9.0
+
+// VideoPoster draws the placeholder shown for a video that has no poster
+// image: a dark frame with a play symbol, sized to fit r.
+func VideoPoster(r Rendition) ([]byte, error) {
+	w, h := r.Width, r.Height
+	switch {
+	case w == 0 && h == 0:
+		w, h = maxLongEdge, int(maxLongEdge/posterAspect)
+	case h == 0 || (w != 0 && float64(w)/float64(h) < posterAspect && r.Mode == ModeFit):
+		h = int(float64(w) / posterAspect)
+	case w == 0 || r.Mode == ModeFit:
+		w = int(float64(h) * posterAspect)
+	}
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	bg, fg := color.Gray{Y: 0x22}, color.Gray{Y: 0xcc}
+	// A right-pointing triangle, a fifth of the height tall, in the middle.
+	side := float64(h) / 5
+	cx, cy := float64(w)/2, float64(h)/2
+	left := cx - side*0.4
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, bg)
+			dx, dy := float64(x)-left, float64(y)-cy
+			if dy < 0 {
+				dy = -dy
+			}
+			if dx >= 0 && dx <= side*0.9 && dy <= side/2*(1-dx/(side*0.9)) {
+				img.SetGray(x, y, fg)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// box encodes an MP4 box of type typ around payload.
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// mvhd encodes a movie header of the given version with creation time secs.
+func mvhd(version byte, secs uint64) []byte {
+	payload := []byte{version, 0, 0, 0}
+	if version == 1 {
+		payload = binary.BigEndian.AppendUint64(payload, secs)
+		payload = binary.BigEndian.AppendUint64(payload, secs)
+	} else {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(secs))
+		payload = binary.BigEndian.AppendUint32(payload, uint32(secs))
+	}
+	return box("mvhd", append(payload, make([]byte, 80)...))
+}
+
+func TestVideoExtractor_CreationTime(t *testing.T) {
+	taken := time.Date(2024, 7, 14, 9, 30, 0, 0, time.UTC)
+	secs := uint64(taken.Sub(mp4Epoch) / time.Second)
+	// Past the end of time.Duration, counted from 1904.
+	future := time.Date(2500, 3, 1, 12, 0, 0, 0, time.UTC)
+	futureSecs := uint64(future.Unix() - mp4Epoch.Unix())
+	// A 64-bit "free" box: size 1, then the real size.
+	large := append(binary.BigEndian.AppendUint32(nil, 1), "free"...)
+	large = append(binary.BigEndian.AppendUint64(large, 24), make([]byte, 8)...)
+
+	tests := []struct {
+		name string
+		file []byte
+		want *time.Time
+	}{
+		{"version 0", bytes.Join([][]byte{box("ftyp", []byte("isom")), box("moov", mvhd(0, secs))}, nil), &taken},
+		{"version 1", bytes.Join([][]byte{box("ftyp", []byte("qt  ")), box("moov", mvhd(1, secs))}, nil), &taken},
+		{"mdat first", bytes.Join([][]byte{box("ftyp"), large, box("mdat", make([]byte, 100)), box("moov", box("trak"), mvhd(0, secs))}, nil), &taken},
+		{"after 2196", bytes.Join([][]byte{box("ftyp"), box("moov", mvhd(1, futureSecs))}, nil), &future},
+		{"after 3000", bytes.Join([][]byte{box("ftyp"), box("moov", mvhd(1, 1<<36))}, nil), nil},
+		{"unset", bytes.Join([][]byte{box("ftyp"), box("moov", mvhd(0, 0))}, nil), nil},
+		{"no moov", box("ftyp", []byte("isom")), nil},
+		{"webm", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86, 0x81}, nil},
+	}
+	e := NewVideoExtractor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := e.ExtractVideo(context.Background(), bytes.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case tt.want == nil && meta.TakenAt != nil:
+				t.Errorf("TakenAt = %v, want none", meta.TakenAt)
+			case tt.want != nil && (meta.TakenAt == nil || !meta.TakenAt.Equal(*tt.want)):
+				t.Errorf("TakenAt = %v, want %v", meta.TakenAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideoPoster_Sizes(t *testing.T) {
+	tests := []struct {
+		r    Rendition
+		w, h int
+	}{
+		{Rendition{}, 1920, 1080},
+		{DefaultRendition, 1920, 1080},
+		{Rendition{Width: 256, Mode: ModeFit}, 256, 144},
+		{Rendition{Height: 144, Mode: ModeFit}, 256, 144},
+		{Rendition{Width: 256, Height: 256, Mode: ModeFill}, 256, 256},
+	}
+	for _, tt := range tests {
+		data, err := VideoPoster(tt.r)
+		if err != nil {
+			t.Fatalf("VideoPoster(%+v): %v", tt.r, err)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if cfg.Width != tt.w || cfg.Height != tt.h {
+			t.Errorf("VideoPoster(%+v) = %dx%d, want %dx%d", tt.r, cfg.Width, cfg.Height, tt.w, tt.h)
+		}
+	}
+}
@@ -0,0 +1,661 @@
+package photo
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// Lossy WebP holds a single VP8 key frame. The encoder below keeps to the
+// simplest parts of RFC 6386: every macroblock is predicted as a whole, all
+// coefficients share one partition and the default token probabilities, and
+// nothing is segmented.
+const (
+	// vp8Quantizer is the quantizer index lossy WebP photos are encoded
+	// at, which looks about as good as JPEG at jpegQuality.
+	vp8Quantizer = 28
+	// vp8FilterLevel is the strength of the loop filter that smooths the
+	// edges between blocks when the frame is decoded.
+	vp8FilterLevel = 20
+	// vp8MaxLevel is the largest quantized coefficient a token can code.
+	vp8MaxLevel = 2048
+)
+
+// The macroblock prediction modes.
+const (
+	vp8PredDC = iota
+	vp8PredVE
+	vp8PredHE
+	vp8PredTM
+)
+
+// encodeLossyWebP encodes the opaque img as a lossy WebP.
+func encodeLossyWebP(img image.Image) ([]byte, error) {
+	frame, _, err := encodeVP8(img, vp8Quantizer, vp8FilterLevel)
+	if err != nil {
+		return nil, err
+	}
+	body := append([]byte("WEBP"), riffChunk("VP8 ", frame)...)
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...), nil
+}
+
+// vp8Encoder holds the state of one frame being encoded.
+type vp8Encoder struct {
+	mbw, mbh int
+	// src is the image in macroblocks, its edges repeated to fill the last
+	// ones; rec is what a decoder reconstructs from the frame so far, which
+	// the next macroblocks are predicted from.
+	src, rec   *image.YCbCr
+	y1, y2, uv [2]int32
+	// modes and tokens are the frame's two partitions.
+	modes, tokens vp8Writer
+	// upNz and leftNz record which blocks bordering the next macroblock
+	// had coefficients, the context their tokens are coded in.
+	upNz   []vp8Nz
+	leftNz vp8Nz
+}
+
+type vp8Nz struct {
+	y2   uint8
+	y, c [4]uint8
+}
+
+// encodeVP8 encodes img as a VP8 key frame and also returns the frame a
+// decoder reconstructs from it before the loop filter.
+func encodeVP8(img image.Image, q, filterLevel int) ([]byte, *image.YCbCr, error) {
+	b := img.Bounds()
+	if b.Empty() || b.Dx() >= 1<<14 || b.Dy() >= 1<<14 {
+		return nil, nil, errors.New("vp8: unsupported image size")
+	}
+	e := &vp8Encoder{mbw: (b.Dx() + 15) / 16, mbh: (b.Dy() + 15) / 16}
+	e.src = toYCbCr420(imaging.Clone(img), e.mbw*16, e.mbh*16)
+	e.rec = image.NewYCbCr(e.src.Rect, image.YCbCrSubsampleRatio420)
+	e.y1 = [2]int32{int32(vp8DequantDC[q]), int32(vp8DequantAC[q])}
+	e.y2 = [2]int32{int32(vp8DequantDC[q]) * 2, max(int32(vp8DequantAC[q])*155/100, 8)}
+	e.uv = [2]int32{int32(vp8DequantDC[min(q, 117)]), int32(vp8DequantAC[q])}
+	e.upNz = make([]vp8Nz, e.mbw)
+	e.modes.init()
+	e.tokens.init()
+	e.writeHeader(q, filterLevel)
+	for mby := range e.mbh {
+		e.leftNz = vp8Nz{}
+		for mbx := range e.mbw {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+	first, rest := e.modes.flush(), e.tokens.flush()
+	if len(first) >= 1<<19 {
+		return nil, nil, errors.New("vp8: first partition too large")
+	}
+	// A key frame starts with its tag, a start code and its size.
+	tag := uint32(len(first))<<5 | 1<<4
+	out := []byte{byte(tag), byte(tag >> 8), byte(tag >> 16), 0x9d, 0x01, 0x2a}
+	out = binary.LittleEndian.AppendUint16(out, uint16(b.Dx()))
+	out = binary.LittleEndian.AppendUint16(out, uint16(b.Dy()))
+	out = append(out, first...)
+	out = append(out, rest...)
+	return out, e.rec, nil
+}
+
+// toYCbCr420 converts img to limited range BT.601, as VP8 decoders expect,
+// at w by h, repeating the last row and column to fill it.
+func toYCbCr420(img *image.NRGBA, w, h int) *image.YCbCr {
+	out := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+	iw, ih := img.Rect.Dx(), img.Rect.Dy()
+	rgb := func(x, y int) (int, int, int) {
+		i := min(y, ih-1)*img.Stride + min(x, iw-1)*4
+		return int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+	}
+	for y := range h {
+		for x := range w {
+			r, g, b := rgb(x, y)
+			out.Y[y*out.YStride+x] = uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	for y := range h / 2 {
+		for x := range w / 2 {
+			var r, g, b int
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			i := y*out.CStride + x
+			out.Cb[i] = clip8((-9719*r - 19081*g + 28800*b + 128<<18 + 1<<17) >> 18)
+			out.Cr[i] = clip8((28800*r - 24116*g - 4684*b + 128<<18 + 1<<17) >> 18)
+		}
+	}
+	return out
+}
+
+func (e *vp8Encoder) writeHeader(q, filterLevel int) {
+	w := &e.modes
+	w.putLiteral(0, 1) // color space
+	w.putLiteral(0, 1) // clamping type
+	w.putLiteral(0, 1) // segmentation
+	w.putLiteral(0, 1) // normal loop filter
+	w.putLiteral(filterLevel, 6)
+	w.putLiteral(0, 3) // sharpness
+	w.putLiteral(0, 1) // loop filter deltas
+	w.putLiteral(0, 2) // one token partition
+	w.putLiteral(q, 7)
+	for range 5 {
+		w.putLiteral(0, 1) // quantizer deltas
+	}
+	w.putLiteral(0, 1) // refresh entropy probabilities
+	for i := range vp8TokenUpdateProb {
+		for j := range vp8TokenUpdateProb[i] {
+			for k := range vp8TokenUpdateProb[i][j] {
+				for _, p := range vp8TokenUpdateProb[i][j][k] {
+					w.put(false, p)
+				}
+			}
+		}
+	}
+	w.putLiteral(0, 1) // no macroblocks are skipped
+}
+
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	// Luma is predicted as a whole and its blocks' DC coefficients are
+	// coded together in a Y2 block.
+	ys, yr := e.src.Y, e.rec.Y
+	yo := 16*mby*e.src.YStride + 16*mbx
+	edges := vp8EdgesOf(yr, e.rec.YStride, yo, 16, mbx, mby)
+	yMode := vp8BestMode(16, mbx, mby, vp8Block{edges, ys[yo:], e.src.YStride})
+	pred := vp8Predict(yMode, 16, mbx, mby, edges)
+	var yLevels [16][16]int32
+	var dc [16]int32
+	for n := range 16 {
+		coeff := vp8FDCT(vp8Residual(ys, e.src.YStride, yo+4*(n/4)*e.src.YStride+4*(n%4), pred, 16, 4*(n/4), 4*(n%4)))
+		dc[n] = coeff[0]
+		for z := 1; z < 16; z++ {
+			yLevels[n][z] = vp8Quantize(coeff[z], e.y1[1], false)
+		}
+	}
+	var y2Levels [16]int32
+	var y2Coeff [16]int16
+	for z, c := range vp8FWHT(dc) {
+		y2Levels[z] = vp8Quantize(c, e.y2[btoi(z > 0)], true)
+		y2Coeff[z] = int16(y2Levels[z] * e.y2[btoi(z > 0)])
+	}
+	dcs := vp8IWHT(y2Coeff)
+	vp8Fill(yr, e.rec.YStride, yo, pred, 16)
+	for n := range 16 {
+		coeff := vp8Dequantize(yLevels[n], e.y1)
+		coeff[0] = dcs[n]
+		vp8IDCT(&coeff, yr, e.rec.YStride, yo+4*(n/4)*e.rec.YStride+4*(n%4))
+	}
+
+	// Both chroma planes share a prediction mode.
+	co := 8*mby*e.src.CStride + 8*mbx
+	cbEdges := vp8EdgesOf(e.rec.Cb, e.rec.CStride, co, 8, mbx, mby)
+	crEdges := vp8EdgesOf(e.rec.Cr, e.rec.CStride, co, 8, mbx, mby)
+	cMode := vp8BestMode(8, mbx, mby,
+		vp8Block{cbEdges, e.src.Cb[co:], e.src.CStride},
+		vp8Block{crEdges, e.src.Cr[co:], e.src.CStride})
+	var cLevels [8][16]int32
+	for p, plane := range [2]struct {
+		src, rec []uint8
+		edges    vp8Edges
+	}{{e.src.Cb, e.rec.Cb, cbEdges}, {e.src.Cr, e.rec.Cr, crEdges}} {
+		pred := vp8Predict(cMode, 8, mbx, mby, plane.edges)
+		vp8Fill(plane.rec, e.rec.CStride, co, pred, 8)
+		for n := range 4 {
+			off := 4*(n/2)*e.src.CStride + 4*(n%2)
+			coeff := vp8FDCT(vp8Residual(plane.src, e.src.CStride, co+off, pred, 8, 4*(n/2), 4*(n%2)))
+			for z := range 16 {
+				cLevels[4*p+n][z] = vp8Quantize(coeff[z], e.uv[btoi(z > 0)], z == 0)
+			}
+			deq := vp8Dequantize(cLevels[4*p+n], e.uv)
+			vp8IDCT(&deq, plane.rec, e.rec.CStride, co+off)
+		}
+	}
+
+	e.modes.put(true, 145) // the luma is predicted as a whole
+	switch yMode {
+	case vp8PredDC:
+		e.modes.put(false, 156)
+		e.modes.put(false, 163)
+	case vp8PredVE:
+		e.modes.put(false, 156)
+		e.modes.put(true, 163)
+	case vp8PredHE:
+		e.modes.put(true, 156)
+		e.modes.put(false, 128)
+	case vp8PredTM:
+		e.modes.put(true, 156)
+		e.modes.put(true, 128)
+	}
+	e.modes.put(cMode != vp8PredDC, 142)
+	if cMode != vp8PredDC {
+		e.modes.put(cMode != vp8PredVE, 114)
+		if cMode != vp8PredVE {
+			e.modes.put(cMode == vp8PredTM, 183)
+		}
+	}
+
+	up, left := &e.upNz[mbx], &e.leftNz
+	nz := e.tokens.putCoeffs(&vp8TokenProb[1], left.y2+up.y2, &y2Levels, 0)
+	left.y2, up.y2 = nz, nz
+	for n := range 16 {
+		x, y := n%4, n/4
+		nz := e.tokens.putCoeffs(&vp8TokenProb[0], left.y[y]+up.y[x], &yLevels[n], 1)
+		left.y[y], up.y[x] = nz, nz
+	}
+	for n := range 8 {
+		// U's blocks use the first two entries of each context, V's the
+		// last two.
+		x, y := n/4*2+n%2, n/4*2+n%4/2
+		nz := e.tokens.putCoeffs(&vp8TokenProb[2], left.c[y]+up.c[x], &cLevels[n], 0)
+		left.c[y], up.c[x] = nz, nz
+	}
+}
+
+// vp8Edges are the reconstructed pixels a macroblock is predicted from.
+type vp8Edges struct {
+	above, left [16]uint8
+	corner      uint8
+}
+
+// vp8EdgesOf returns the edges of the size by size block at offset o of a
+// plane, standing in for the ones outside the frame like decoders do.
+func vp8EdgesOf(plane []uint8, stride, o, size, mbx, mby int) vp8Edges {
+	var e vp8Edges
+	for i := range size {
+		e.above[i], e.left[i] = 0x7f, 0x81
+		if mby > 0 {
+			e.above[i] = plane[o-stride+i]
+		}
+		if mbx > 0 {
+			e.left[i] = plane[o+i*stride-1]
+		}
+	}
+	switch {
+	case mby == 0:
+		e.corner = 0x7f
+	case mbx == 0:
+		e.corner = 0x81
+	default:
+		e.corner = plane[o-stride-1]
+	}
+	return e
+}
+
+// vp8Predict returns the size by size prediction of a block in mode.
+func vp8Predict(mode, size, mbx, mby int, e vp8Edges) []uint8 {
+	out := make([]uint8, size*size)
+	for y := range size {
+		for x := range size {
+			switch mode {
+			case vp8PredVE:
+				out[y*size+x] = e.above[x]
+			case vp8PredHE:
+				out[y*size+x] = e.left[y]
+			case vp8PredTM:
+				out[y*size+x] = clip8(int(e.left[y]) + int(e.above[x]) - int(e.corner))
+			}
+		}
+	}
+	if mode != vp8PredDC {
+		return out
+	}
+	// DC averages the edges inside the frame.
+	shift := 3
+	if size == 16 {
+		shift = 4
+	}
+	sum, n := 0, 0
+	if mby > 0 {
+		for _, v := range e.above[:size] {
+			sum += int(v)
+		}
+		n++
+	}
+	if mbx > 0 {
+		for _, v := range e.left[:size] {
+			sum += int(v)
+		}
+		n++
+	}
+	dc := uint8(0x80)
+	if n > 0 {
+		dc = uint8((sum + n<<(shift-1)) >> (shift + n - 1))
+	}
+	for i := range out {
+		out[i] = dc
+	}
+	return out
+}
+
+// vp8Block is the source of a block and the edges it is predicted from.
+type vp8Block struct {
+	edges  vp8Edges
+	src    []uint8
+	stride int
+}
+
+// vp8BestMode returns the mode whose predictions are closest to the
+// blocks, which are size by size.
+func vp8BestMode(size, mbx, mby int, blocks ...vp8Block) int {
+	best, bestCost := vp8PredDC, -1
+	for mode := vp8PredDC; mode <= vp8PredTM; mode++ {
+		cost := 0
+		for _, b := range blocks {
+			pred := vp8Predict(mode, size, mbx, mby, b.edges)
+			for y := range size {
+				for x := range size {
+					cost += abs(int(b.src[y*b.stride+x]) - int(pred[y*size+x]))
+				}
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+		}
+	}
+	return best
+}
+
+// vp8Residual returns the 4x4 block at offset o of src less the prediction
+// of the block it is in, starting at row y and column x.
+func vp8Residual(src []uint8, stride, o int, pred []uint8, size, y, x int) [16]int32 {
+	var r [16]int32
+	for j := range 4 {
+		for i := range 4 {
+			r[j*4+i] = int32(src[o+j*stride+i]) - int32(pred[(y+j)*size+x+i])
+		}
+	}
+	return r
+}
+
+func vp8Fill(plane []uint8, stride, o int, pred []uint8, size int) {
+	for y := range size {
+		copy(plane[o+y*stride:o+y*stride+size], pred[y*size:(y+1)*size])
+	}
+}
+
+// vp8Quantize quantizes c by q, rounding DC coefficients to the nearest
+// level and shrinking AC ones a little towards zero, which costs fewer bits.
+func vp8Quantize(c, q int32, dc bool) int32 {
+	bias := q * 3 / 8
+	if dc {
+		bias = q / 2
+	}
+	level := min((abs(c)+bias)/q, vp8MaxLevel)
+	if c < 0 {
+		return -level
+	}
+	return level
+}
+
+// vp8Dequantize scales levels back up as decoders do.
+func vp8Dequantize(levels [16]int32, q [2]int32) [16]int16 {
+	var c [16]int16
+	for z, l := range levels {
+		c[z] = int16(l * q[btoi(z > 0)])
+	}
+	return c
+}
+
+// vp8FDCT is the forward transform libvpx pairs with the spec's inverse
+// DCT.
+func vp8FDCT(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := range 4 {
+		r := in[i*4:]
+		a, b := (r[0]+r[3])*8, (r[1]+r[2])*8
+		c, d := (r[1]-r[2])*8, (r[0]-r[3])*8
+		tmp[i*4+0] = a + b
+		tmp[i*4+2] = a - b
+		tmp[i*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[i*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := range 4 {
+		a, b := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		c, d := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217+d*5352+12000)>>16 + int32(btoi(d != 0))
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// vp8FWHT is the forward Walsh-Hadamard transform libvpx pairs with the
+// spec's inverse one.
+func vp8FWHT(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := range 4 {
+		r := in[i*4:]
+		a, d := (r[0]+r[2])*4, (r[1]+r[3])*4
+		c, b := (r[1]-r[3])*4, (r[0]-r[2])*4
+		tmp[i*4+0] = a + d + int32(btoi(a != 0))
+		tmp[i*4+1] = b + c
+		tmp[i*4+2] = b - c
+		tmp[i*4+3] = a - d
+	}
+	for i := range 4 {
+		a, d := tmp[i]+tmp[8+i], tmp[4+i]+tmp[12+i]
+		c, b := tmp[4+i]-tmp[12+i], tmp[i]-tmp[8+i]
+		for k, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			if v < 0 {
+				v++
+			}
+			out[4*k+i] = (v + 3) >> 3
+		}
+	}
+	return out
+}
+
+// vp8IWHT is the spec's inverse Walsh-Hadamard transform, returning the DC
+// coefficient of each luma block.
+func vp8IWHT(in [16]int16) [16]int16 {
+	var m [16]int32
+	for i := range 4 {
+		a0 := int32(in[0+i]) + int32(in[12+i])
+		a1 := int32(in[4+i]) + int32(in[8+i])
+		a2 := int32(in[4+i]) - int32(in[8+i])
+		a3 := int32(in[0+i]) - int32(in[12+i])
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	var out [16]int16
+	for i := range 4 {
+		dc := m[0+i*4] + 3
+		a0 := dc + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := dc - m[3+i*4]
+		out[i*4+0] = int16((a0 + a1) >> 3)
+		out[i*4+1] = int16((a3 + a2) >> 3)
+		out[i*4+2] = int16((a0 - a1) >> 3)
+		out[i*4+3] = int16((a3 - a2) >> 3)
+	}
+	return out
+}
+
+// vp8IDCT is the spec's inverse DCT, adding the 4x4 block to the one at
+// offset o of plane.
+func vp8IDCT(in *[16]int16, plane []uint8, stride, o int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := range 4 {
+		a := int32(in[i]) + int32(in[8+i])
+		b := int32(in[i]) - int32(in[8+i])
+		c := (int32(in[4+i])*c2)>>16 - (int32(in[12+i])*c1)>>16
+		d := (int32(in[4+i])*c1)>>16 + (int32(in[12+i])*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a, b := dc+m[2][j], dc-m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		row := plane[o+j*stride:]
+		for i, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			row[i] = clip8(int(row[i]) + int(v>>3))
+		}
+	}
+}
+
+// vp8Writer is the boolean entropy encoder of RFC 6386 section 7.
+type vp8Writer struct {
+	out      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func (w *vp8Writer) init() {
+	w.rng, w.bitCount = 255, 24
+}
+
+// put codes bit, which is false with probability prob/256.
+func (w *vp8Writer) put(bit bool, prob uint8) {
+	split := 1 + (w.rng-1)*uint32(prob)>>8
+	if bit {
+		w.bottom += split
+		w.rng -= split
+	} else {
+		w.rng = split
+	}
+	for w.rng < 128 {
+		w.rng <<= 1
+		if w.bottom&(1<<31) != 0 {
+			w.carry()
+		}
+		w.bottom <<= 1
+		if w.bitCount--; w.bitCount == 0 {
+			w.out = append(w.out, byte(w.bottom>>24))
+			w.bottom &= 1<<24 - 1
+			w.bitCount = 8
+		}
+	}
+}
+
+func (w *vp8Writer) carry() {
+	for i := len(w.out) - 1; i >= 0; i-- {
+		if w.out[i]++; w.out[i] != 0 {
+			return
+		}
+	}
+}
+
+// putLiteral codes the n low bits of v, most significant first.
+func (w *vp8Writer) putLiteral(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.put(v>>i&1 == 1, 128)
+	}
+}
+
+func (w *vp8Writer) flush() []byte {
+	c, v := w.bitCount, w.bottom
+	if v&(1<<(32-c)) != 0 {
+		w.carry()
+	}
+	v <<= c
+	for range 4 {
+		w.out = append(w.out, byte(v>>24))
+		v <<= 8
+	}
+	return w.out
+}
+
+// putCoeffs codes the levels of a 4x4 block from the first one on, in
+// zigzag order, and reports whether any of them was coded.
+func (w *vp8Writer) putCoeffs(probs *[8][3][11]uint8, ctx uint8, levels *[16]int32, first int) uint8 {
+	last := -1
+	for n := 15; n >= first; n-- {
+		if levels[vp8Zigzag[n]] != 0 {
+			last = n
+			break
+		}
+	}
+	p := &probs[vp8Bands[first]][ctx]
+	w.put(last >= 0, p[0])
+	if last < 0 {
+		return 0
+	}
+	for n := first; n < 16; {
+		v := levels[vp8Zigzag[n]]
+		n++
+		if v == 0 {
+			w.put(false, p[1])
+			p = &probs[vp8Bands[n]][0]
+			continue
+		}
+		w.put(true, p[1])
+		w.putLevel(p, abs(v))
+		p = &probs[vp8Bands[n]][min(abs(v), 2)]
+		w.put(v < 0, 128)
+		if n == 16 {
+			break
+		}
+		w.put(n <= last, p[0])
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
+
+// putLevel codes a level of at least one with the token tree of RFC 6386
+// section 13.2.
+func (w *vp8Writer) putLevel(p *[11]uint8, v int32) {
+	w.put(v > 1, p[2])
+	if v == 1 {
+		return
+	}
+	w.put(v > 4, p[3])
+	if v <= 4 {
+		w.put(v > 2, p[4])
+		if v > 2 {
+			w.put(v == 4, p[5])
+		}
+		return
+	}
+	w.put(v > 10, p[6])
+	if v <= 10 {
+		w.put(v > 6, p[7])
+		if v <= 6 {
+			w.put(v == 6, 159)
+		} else {
+			w.put((v-7)&2 != 0, 165)
+			w.put((v-7)&1 != 0, 145)
+		}
+		return
+	}
+	cat := 0
+	for cat < 3 && v >= 3+8<<(cat+1) {
+		cat++
+	}
+	w.put(cat >= 2, p[8])
+	w.put(cat&1 == 1, p[9+cat>>1])
+	extra, tab := v-3-8<<cat, vp8CatProb[cat]
+	for i, prob := range tab {
+		w.put(extra>>(len(tab)-1-i)&1 == 1, prob)
+	}
+}
+
+func clip8(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func abs[T int | int32](v T) T {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
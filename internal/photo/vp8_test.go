@@ -0,0 +1,95 @@
+package photo
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"golang.org/x/image/vp8"
+	"golang.org/x/image/webp"
+)
+
+// makePhoto draws smooth gradients, hard edges and grain, an odd size so
+// the last macroblocks are partly padding.
+func makePhoto(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			r := 40 + 160*x/w + rng.IntN(24)
+			g := 60 + 120*y/h + rng.IntN(24)
+			b := 200 - 100*(x+y)/(w+h)
+			if (x/37+y/29)%3 == 0 {
+				r, g = 250-r/4, 230-g/4
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), 0xff})
+		}
+	}
+	return img
+}
+
+func TestEncodeVP8_MatchesDecoder(t *testing.T) {
+	src := makePhoto(101, 67)
+	for _, q := range []int{0, vp8Quantizer, 127} {
+		frame, rec, err := encodeVP8(src, q, 0)
+		if err != nil {
+			t.Fatalf("q=%d: encode: %v", q, err)
+		}
+		d := vp8.NewDecoder()
+		d.Init(bytes.NewReader(frame), len(frame))
+		fh, err := d.DecodeFrameHeader()
+		if err != nil {
+			t.Fatalf("q=%d: header: %v", q, err)
+		}
+		if fh.Width != 101 || fh.Height != 67 {
+			t.Fatalf("q=%d: got %dx%d", q, fh.Width, fh.Height)
+		}
+		got, err := d.DecodeFrame()
+		if err != nil {
+			t.Fatalf("q=%d: decode: %v", q, err)
+		}
+		for y := range 67 {
+			for x := range 101 {
+				gy, gcb, gcr := got.YCbCrAt(x, y).Y, got.YCbCrAt(x, y).Cb, got.YCbCrAt(x, y).Cr
+				w := rec.YCbCrAt(x, y)
+				if gy != w.Y || gcb != w.Cb || gcr != w.Cr {
+					t.Fatalf("q=%d: pixel (%d, %d) decoded as %v, encoder reconstructed %v", q, x, y, got.YCbCrAt(x, y), w)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeLossyWebP(t *testing.T) {
+	src := makePhoto(320, 240)
+	out, err := encodeLossyWebP(src)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	img, err := webp.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got, ok := img.(*image.YCbCr)
+	if !ok || got.Rect != src.Rect {
+		t.Fatalf("decoded %T of %v", img, img.Bounds())
+	}
+	want := toYCbCr420(src, 320, 240)
+	var sse float64
+	for i, v := range got.Y {
+		d := float64(v) - float64(want.Y[i])
+		sse += d * d
+	}
+	if psnr := 10 * math.Log10(255*255/(sse/float64(len(got.Y)))); psnr < 35 {
+		t.Errorf("luma PSNR = %.1f dB, want at least 35", psnr)
+	}
+}
+
+func TestEncodeVP8_RejectsOversizedImages(t *testing.T) {
+	if _, _, err := encodeVP8(image.NewNRGBA(image.Rect(0, 0, 1<<14, 1)), vp8Quantizer, 0); err == nil {
+		t.Error("expected an error for an image wider than VP8 allows")
+	}
+}
@@ -0,0 +1,214 @@
+// Package query implements the small filter language used by smart albums.
+//
+// A query is a whitespace-separated list of terms that must all match:
+//
+//	taken:2019-06-01..2019-09-01 model:"ILCE-7M3" source:/photos name:IMG_*.png
+//
+// taken accepts a year, month or day, or an inclusive range of them with
+// either end left open. model, source and path match case-insensitive
+// substrings, name matches the file name against a glob, and a bare word
+// matches the file name or folder path.
+package query
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+type Query struct {
+	terms []term
+}
+
+type term struct {
+	field string
+	value string
+	from  time.Time
+	to    time.Time
+}
+
+// Parse compiles s into a Query. An empty query matches every photo.
+func Parse(s string) (*Query, error) {
+	words, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{}
+	for _, w := range words {
+		field, value, ok := strings.Cut(w, ":")
+		if !ok {
+			field, value = "", w
+		}
+		t := term{field: strings.ToLower(field), value: strings.ToLower(value)}
+		if value == "" {
+			return nil, fmt.Errorf("%w: empty value for %q", domain.ErrInvalidQuery, field)
+		}
+		switch t.field {
+		case "", "model", "source", "path":
+		case "name":
+			if _, err := path.Match(t.value, ""); err != nil {
+				return nil, fmt.Errorf("%w: bad pattern %q", domain.ErrInvalidQuery, value)
+			}
+		case "taken":
+			if t.from, t.to, err = ParseRange(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q", domain.ErrInvalidQuery, field)
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+func (q *Query) Match(rec domain.PhotoRecord) bool {
+	for _, t := range q.terms {
+		if !t.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Words returns the bare words of q, the terms without a field.
+func (q *Query) Words() []string {
+	var words []string
+	for _, t := range q.terms {
+		if t.field == "" {
+			words = append(words, t.value)
+		}
+	}
+	return words
+}
+
+// Fielded returns q without its bare words.
+func (q *Query) Fielded() *Query {
+	out := &Query{}
+	for _, t := range q.terms {
+		if t.field != "" {
+			out.terms = append(out.terms, t)
+		}
+	}
+	return out
+}
+
+// Filter returns the records that match q, preserving their order.
+func (q *Query) Filter(recs []domain.PhotoRecord) []domain.PhotoRecord {
+	var out []domain.PhotoRecord
+	for _, rec := range recs {
+		if q.Match(rec) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func (t term) match(rec domain.PhotoRecord) bool {
+	switch t.field {
+	case "taken":
+		if rec.TakenAt == nil {
+			return false
+		}
+		at := WallClock(*rec.TakenAt)
+		return !at.Before(t.from) && at.Before(t.to)
+	case "model":
+		return contains(rec.Model, t.value)
+	case "source":
+		return contains(rec.SourceID, t.value)
+	case "path":
+		return contains(path.Dir(rec.Path), t.value)
+	case "name":
+		ok, _ := path.Match(t.value, strings.ToLower(path.Base(rec.Path)))
+		return ok
+	default:
+		return contains(rec.Path, t.value)
+	}
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), substr)
+}
+
+// WallClock drops the zone so that EXIF times, which carry no reliable
+// offset, compare against dates as written.
+func WallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// ParseRange parses "A", "A..B", "A.." or "..B" into a half-open interval
+// covering the whole periods named by A and B.
+func ParseRange(s string) (time.Time, time.Time, error) {
+	lo, hi, isRange := strings.Cut(s, "..")
+	if !isRange {
+		hi = lo
+	}
+	from, to := time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if lo != "" {
+		start, _, err := parsePeriod(lo)
+		if err != nil {
+			return from, to, err
+		}
+		from = start
+	}
+	if hi != "" {
+		_, end, err := parsePeriod(hi)
+		if err != nil {
+			return from, to, err
+		}
+		to = end
+	}
+	if lo == "" && hi == "" {
+		return from, to, fmt.Errorf("%w: empty date range", domain.ErrInvalidQuery)
+	}
+	return from, to, nil
+}
+
+// parsePeriod parses a year, month or day and returns its start and the start
+// of the next one.
+func parsePeriod(s string) (time.Time, time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse("2006-01", s); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.Parse("2006", s); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%w: bad date %q", domain.ErrInvalidQuery, s)
+}
+
+// split breaks s into words on whitespace; double quotes group words and are
+// removed.
+func split(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inQuote, inWord := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inWord = true
+		case unicode.IsSpace(r) && !inQuote:
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("%w: unterminated quote", domain.ErrInvalidQuery)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+func record(sourceID, p, model string, takenAt string) domain.PhotoRecord {
+	rec := domain.PhotoRecord{SourceID: sourceID, Path: p, Model: model}
+	if takenAt != "" {
+		t, _ := time.Parse(time.RFC3339, takenAt)
+		rec.TakenAt = &t
+	}
+	return rec
+}
+
+func TestQuery_Match(t *testing.T) {
+	summer := record("/photos", "2019/trip/IMG_0001.png", "ILCE-7M3", "2019-07-14T10:00:00Z")
+	boundary := record("/photos", "2019/trip/IMG_0002.jpg", "ILCE-7M3", "2019-09-01T23:59:00Z")
+	undated := record("/backup", "misc/scan.png", "", "")
+
+	tests := []struct {
+		name  string
+		query string
+		rec   domain.PhotoRecord
+		want  bool
+	}{
+		{"empty matches all", "", undated, true},
+		{"date range", "taken:2019-06-01..2019-09-01", summer, true},
+		{"date range includes end day", "taken:2019-06-01..2019-09-01", boundary, true},
+		{"date range excludes", "taken:2020-01-01..2020-02-01", summer, false},
+		{"open-ended range", "taken:2019-07..", summer, true},
+		{"month", "taken:2019-07", summer, true},
+		{"year", "taken:2018", summer, false},
+		{"undated never matches taken", "taken:2019", undated, false},
+		{"model substring", "model:ilce", summer, true},
+		{"quoted value", `model:"ILCE-7M3" source:/photos`, summer, true},
+		{"source mismatch", "source:/backup", summer, false},
+		{"name glob", "name:IMG_*.png", summer, true},
+		{"name glob mismatch", "name:IMG_*.png", boundary, false},
+		{"path", "path:2019/trip", summer, true},
+		{"bare word", "scan", undated, true},
+		{"all terms must match", "model:ILCE taken:2018", summer, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.query, err)
+			}
+			if got := q.Match(tt.rec); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"color:red",
+		"taken:yesterday",
+		"taken:..",
+		`model:"unterminated`,
+		"name:[",
+		"model:",
+	} {
+		if _, err := Parse(s); !errors.Is(err, domain.ErrInvalidQuery) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalidQuery", s, err)
+		}
+	}
+}
+
+func TestQuery_FilterPreservesOrder(t *testing.T) {
+	recs := []domain.PhotoRecord{
+		record("/a", "1.jpg", "X", ""),
+		record("/a", "2.jpg", "Y", ""),
+		record("/a", "3.jpg", "X", ""),
+	}
+	q, _ := Parse("model:x")
+
+	got := q.Filter(recs)
+	if len(got) != 2 || got[0].Path != "1.jpg" || got[1].Path != "3.jpg" {
+		t.Errorf("Filter() = %+v, want 1.jpg and 3.jpg", got)
+	}
+}
@@ -0,0 +1,139 @@
+// Package search is an in-memory inverted index over photo records.
+//
+// File and folder names, camera models, keywords and captions are split into
+// lowercase words. A search word matches every indexed word it is a prefix
+// of, so "sun" finds "sunset". Fielded query terms such as taken: are checked
+// against the candidates the words leave over.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+)
+
+type Index struct {
+	records  []domain.PhotoRecord
+	words    []string         // sorted, for prefix lookups
+	postings map[string][]int // word -> ascending record positions
+}
+
+// NewIndex indexes records, keeping their order for results.
+func NewIndex(records []domain.PhotoRecord) *Index {
+	x := &Index{records: records, postings: make(map[string][]int)}
+	for i, rec := range records {
+		seen := make(map[string]bool)
+		for _, w := range recordWords(rec) {
+			if seen[w] {
+				continue
+			}
+			seen[w] = true
+			x.postings[w] = append(x.postings[w], i)
+		}
+	}
+	x.words = make([]string, 0, len(x.postings))
+	for w := range x.postings {
+		x.words = append(x.words, w)
+	}
+	sort.Strings(x.words)
+	return x
+}
+
+// Search returns the records matching q in index order. A word with no
+// letters or digits, such as "-", matches nothing, as no indexed word holds
+// it.
+func (x *Index) Search(q *query.Query) []domain.PhotoRecord {
+	var candidates []int
+	all := true
+	for _, word := range q.Words() {
+		tokens := tokenize(word)
+		if len(tokens) == 0 {
+			return nil
+		}
+		for _, w := range tokens {
+			matches := x.prefixed(w)
+			if all {
+				candidates, all = matches, false
+			} else {
+				candidates = intersect(candidates, matches)
+			}
+		}
+	}
+
+	fielded := q.Fielded()
+	if all {
+		return fielded.Filter(x.records)
+	}
+	var out []domain.PhotoRecord
+	for _, i := range candidates {
+		if fielded.Match(x.records[i]) {
+			out = append(out, x.records[i])
+		}
+	}
+	return out
+}
+
+// prefixed returns the positions of records with a word starting with prefix.
+func (x *Index) prefixed(prefix string) []int {
+	start := sort.SearchStrings(x.words, prefix)
+	var lists [][]int
+	for _, w := range x.words[start:] {
+		if !strings.HasPrefix(w, prefix) {
+			break
+		}
+		lists = append(lists, x.postings[w])
+	}
+	return union(lists)
+}
+
+func recordWords(rec domain.PhotoRecord) []string {
+	words := tokenize(rec.Path)
+	words = append(words, tokenize(rec.Model)...)
+	for _, k := range rec.Keywords {
+		words = append(words, tokenize(k)...)
+	}
+	return append(words, tokenize(rec.Caption)...)
+}
+
+// tokenize lowercases s and splits it on anything but letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func union(lists [][]int) []int {
+	seen := make(map[int]bool)
+	var out []int
+	for _, l := range lists {
+		for _, i := range l {
+			if !seen[i] {
+				seen[i] = true
+				out = append(out, i)
+			}
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+// intersect returns the positions in both ascending lists.
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
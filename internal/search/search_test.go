@@ -0,0 +1,67 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+)
+
+func records() []domain.PhotoRecord {
+	may := time.Date(2023, 5, 20, 9, 0, 0, 0, time.UTC)
+	june := time.Date(2023, 6, 2, 9, 0, 0, 0, time.UTC)
+	return []domain.PhotoRecord{
+		{SourceID: "/a", Path: "2023/Kenting/IMG_0001.jpg", Model: "X100V", TakenAt: &may, Keywords: []string{"beach"}},
+		{SourceID: "/a", Path: "2023/Kenting/IMG_0002.jpg", Model: "ILCE-7M3", TakenAt: &june, Caption: "Sunset over the sea"},
+		{SourceID: "/b", Path: "scans/family.png"},
+	}
+}
+
+func search(t *testing.T, q string) []string {
+	t.Helper()
+	parsed, err := query.Parse(q)
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", q, err)
+	}
+	var paths []string
+	for _, rec := range NewIndex(records()).Search(parsed) {
+		paths = append(paths, rec.Path)
+	}
+	return paths
+}
+
+func TestIndex_Search(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"folder", "kenting", []string{"2023/Kenting/IMG_0001.jpg", "2023/Kenting/IMG_0002.jpg"}},
+		{"file name", "img_0002", []string{"2023/Kenting/IMG_0002.jpg"}},
+		{"model", "x100v", []string{"2023/Kenting/IMG_0001.jpg"}},
+		{"keyword", "beach", []string{"2023/Kenting/IMG_0001.jpg"}},
+		{"caption prefix", "suns", []string{"2023/Kenting/IMG_0002.jpg"}},
+		{"all words", "kenting sea", []string{"2023/Kenting/IMG_0002.jpg"}},
+		{"date", "taken:2023-05", []string{"2023/Kenting/IMG_0001.jpg"}},
+		{"word and date", "kenting taken:2023-06", []string{"2023/Kenting/IMG_0002.jpg"}},
+		{"no match", "tokyo", nil},
+		{"punctuation", "!!", nil},
+		{"punctuation and word", "kenting _", nil},
+		{"empty", "", []string{"2023/Kenting/IMG_0001.jpg", "2023/Kenting/IMG_0002.jpg", "scans/family.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := search(t, tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
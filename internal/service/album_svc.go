@@ -1,11 +1,31 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+)
+
+// libraryAlbumUID is the unlisted album of every indexed photo. Its tokens are
+// photo refs, so it serves any photo without naming an album it is in.
+const libraryAlbumUID = "library:all"
+
+const (
+	// maxSnapshots bounds the listings kept for later pages.
+	maxSnapshots = 32
+	// snapshotTTL is how long a listing is kept for its later pages.
+	snapshotTTL = time.Hour
 )
 
 type SourceReader interface {
@@ -14,90 +34,885 @@ type SourceReader interface {
 }
 
 type AlbumService struct {
+	mu           sync.RWMutex
 	sourceReader SourceReader
 	albums       map[string]*domain.Album
 	strategy     domain.AlbumStrategy
 	albumMapper  domain.Mapper
 	maxDepth     int
+	index        domain.PhotoIndex
+	flags        domain.FlagReader
+	duplicates   domain.DuplicateFinder
+	virtual      []domain.VirtualAlbumSource
+	observers    []domain.IndexObserver
+	orders       map[string]domain.PhotoListStrategy
+	// defaultOrders maps album names to the order they play in by default.
+	defaultOrders map[string]string
+	// covers maps album names to the file name of their cover photo.
+	covers map[string]string
+	// originals reports whether a source's original files may be served; nil
+	// allows every source.
+	originals func(sourceID string) bool
+	// videos reports whether a source's videos may be streamed; nil allows
+	// every source.
+	videos func(sourceID string) bool
+	// rawPairs is the domain.RawPairs* setting deciding which file of a
+	// RAW+JPEG pair albums show.
+	rawPairs string
+	// metadata returns the metadata policy of a source; nil serves metadata
+	// as stored.
+	metadata func(sourceID string) domain.MetadataPolicy
+
+	// snapshots keeps multi-page listings by album key and snapshot name, so
+	// that later pages read the order the first one was cut from; orders
+	// such as fresh change as the slideshow reports photos shown.
+	snapMu    sync.Mutex
+	snapshots map[string]listingSnapshot
+}
+
+type listingSnapshot struct {
+	photos []domain.PhotoInfo
+	taken  time.Time
 }
 
 func NewAlbumService(sourceReader SourceReader, albums map[string]*domain.Album, strategy domain.AlbumStrategy, mapper domain.Mapper, maxDepth int) *AlbumService {
 	return &AlbumService{sourceReader: sourceReader, albums: albums, strategy: strategy, albumMapper: mapper, maxDepth: maxDepth}
 }
 
+// SetOriginalAccess sets the check deciding which sources serve their
+// original files through OpenPhoto.
+func (s *AlbumService) SetOriginalAccess(allowed func(sourceID string) bool) {
+	s.originals = allowed
+}
+
+// SetVideoAccess sets the check deciding which sources stream their videos
+// through OpenVideo.
+func (s *AlbumService) SetVideoAccess(allowed func(sourceID string) bool) {
+	s.videos = allowed
+}
+
+// SetMetadataPolicy sets the metadata policy of each source, which
+// MetadataPolicy reports for its photos.
+func (s *AlbumService) SetMetadataPolicy(policy func(sourceID string) domain.MetadataPolicy) {
+	s.metadata = policy
+}
+
+// SetRawPairs sets which file of a RAW+JPEG pair albums show: both, only
+// the JPEG or only the RAW file. It applies to sources registered and virtual
+// albums built afterwards.
+func (s *AlbumService) SetRawPairs(keep string) {
+	s.rawPairs = keep
+}
+
+// SetIndex sets the PhotoIndex refreshed whenever a source is scanned. An
+// album strategy that is an IndexConsumer gets to query it too.
+func (s *AlbumService) SetIndex(index domain.PhotoIndex) {
+	s.index = index
+	if c, ok := s.strategy.(domain.IndexConsumer); ok {
+		c.SetIndex(index)
+	}
+	for _, order := range s.orders {
+		if c, ok := order.(domain.IndexConsumer); ok {
+			c.SetIndex(index)
+		}
+	}
+}
+
+// SetListStrategies sets the strategies selectable by name through
+// ListOptions.Order and SetDefaultOrder.
+func (s *AlbumService) SetListStrategies(orders map[string]domain.PhotoListStrategy) {
+	s.orders = orders
+	if s.index != nil {
+		s.SetIndex(s.index)
+	}
+}
+
+// SetDefaultOrder makes the albums named albumName play in the given order
+// unless a listing asks for another.
+func (s *AlbumService) SetDefaultOrder(albumName, order string) error {
+	if _, ok := s.orders[order]; !ok {
+		return domain.ErrInvalidOrder
+	}
+	if s.defaultOrders == nil {
+		s.defaultOrders = make(map[string]string)
+	}
+	s.defaultOrders[albumName] = order
+	return nil
+}
+
+// SetCover makes the photo with the given file name or token the cover of the
+// albums named albumName.
+func (s *AlbumService) SetCover(albumName, photo string) {
+	if s.covers == nil {
+		s.covers = make(map[string]string)
+	}
+	s.covers[albumName] = photo
+}
+
+// SetFlagReader sets the FlagReader used to filter listings by the user's
+// favorites, ratings and hidden marks.
+func (s *AlbumService) SetFlagReader(flags domain.FlagReader) {
+	s.flags = flags
+}
+
+// SetDuplicateFinder sets the DuplicateFinder used to collapse duplicate
+// photos in listings.
+func (s *AlbumService) SetDuplicateFinder(f domain.DuplicateFinder) {
+	s.duplicates = f
+}
+
+// AddIndexObserver registers an observer notified after every scan or source
+// removal with the full set of indexed records.
+func (s *AlbumService) AddIndexObserver(o domain.IndexObserver) {
+	s.observers = append(s.observers, o)
+}
+
+// AddVirtualSource registers a source of virtual albums, which are rebuilt
+// after every scan and on RefreshVirtualAlbums.
+func (s *AlbumService) AddVirtualSource(v domain.VirtualAlbumSource) {
+	s.virtual = append(s.virtual, v)
+}
+
 func (s *AlbumService) SyncAlbums(ctx context.Context) error {
+	s.mu.Lock()
 	for k := range s.albums {
 		delete(s.albums, k)
 	}
+	s.mu.Unlock()
 	for _, src := range s.sourceReader.AllSources() {
-		if err := s.RegisterAlbumsForSource(ctx, src); err != nil {
+		if err := s.registerSource(ctx, src); err != nil {
 			log.Printf("error syncing source %s: %v", src.ID, err)
 		}
 	}
-	return nil
+	s.notifyIndexChanged(ctx)
+	return s.RefreshVirtualAlbums(ctx)
 }
 
 func (s *AlbumService) RegisterAlbumsForSource(ctx context.Context, src *domain.Source) error {
+	if err := s.registerSource(ctx, src); err != nil {
+		return err
+	}
+	s.notifyIndexChanged(ctx)
+	return s.RefreshVirtualAlbums(ctx)
+}
+
+func (s *AlbumService) registerSource(ctx context.Context, src *domain.Source) error {
 	snaps, err := src.Provider.Walk(ctx, "", s.maxDepth)
 	if err != nil {
 		return err
 	}
+	// Index first so strategies that consult the index see this scan.
+	if s.index != nil {
+		if err := s.index.IndexSource(ctx, src, snaps); err != nil {
+			return err
+		}
+	}
 	albums, err := s.strategy.GenerateAlbums(ctx, snaps, src.ID)
 	if err != nil {
 		return err
 	}
+	for i := range albums {
+		albums[i].Photos = pairLivePhotos(s.dropRawPairs(albums[i].Photos))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for i := range albums {
 		s.albums[albums[i].UID] = &albums[i]
 	}
 	return nil
 }
 
+// dropRawPairs leaves out the file of each RAW+JPEG pair that rawPairs
+// hides. A pair is a RAW file and a JPEG in the same folder of the same
+// source whose names differ only in the extension.
+func (s *AlbumService) dropRawPairs(photos []domain.PhotoInfo) []domain.PhotoInfo {
+	if s.rawPairs != domain.RawPairsJPEG && s.rawPairs != domain.RawPairsRaw {
+		return photos
+	}
+	stem := func(p domain.PhotoInfo) string {
+		return p.SourceID + "\x00" + strings.TrimSuffix(p.Path, path.Ext(p.Path))
+	}
+	raws := make(map[string]bool)
+	jpegs := make(map[string]bool)
+	for _, p := range photos {
+		switch {
+		case domain.IsRaw(p.Path):
+			raws[stem(p)] = true
+		case domain.IsJPEG(p.Path):
+			jpegs[stem(p)] = true
+		}
+	}
+	kept := make([]domain.PhotoInfo, 0, len(photos))
+	for _, p := range photos {
+		if s.rawPairs == domain.RawPairsJPEG && domain.IsRaw(p.Path) && jpegs[stem(p)] {
+			continue
+		}
+		if s.rawPairs == domain.RawPairsRaw && domain.IsJPEG(p.Path) && raws[stem(p)] {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// pairLivePhotos folds the clip of each Live Photo into its still: a .MOV
+// next to an image of the same name is left out and becomes the image's
+// Motion.
+func pairLivePhotos(photos []domain.PhotoInfo) []domain.PhotoInfo {
+	stem := func(p domain.PhotoInfo) string {
+		return p.SourceID + "\x00" + strings.TrimSuffix(p.Path, path.Ext(p.Path))
+	}
+	clips := make(map[string]string)
+	for _, p := range photos {
+		if domain.IsLivePhotoClip(p.Path) {
+			clips[stem(p)] = p.Path
+		}
+	}
+	if len(clips) == 0 {
+		return photos
+	}
+	paired := make(map[string]bool)
+	for i := range photos {
+		if clip, ok := clips[stem(photos[i])]; ok && domain.IsImage(photos[i].Path) {
+			photos[i].Motion = clip
+			paired[stem(photos[i])] = true
+		}
+	}
+	kept := make([]domain.PhotoInfo, 0, len(photos))
+	for _, p := range photos {
+		if domain.IsLivePhotoClip(p.Path) && paired[stem(p)] {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
 func (s *AlbumService) RemoveAlbumsBySource(sourceID string) {
+	s.mu.Lock()
 	for k, album := range s.albums {
 		if album.SourceID == sourceID {
 			delete(s.albums, k)
 		}
 	}
+	s.mu.Unlock()
+	if s.index != nil {
+		s.index.RemoveSource(sourceID)
+	}
+	s.notifyIndexChanged(context.Background())
+	if err := s.RefreshVirtualAlbums(context.Background()); err != nil {
+		log.Printf("error refreshing virtual albums: %v", err)
+	}
 }
 
-func (s *AlbumService) ListAlbums(_ context.Context) []domain.AlbumItem {
-	items := make([]domain.AlbumItem, 0, len(s.albums))
-	for path, album := range s.albums {
-		items = append(items, domain.AlbumItem{Name: album.Name, Key: s.albumMapper.Encode(path)})
+func (s *AlbumService) notifyIndexChanged(ctx context.Context) {
+	if s.index == nil || len(s.observers) == 0 {
+		return
+	}
+	records := s.index.Records(ctx)
+	for _, o := range s.observers {
+		o.IndexChanged(ctx, records)
+	}
+}
+
+// RefreshVirtualAlbums rebuilds every virtual album, and the library album,
+// from the current index. A failing source is logged and keeps no albums.
+func (s *AlbumService) RefreshVirtualAlbums(ctx context.Context) error {
+	var records []domain.PhotoRecord
+	var albums []domain.Album
+	if s.index != nil {
+		records = s.index.Records(ctx)
+		library := domain.Album{UID: libraryAlbumUID, Name: "Library", Unlisted: true}
+		for _, rec := range records {
+			library.Photos = append(library.Photos, domain.PhotoInfo{SourceID: rec.SourceID, Path: rec.Path})
+		}
+		albums = append(albums, library)
+	}
+	for _, v := range s.virtual {
+		generated, err := v.VirtualAlbums(ctx, records)
+		if err != nil {
+			log.Printf("error building virtual albums: %v", err)
+			continue
+		}
+		albums = append(albums, generated...)
+	}
+	for i := range albums {
+		// The library album backs search results and streams, which may
+		// point at either file of a pair.
+		if albums[i].UID != libraryAlbumUID {
+			albums[i].Photos = pairLivePhotos(s.dropRawPairs(albums[i].Photos))
+		}
+		for j := range albums[i].Photos {
+			p := &albums[i].Photos[j]
+			p.AlbumName = albums[i].Name
+			p.FilePath = domain.EncodePhotoRef(s.albumMapper, p.SourceID, p.Path)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, album := range s.albums {
+		if album.IsVirtual() {
+			delete(s.albums, k)
+		}
 	}
+	for i := range albums {
+		s.albums[albums[i].UID] = &albums[i]
+	}
+	return nil
+}
+
+// LibraryKey returns the key of the unlisted album holding every indexed
+// photo. Its tokens are the photo refs made by domain.EncodePhotoRef.
+func (s *AlbumService) LibraryKey() string {
+	return s.albumMapper.Encode(libraryAlbumUID)
+}
+
+// ListAlbums returns every listed album sorted by name.
+func (s *AlbumService) ListAlbums(ctx context.Context) []domain.AlbumItem {
+	items, _ := s.FindAlbums(ctx, domain.AlbumFilter{})
 	return items
 }
 
-func (s *AlbumService) ListPhoto(ctx context.Context, albumKey string) ([]string, error) {
+// FindAlbums returns the listed albums matching f, sorted as f says.
+func (s *AlbumService) FindAlbums(ctx context.Context, f domain.AlbumFilter) ([]domain.AlbumItem, error) {
+	less, ok := albumSorts[f.Sort]
+	if !ok {
+		return nil, domain.ErrInvalidSort
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]domain.AlbumItem, 0, len(s.albums))
+	for uid, album := range s.albums {
+		if album.Unlisted {
+			continue
+		}
+		item := s.summarize(ctx, uid, album)
+		if matchAlbum(item, f) {
+			items = append(items, item)
+		}
+	}
+	// Albums are gathered from a map, so ties fall back to the name to keep
+	// the order the same from one call to the next.
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if f.Desc {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return byAlbumName(items[i], items[j])
+	})
+	return items, nil
+}
+
+var albumSorts = map[string]func(a, b domain.AlbumItem) bool{
+	"":                    byAlbumName,
+	domain.AlbumSortName:  byAlbumName,
+	domain.AlbumSortCount: func(a, b domain.AlbumItem) bool { return a.Count < b.Count },
+	domain.AlbumSortSize:  func(a, b domain.AlbumItem) bool { return a.Bytes < b.Bytes },
+	// Albums without capture dates sort before every dated one.
+	domain.AlbumSortDate: func(a, b domain.AlbumItem) bool {
+		if a.TakenFrom == nil || b.TakenFrom == nil {
+			return a.TakenFrom == nil && b.TakenFrom != nil
+		}
+		return a.TakenFrom.Before(*b.TakenFrom)
+	},
+}
+
+func byAlbumName(a, b domain.AlbumItem) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Key < b.Key
+}
+
+func matchAlbum(item domain.AlbumItem, f domain.AlbumFilter) bool {
+	if f.Name != "" && !strings.Contains(strings.ToLower(item.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	if item.Count < f.MinCount || item.Bytes < f.MinBytes {
+		return false
+	}
+	if !f.TakenFrom.IsZero() || !f.TakenTo.IsZero() {
+		if item.TakenFrom == nil {
+			return false
+		}
+		if !f.TakenTo.IsZero() && !query.WallClock(*item.TakenFrom).Before(f.TakenTo) {
+			return false
+		}
+		if query.WallClock(*item.TakenTo).Before(f.TakenFrom) {
+			return false
+		}
+	}
+	return true
+}
+
+// summarize describes album from the index, leaving hidden photos out, and the
+// capture dates of photos whose metadata policy hides them. The cover is the
+// photo configured with SetCover, else the first favorite, else the first
+// photo.
+func (s *AlbumService) summarize(ctx context.Context, uid string, album *domain.Album) domain.AlbumItem {
+	item := domain.AlbumItem{Name: album.Name, Key: s.albumMapper.Encode(uid), Source: album.SourceID}
+	configured, favorite, first := "", "", ""
+	for _, p := range album.Photos {
+		var rec domain.PhotoRecord
+		var flags domain.PhotoFlags
+		if s.index != nil {
+			rec, _ = s.index.Get(p.SourceID, p.Path)
+		}
+		if s.flags != nil && rec.Hash != "" {
+			flags = s.flags.Flags(ctx, rec)
+		}
+		if flags.Hidden {
+			continue
+		}
+		item.Count++
+		item.Bytes += rec.Size
+		if at := rec.TakenAt; at != nil && s.policy(p.SourceID).Keeps(domain.MetaTakenAt) {
+			if item.TakenFrom == nil || query.WallClock(*at).Before(query.WallClock(*item.TakenFrom)) {
+				item.TakenFrom = at
+			}
+			if item.TakenTo == nil || query.WallClock(*at).After(query.WallClock(*item.TakenTo)) {
+				item.TakenTo = at
+			}
+		}
+		if first == "" {
+			first = p.FilePath
+		}
+		if favorite == "" && flags.Favorite {
+			favorite = p.FilePath
+		}
+		if cover := s.covers[album.Name]; configured == "" && cover != "" && (p.FilePath == cover || path.Base(p.Path) == cover) {
+			configured = p.FilePath
+		}
+	}
+	item.Cover = cmp.Or(configured, favorite, first)
+	return item
+}
+
+// AlbumTree returns albums nested under their nearest ancestor album from the
+// same source, with children sorted by name.
+func (s *AlbumService) AlbumTree(ctx context.Context) []domain.AlbumNode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type dirKey struct{ sourceID, dir string }
+	byDir := make(map[dirKey]string, len(s.albums))
+	for uid, album := range s.albums {
+		if !album.IsVirtual() {
+			byDir[dirKey{album.SourceID, album.Dir}] = uid
+		}
+	}
+
+	children := make(map[string][]string)
+	var roots []string
+	for uid, album := range s.albums {
+		if album.Unlisted {
+			continue
+		}
+		parent := ""
+		for dir := album.Dir; dir != "" && parent == ""; {
+			dir = domain.ParentDir(dir)
+			parent = byDir[dirKey{album.SourceID, dir}]
+		}
+		if parent == "" {
+			roots = append(roots, uid)
+		} else {
+			children[parent] = append(children[parent], uid)
+		}
+	}
+
+	var build func(uids []string, parentKey string) []domain.AlbumNode
+	build = func(uids []string, parentKey string) []domain.AlbumNode {
+		nodes := make([]domain.AlbumNode, 0, len(uids))
+		for _, uid := range uids {
+			album := s.albums[uid]
+			key := s.albumMapper.Encode(uid)
+			nodes = append(nodes, domain.AlbumNode{
+				Name:      album.Name,
+				Key:       key,
+				ParentKey: parentKey,
+				Count:     len(s.listable(ctx, album.Photos, domain.ListOptions{})),
+				Children:  build(children[uid], key),
+			})
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+		return nodes
+	}
+	return build(roots, "")
+}
+
+func (s *AlbumService) album(albumKey string) (*domain.Album, error) {
 	albumUID, err := s.albumMapper.Decode(albumKey)
 	if err != nil {
 		return nil, domain.ErrAlbumNotFound
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	album, ok := s.albums[albumUID]
 	if !ok {
 		return nil, domain.ErrAlbumNotFound
 	}
+	return album, nil
+}
 
-	tokens := make([]string, 0, len(album.Photos))
-	for _, p := range album.Photos {
+func (s *AlbumService) ListPhoto(ctx context.Context, albumKey string, opts domain.ListOptions) ([]string, error) {
+	listed, err := s.AlbumPhotos(ctx, albumKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0, len(listed))
+	for _, p := range listed {
 		tokens = append(tokens, p.FilePath)
 	}
 	return tokens, nil
 }
 
+// ListPhotoPage returns up to limit photos of the listing starting at offset,
+// with the size of the whole listing.
+func (s *AlbumService) ListPhotoPage(ctx context.Context, albumKey string, opts domain.ListOptions, offset, limit int) (domain.PhotoPage, error) {
+	listed, ok := s.snapshot(albumKey, opts.Snapshot)
+	if !ok {
+		var err error
+		if listed, err = s.AlbumPhotos(ctx, albumKey, opts); err != nil {
+			return domain.PhotoPage{}, err
+		}
+		if opts.Snapshot != "" && offset+limit < len(listed) {
+			s.keepSnapshot(albumKey, opts.Snapshot, listed)
+		}
+	}
+	page := domain.PhotoPage{Total: len(listed), Photos: []domain.PhotoItem{}}
+	if offset >= len(listed) {
+		return page, nil
+	}
+	for _, p := range listed[offset:min(offset+limit, len(listed))] {
+		item := domain.PhotoItem{Key: p.FilePath, Name: path.Base(p.Path), Type: domain.MediaType(p.Path)}
+		item.Motion = p.Motion != ""
+		if s.index != nil {
+			if rec, ok := s.index.Get(p.SourceID, p.Path); ok {
+				if rec.Animation > 0 {
+					item.Animated, item.LoopMs = true, int(rec.Animation.Milliseconds())
+				}
+				item.Motion = item.Motion || rec.Motion
+			}
+		}
+		page.Photos = append(page.Photos, item)
+	}
+	return page, nil
+}
+
+// snapshot returns the listing kept under name, if it has not expired.
+func (s *AlbumService) snapshot(albumKey, name string) ([]domain.PhotoInfo, bool) {
+	if name == "" {
+		return nil, false
+	}
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	snap, ok := s.snapshots[albumKey+"\x00"+name]
+	if !ok || time.Since(snap.taken) > snapshotTTL {
+		return nil, false
+	}
+	return snap.photos, true
+}
+
+// keepSnapshot keeps a listing for its later pages, dropping expired ones
+// and, past maxSnapshots, the oldest.
+func (s *AlbumService) keepSnapshot(albumKey, name string, photos []domain.PhotoInfo) {
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	if s.snapshots == nil {
+		s.snapshots = make(map[string]listingSnapshot)
+	}
+	oldest := ""
+	for key, snap := range s.snapshots {
+		if time.Since(snap.taken) > snapshotTTL {
+			delete(s.snapshots, key)
+		} else if oldest == "" || snap.taken.Before(s.snapshots[oldest].taken) {
+			oldest = key
+		}
+	}
+	if len(s.snapshots) >= maxSnapshots {
+		delete(s.snapshots, oldest)
+	}
+	s.snapshots[albumKey+"\x00"+name] = listingSnapshot{photos: photos, taken: time.Now()}
+}
+
+// AlbumPhotos is ListPhoto returning the photos rather than their tokens.
+func (s *AlbumService) AlbumPhotos(ctx context.Context, albumKey string, opts domain.ListOptions) ([]domain.PhotoInfo, error) {
+	album, err := s.album(albumKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Order != "" && s.orders[opts.Order] == nil {
+		return nil, domain.ErrInvalidOrder
+	}
+
+	listed := s.listable(ctx, album.Photos, opts)
+	for _, order := range []string{s.defaultOrders[album.Name], opts.Order} {
+		if order == "" {
+			continue
+		}
+		if listed, err = s.orders[order].Arrange(ctx, listed, domain.ArrangeOptions{Seed: opts.Seed, Viewer: opts.Viewer}); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CollapseDuplicates {
+		listed = s.collapseDuplicates(listed)
+	}
+	return listed, nil
+}
+
+// listable returns the photos a listing with opts shows, in album order:
+// hidden ones are left out, as are those the favorites and rating filters
+// reject.
+func (s *AlbumService) listable(ctx context.Context, photos []domain.PhotoInfo, opts domain.ListOptions) []domain.PhotoInfo {
+	var listed []domain.PhotoInfo
+	for _, p := range photos {
+		flags := s.photoFlags(ctx, p)
+		if flags.Hidden || (opts.FavoritesOnly && !flags.Favorite) || flags.Rating < opts.MinRating {
+			continue
+		}
+		listed = append(listed, p)
+	}
+	return listed
+}
+
+// ArchivePhotos lists the photos of an album download in listing order.
+// tokens, when not empty, picks which of the listed photos to include;
+// ErrPhotoNotFound is returned for any that is not listed. A download of
+// originals fails with ErrOriginalDenied if a photo's source keeps its
+// originals private. Folder albums keep
+// their subfolders inside the archive, while virtual albums, whose photos
+// come from many folders, name entries by file name alone.
+func (s *AlbumService) ArchivePhotos(ctx context.Context, albumKey string, opts domain.ListOptions, tokens []string, originals bool) (domain.Archive, error) {
+	album, err := s.album(albumKey)
+	if err != nil {
+		return domain.Archive{}, err
+	}
+	listed, err := s.AlbumPhotos(ctx, albumKey, opts)
+	if err != nil {
+		return domain.Archive{}, err
+	}
+	if len(tokens) > 0 {
+		wanted := make(map[string]bool, len(tokens))
+		for _, t := range tokens {
+			wanted[t] = true
+		}
+		var picked []domain.PhotoInfo
+		for _, p := range listed {
+			if wanted[p.FilePath] {
+				picked = append(picked, p)
+				delete(wanted, p.FilePath)
+			}
+		}
+		if len(wanted) > 0 {
+			return domain.Archive{}, domain.ErrPhotoNotFound
+		}
+		listed = picked
+	}
+
+	archive := domain.Archive{Name: album.Name}
+	used := make(map[string]bool, len(listed))
+	for _, p := range listed {
+		if originals && s.originals != nil && !s.originals(p.SourceID) {
+			return domain.Archive{}, domain.ErrOriginalDenied
+		}
+		name := p.FilePath
+		if album.IsVirtual() {
+			name = uniqueName(path.Base(p.Path), used)
+		}
+		used[name] = true
+		archive.Entries = append(archive.Entries, domain.ArchiveEntry{Token: p.FilePath, Name: name})
+	}
+	return archive, nil
+}
+
+// uniqueName numbers name, as in "IMG_0001 (2).jpg", until it is not used.
+func uniqueName(name string, used map[string]bool) string {
+	if !used[name] {
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		if n := fmt.Sprintf("%s (%d)%s", base, i, ext); !used[n] {
+			return n
+		}
+	}
+}
+
+// collapseDuplicates keeps, for each duplicate group, only the best-ranked of
+// the listed photos, at its own position in the listing.
+func (s *AlbumService) collapseDuplicates(listed []domain.PhotoInfo) []domain.PhotoInfo {
+	if s.duplicates == nil {
+		return listed
+	}
+	best := make(map[int]int)
+	for _, p := range listed {
+		group, rank, ok := s.duplicates.DuplicateOf(domain.PhotoRef{SourceID: p.SourceID, Path: p.Path})
+		if r, seen := best[group]; ok && (!seen || rank < r) {
+			best[group] = rank
+		}
+	}
+	var collapsed []domain.PhotoInfo
+	for _, p := range listed {
+		group, rank, ok := s.duplicates.DuplicateOf(domain.PhotoRef{SourceID: p.SourceID, Path: p.Path})
+		if ok && best[group] != rank {
+			continue
+		}
+		collapsed = append(collapsed, p)
+	}
+	return collapsed
+}
+
+// photoFlags returns the flags of p, or no flags if it is not indexed.
+func (s *AlbumService) photoFlags(ctx context.Context, p domain.PhotoInfo) domain.PhotoFlags {
+	if s.flags == nil || s.index == nil {
+		return domain.PhotoFlags{}
+	}
+	rec, ok := s.index.Get(p.SourceID, p.Path)
+	if !ok {
+		return domain.PhotoFlags{}
+	}
+	return s.flags.Flags(ctx, rec)
+}
+
+// ReadPhoto reads the image of a photo. For a video that is its poster, the
+// still image stored beside it; ErrNoPoster means there is none.
 func (s *AlbumService) ReadPhoto(ctx context.Context, albumKey, photoToken string) ([]byte, error) {
-	albumUID, err := s.albumMapper.Decode(albumKey)
+	src, p, err := s.locate(albumKey, photoToken)
 	if err != nil {
-		return nil, domain.ErrAlbumNotFound
+		return nil, err
 	}
-	album, ok := s.albums[albumUID]
+	if domain.IsVideo(p) {
+		return readPoster(ctx, src, p)
+	}
+	return src.Provider.ReadFile(ctx, p)
+}
+
+// posterExts are the extensions of the stills cameras and phones store next
+// to videos, such as the .THM thumbnails of many cameras.
+var posterExts = []string{".THM", ".thm", ".JPG", ".jpg", ".jpeg"}
+
+func readPoster(ctx context.Context, src *domain.Source, video string) ([]byte, error) {
+	base := strings.TrimSuffix(video, path.Ext(video))
+	for _, ext := range posterExts {
+		if data, err := src.Provider.ReadFile(ctx, base+ext); err == nil {
+			return data, nil
+		}
+	}
+	return nil, domain.ErrNoPoster
+}
+
+// OpenPhoto opens the original file of a photo for streaming, unless its
+// source keeps originals private. The caller closes the file.
+func (s *AlbumService) OpenPhoto(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	src, p, err := s.locate(albumKey, photoToken)
+	if err != nil {
+		return nil, domain.FileInfo{}, err
+	}
+	if s.originals != nil && !s.originals(src.ID) {
+		return nil, domain.FileInfo{}, domain.ErrOriginalDenied
+	}
+	return src.Provider.Open(ctx, p)
+}
+
+// OpenVideo opens a video for playback, unless its source does not stream
+// videos. Photos are not found here. The caller closes the file.
+func (s *AlbumService) OpenVideo(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	src, p, err := s.locate(albumKey, photoToken)
+	if err != nil {
+		return nil, domain.FileInfo{}, err
+	}
+	if !domain.IsVideo(p) {
+		return nil, domain.FileInfo{}, domain.ErrPhotoNotFound
+	}
+	if s.videos != nil && !s.videos(src.ID) {
+		return nil, domain.FileInfo{}, domain.ErrVideoDenied
+	}
+	return src.Provider.Open(ctx, p)
+}
+
+// OpenMotion opens the Live Photo clip paired with a photo, under the same
+// rules as OpenPhoto. ErrNoMotion means there is no paired clip, though the
+// photo may still be a motion photo with the clip inside its own file.
+func (s *AlbumService) OpenMotion(ctx context.Context, albumKey, photoToken string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	album, err := s.album(albumKey)
+	if err != nil {
+		return nil, domain.FileInfo{}, err
+	}
+	p, ok := album.Photo(photoToken)
 	if !ok {
-		return nil, domain.ErrAlbumNotFound
+		return nil, domain.FileInfo{}, domain.ErrPhotoNotFound
+	}
+	src, ok := s.sourceReader.GetSource(p.SourceID)
+	if !ok {
+		return nil, domain.FileInfo{}, domain.ErrSourceNotFound
+	}
+	if s.originals != nil && !s.originals(src.ID) {
+		return nil, domain.FileInfo{}, domain.ErrOriginalDenied
+	}
+	if p.Motion == "" {
+		return nil, domain.FileInfo{}, domain.ErrNoMotion
+	}
+	return src.Provider.Open(ctx, p.Motion)
+}
+
+// MetadataPolicy returns the metadata policy of the source a photo lives in.
+func (s *AlbumService) MetadataPolicy(_ context.Context, albumKey, photoToken string) (domain.MetadataPolicy, error) {
+	src, _, err := s.locate(albumKey, photoToken)
+	if err != nil {
+		return domain.MetadataPolicy{}, err
+	}
+	return s.policy(src.ID), nil
+}
+
+// policy returns the metadata policy of a source.
+func (s *AlbumService) policy(sourceID string) domain.MetadataPolicy {
+	if s.metadata == nil {
+		return domain.MetadataPolicy{}
+	}
+	return s.metadata(sourceID)
+}
+
+// locate finds the source and path of a photo.
+func (s *AlbumService) locate(albumKey, photoToken string) (*domain.Source, string, error) {
+	album, err := s.album(albumKey)
+	if err != nil {
+		return nil, "", err
+	}
+	sourceID, p := album.SourceID, path.Join(album.Dir, photoToken)
+	if album.IsVirtual() {
+		// Virtual albums span sources, so the photo itself says where it lives.
+		ph, ok := album.Photo(photoToken)
+		if !ok {
+			return nil, "", domain.ErrPhotoNotFound
+		}
+		sourceID, p = ph.SourceID, ph.Path
+	} else if !filepath.IsLocal(photoToken) {
+		// Tokens may contain subfolders, but must never escape the album directory.
+		return nil, "", domain.ErrPhotoNotFound
 	}
-	src, ok := s.sourceReader.GetSource(album.SourceID)
+	src, ok := s.sourceReader.GetSource(sourceID)
 	if !ok {
-		return nil, domain.ErrSourceNotFound
+		return nil, "", domain.ErrSourceNotFound
 	}
+	return src, p, nil
+}
 
-	return src.Provider.ReadFile(ctx, path.Join(album.Dir, photoToken))
+// ResolvePhoto turns an album key and photo token into a ref that stays valid
+// outside the album.
+func (s *AlbumService) ResolvePhoto(_ context.Context, albumKey, photoToken string) (domain.PhotoRef, error) {
+	album, err := s.album(albumKey)
+	if err != nil {
+		return domain.PhotoRef{}, err
+	}
+	p, ok := album.Photo(photoToken)
+	if !ok {
+		return domain.PhotoRef{}, domain.ErrPhotoNotFound
+	}
+	return domain.PhotoRef{SourceID: p.SourceID, Path: p.Path}, nil
 }
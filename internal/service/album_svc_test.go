@@ -1,11 +1,18 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"maps"
+	"path"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/index"
 	"github.com/Aquila-f/photo-slider/internal/mapper"
 	"github.com/Aquila-f/photo-slider/internal/strategy"
 )
@@ -33,6 +40,18 @@ func (m *mockProvider) ReadFile(_ context.Context, filePath string) ([]byte, err
 	return data, nil
 }
 
+func (m *mockProvider) Open(_ context.Context, filePath string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	data, ok := m.files[filePath]
+	if !ok {
+		return nil, domain.FileInfo{}, errors.New("file not found: " + filePath)
+	}
+	return nopCloser{bytes.NewReader(data)}, domain.FileInfo{Name: path.Base(filePath), Path: filePath, Size: int64(len(data))}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
 // newTestService wires real strategy + mapper with a mock provider.
 // Returns the service plus the underlying maps so tests can inspect/inject state.
 func newTestService(provider domain.StorageProvider, sourceID string) (*AlbumService, *SourceService, map[string]*domain.Album) {
@@ -153,6 +172,245 @@ func TestAlbumService_ListAlbums_EmptyWhenNoAlbums(t *testing.T) {
 	}
 }
 
+// dateExtractor reports the file content as the capture date.
+type dateExtractor struct{}
+
+func (dateExtractor) Extract(_ context.Context, data []byte) (*domain.PhotoMeta, error) {
+	t, err := time.Parse(time.DateOnly, string(data))
+	if err != nil {
+		return &domain.PhotoMeta{}, nil
+	}
+	return &domain.PhotoMeta{TakenAt: &t}, nil
+}
+
+func newSummaryTestService(t *testing.T) *AlbumService {
+	t.Helper()
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "2019", Files: []domain.FileInfo{{Name: "a.jpg", Size: 100}, {Name: "b.jpg", Size: 200}, {Name: "c.jpg", Size: 300}}},
+			{Path: "2021", Files: []domain.FileInfo{{Name: "d.jpg", Size: 50}}},
+			{Path: "misc", Files: []domain.FileInfo{{Name: "e.jpg", Size: 1000}}},
+		},
+		files: map[string][]byte{
+			"2019/a.jpg": []byte("2019-08-02"),
+			"2019/b.jpg": []byte("2019-07-30"),
+			"2019/c.jpg": []byte("2019-08-15"),
+			"2021/d.jpg": []byte("2021-01-01"),
+			"misc/e.jpg": []byte("undated"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	svc.SetIndex(index.NewMemoryIndex(dateExtractor{}, nil))
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc
+}
+
+func TestAlbumService_ListAlbums_Summaries(t *testing.T) {
+	svc := newSummaryTestService(t)
+
+	items := svc.ListAlbums(context.Background())
+	if len(items) != 3 || items[0].Name != "2019" || items[2].Name != "misc" {
+		t.Fatalf("items = %+v, want albums by name", items)
+	}
+	got := items[0]
+	if got.Source != "src1" || got.Count != 3 || got.Bytes != 600 || got.Cover != "a.jpg" {
+		t.Errorf("summary = %+v", got)
+	}
+	if got.TakenFrom == nil || got.TakenFrom.Format(time.DateOnly) != "2019-07-30" ||
+		got.TakenTo == nil || got.TakenTo.Format(time.DateOnly) != "2019-08-15" {
+		t.Errorf("taken = %v..%v, want 2019-07-30..2019-08-15", got.TakenFrom, got.TakenTo)
+	}
+	if items[2].TakenFrom != nil {
+		t.Errorf("undated album taken from %v", items[2].TakenFrom)
+	}
+}
+
+func TestAlbumService_ListAlbums_Cover(t *testing.T) {
+	svc := newSummaryTestService(t)
+	flags, err := NewFlagService(&memStore{}, svc, svc.index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.SetFlagReader(flags)
+	ctx := context.Background()
+	key := albumKey(t, svc, "2019")
+
+	// A favorite beats the first photo, and a hidden photo is left out.
+	_, _ = flags.SetFlags(ctx, key, "b.jpg", domain.FlagUpdate{Favorite: ptr(true)})
+	_, _ = flags.SetFlags(ctx, key, "a.jpg", domain.FlagUpdate{Hidden: ptr(true)})
+	item, _ := findAlbum(svc.ListAlbums(ctx), "2019")
+	if item.Cover != "b.jpg" || item.Count != 2 || item.Bytes != 500 {
+		t.Errorf("summary = %+v, want favorite cover without the hidden photo", item)
+	}
+
+	// A configured cover beats favorites.
+	svc.SetCover("2019", "c.jpg")
+	if item, _ := findAlbum(svc.ListAlbums(ctx), "2019"); item.Cover != "c.jpg" {
+		t.Errorf("Cover = %q, want c.jpg", item.Cover)
+	}
+}
+
+func TestAlbumService_FindAlbums(t *testing.T) {
+	svc := newSummaryTestService(t)
+	ctx := context.Background()
+	names := func(f domain.AlbumFilter) []string {
+		t.Helper()
+		items, err := svc.FindAlbums(ctx, f)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.AlbumFilter
+		want   []string
+	}{
+		{"name", domain.AlbumFilter{Name: "20"}, []string{"2019", "2021"}},
+		{"taken overlaps", domain.AlbumFilter{TakenFrom: time.Date(2019, 8, 10, 0, 0, 0, 0, time.UTC), TakenTo: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}, []string{"2019"}},
+		{"min count", domain.AlbumFilter{MinCount: 2}, []string{"2019"}},
+		{"min bytes", domain.AlbumFilter{MinBytes: 500}, []string{"2019", "misc"}},
+		{"by size", domain.AlbumFilter{Sort: domain.AlbumSortSize, Desc: true}, []string{"misc", "2019", "2021"}},
+		{"by date", domain.AlbumFilter{Sort: domain.AlbumSortDate, Desc: true}, []string{"2021", "2019", "misc"}},
+		{"by count", domain.AlbumFilter{Sort: domain.AlbumSortCount}, []string{"2021", "misc", "2019"}},
+		{"by count, ties by name", domain.AlbumFilter{Sort: domain.AlbumSortCount, Desc: true}, []string{"2019", "2021", "misc"}},
+	}
+	for _, tt := range tests {
+		if got := names(tt.filter); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := svc.FindAlbums(ctx, domain.AlbumFilter{Sort: "sideways"}); err != domain.ErrInvalidSort {
+		t.Errorf("err = %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestAlbumService_FindAlbums_MetadataPolicy(t *testing.T) {
+	svc := newSummaryTestService(t)
+	svc.SetMetadataPolicy(func(string) domain.MetadataPolicy {
+		return domain.MetadataPolicy{Strip: true, Keep: []string{domain.MetaModel}}
+	})
+	ctx := context.Background()
+
+	items, err := svc.FindAlbums(ctx, domain.AlbumFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, item := range items {
+		if item.TakenFrom != nil || item.TakenTo != nil {
+			t.Errorf("%s: taken %v..%v, want no dates", item.Name, item.TakenFrom, item.TakenTo)
+		}
+	}
+	// Hidden dates cannot be learned by filtering on them either.
+	f := domain.AlbumFilter{TakenFrom: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if items, _ := svc.FindAlbums(ctx, f); len(items) != 0 {
+		t.Errorf("taken filter matched %d albums, want none", len(items))
+	}
+}
+
+// --- AlbumTree ---
+
+func TestAlbumService_AlbumTree_NestsUnderNearestAncestor(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "", Files: []domain.FileInfo{{Name: "cover.jpg"}}},
+			{Path: "2024", Files: []domain.FileInfo{{Name: "summer", IsDir: true}}},
+			{Path: "2024/summer", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}}},
+			{Path: "misc", Files: []domain.FileInfo{{Name: "x.png"}}},
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tree := svc.AlbumTree(context.Background())
+	if len(tree) != 1 {
+		t.Fatalf("expected 1 root, got %d", len(tree))
+	}
+	root := tree[0]
+	if root.Name != "default" || root.ParentKey != "" || root.Count != 1 {
+		t.Errorf("root = %+v, want default with 1 photo", root)
+	}
+	// "2024" has no photos of its own, so 2024/summer hangs off the root.
+	if len(root.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(root.Children))
+	}
+	summer := root.Children[0]
+	if summer.Name != "2024/summer" || summer.Count != 2 {
+		t.Errorf("child = %+v, want 2024/summer with 2 photos", summer)
+	}
+	if summer.ParentKey != root.Key {
+		t.Errorf("ParentKey = %q, want %q", summer.ParentKey, root.Key)
+	}
+	if root.Children[1].Name != "misc" {
+		t.Errorf("second child = %q, want misc", root.Children[1].Name)
+	}
+}
+
+func TestAlbumService_AlbumTree_CountsListedPhotos(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+	if _, err := flags.SetFlags(ctx, trip, "a.jpg", domain.FlagUpdate{Hidden: ptr(true)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listed, err := svc.AlbumPhotos(ctx, trip, domain.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var find func(nodes []domain.AlbumNode) (domain.AlbumNode, bool)
+	find = func(nodes []domain.AlbumNode) (domain.AlbumNode, bool) {
+		for _, n := range nodes {
+			if n.Key == trip {
+				return n, true
+			}
+			if found, ok := find(n.Children); ok {
+				return found, true
+			}
+		}
+		return domain.AlbumNode{}, false
+	}
+	node, ok := find(svc.AlbumTree(ctx))
+	if !ok {
+		t.Fatal("trip not in the tree")
+	}
+	// The hidden photo is not counted, so the count matches the listing.
+	if node.Count != len(listed) || node.Count != 1 {
+		t.Errorf("Count = %d, want %d like the listing", node.Count, len(listed))
+	}
+}
+
+func TestAlbumService_AlbumTree_RecursiveStrategy(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "2024", Files: []domain.FileInfo{{Name: "summer", IsDir: true}}},
+			{Path: "2024/summer", Files: []domain.FileInfo{{Name: "a.jpg"}}},
+		},
+	}
+	sourceSvc := NewSourceService(map[string]*domain.Source{"src1": {ID: "src1", Provider: provider}}, nil)
+	svc := NewAlbumService(sourceSvc, map[string]*domain.Album{}, strategy.NewRecursiveFolderAlbumStrategy(), mapper.NewBase64Mapper(), 3)
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tree := svc.AlbumTree(context.Background())
+	if len(tree) != 1 || tree[0].Name != "2024" || tree[0].Count != 1 {
+		t.Fatalf("tree = %+v, want single 2024 root with 1 photo", tree)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].Name != "2024/summer" {
+		t.Errorf("children = %+v, want 2024/summer", tree[0].Children)
+	}
+}
+
 // --- ListPhoto ---
 
 func TestAlbumService_ListPhoto_ReturnsTokens(t *testing.T) {
@@ -173,7 +431,7 @@ func TestAlbumService_ListPhoto_ReturnsTokens(t *testing.T) {
 	}
 
 	// UID = "src1/gallery" → Base64 encoded key
-	tokens, err := svc.ListPhoto(context.Background(), "c3JjMS9nYWxsZXJ5")
+	tokens, err := svc.ListPhoto(context.Background(), "c3JjMS9nYWxsZXJ5", domain.ListOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -182,6 +440,46 @@ func TestAlbumService_ListPhoto_ReturnsTokens(t *testing.T) {
 	}
 }
 
+func TestAlbumService_ListPhoto_RawPairs(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{
+				Path: "shoot",
+				Files: []domain.FileInfo{
+					{Name: "IMG_1.CR2"},
+					{Name: "IMG_1.JPG"},
+					{Name: "IMG_2.nef"},
+					{Name: "IMG_3.jpeg"},
+					{Name: "IMG_3.png"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		keep string
+		want []string
+	}{
+		{domain.RawPairsBoth, []string{"IMG_1.CR2", "IMG_1.JPG", "IMG_2.nef", "IMG_3.jpeg", "IMG_3.png"}},
+		{domain.RawPairsJPEG, []string{"IMG_1.JPG", "IMG_2.nef", "IMG_3.jpeg", "IMG_3.png"}},
+		{domain.RawPairsRaw, []string{"IMG_1.CR2", "IMG_2.nef", "IMG_3.jpeg", "IMG_3.png"}},
+	}
+	for _, tt := range tests {
+		svc, _, _ := newTestService(provider, "src1")
+		svc.SetRawPairs(tt.keep)
+		if err := svc.SyncAlbums(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tokens, err := svc.ListPhoto(context.Background(), albumKey(t, svc, "shoot"), domain.ListOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.keep, err)
+		}
+		slices.Sort(tokens)
+		if !slices.Equal(tokens, tt.want) {
+			t.Errorf("%s: tokens = %v, want %v", tt.keep, tokens, tt.want)
+		}
+	}
+}
+
 func TestAlbumService_ListPhoto_AlbumNotFound(t *testing.T) {
 	provider := &mockProvider{}
 	svc, _, _ := newTestService(provider, "src1")
@@ -189,12 +487,116 @@ func TestAlbumService_ListPhoto_AlbumNotFound(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_, err := svc.ListPhoto(context.Background(), "no_such_album")
+	_, err := svc.ListPhoto(context.Background(), "no_such_album", domain.ListOptions{})
 	if err != domain.ErrAlbumNotFound {
 		t.Errorf("expected ErrAlbumNotFound, got: %v", err)
 	}
 }
 
+func TestAlbumService_ListPhotoPage(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "gallery", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}, {Name: "c.jpg"}}},
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	page, err := svc.ListPhotoPage(ctx, "c3JjMS9nYWxsZXJ5", domain.ListOptions{}, 1, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page.Total != 3 || len(page.Photos) != 1 || page.Photos[0] != (domain.PhotoItem{Key: "b.jpg", Name: "b.jpg", Type: domain.MediaImage}) {
+		t.Errorf("page = %+v, want b.jpg of 3", page)
+	}
+	if past, _ := svc.ListPhotoPage(ctx, "c3JjMS9nYWxsZXJ5", domain.ListOptions{}, 5, 1); past.Total != 3 || len(past.Photos) != 0 {
+		t.Errorf("page past the end = %+v", past)
+	}
+}
+
+// rotatingOrder moves the first photo to the end on every call, like an order
+// following the show history once the first photo has been shown.
+type rotatingOrder struct{ calls int }
+
+func (o *rotatingOrder) Arrange(_ context.Context, photos []domain.PhotoInfo, _ domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	n := o.calls % len(photos)
+	o.calls++
+	return append(slices.Clone(photos[n:]), photos[:n]...), nil
+}
+
+func TestAlbumService_ListPhotoPage_Snapshot(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "gallery", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}, {Name: "c.jpg"}}},
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	svc.SetListStrategies(map[string]domain.PhotoListStrategy{"fresh": &rotatingOrder{}})
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	keys := func(opts domain.ListOptions) []string {
+		t.Helper()
+		var keys []string
+		for offset := 0; offset < 3; offset++ {
+			page, err := svc.ListPhotoPage(ctx, "c3JjMS9nYWxsZXJ5", opts, offset, 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			keys = append(keys, page.Photos[0].Key)
+		}
+		return keys
+	}
+
+	if got := keys(domain.ListOptions{Order: "fresh", Snapshot: "s1"}); !slices.Equal(got, []string{"a.jpg", "b.jpg", "c.jpg"}) {
+		t.Errorf("pages = %v, want the first listing throughout", got)
+	}
+	// Without a snapshot every page lists afresh.
+	if got := keys(domain.ListOptions{Order: "fresh"}); !slices.Equal(got, []string{"b.jpg", "a.jpg", "c.jpg"}) {
+		t.Errorf("pages = %v, want each page cut from a new listing", got)
+	}
+}
+
+// loopFingerprinter reports files reading "anim" as one-second animations.
+type loopFingerprinter struct{}
+
+func (loopFingerprinter) Fingerprint(_ context.Context, data []byte) (domain.Fingerprint, error) {
+	if string(data) == "anim" {
+		return domain.Fingerprint{Animation: time.Second}, nil
+	}
+	return domain.Fingerprint{}, nil
+}
+
+func TestAlbumService_ListPhotoPage_Animated(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "gallery", Files: []domain.FileInfo{{Name: "a.gif"}, {Name: "b.jpg"}}},
+		},
+		files: map[string][]byte{"gallery/a.gif": []byte("anim"), "gallery/b.jpg": []byte("still")},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	svc.SetIndex(index.NewMemoryIndex(dateExtractor{}, loopFingerprinter{}))
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	page, err := svc.ListPhotoPage(context.Background(), "c3JjMS9nYWxsZXJ5", domain.ListOptions{}, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []domain.PhotoItem{
+		{Key: "a.gif", Name: "a.gif", Type: domain.MediaImage, Animated: true, LoopMs: 1000},
+		{Key: "b.jpg", Name: "b.jpg", Type: domain.MediaImage},
+	}
+	if !slices.Equal(page.Photos, want) {
+		t.Errorf("photos = %+v, want %+v", page.Photos, want)
+	}
+}
+
 // --- ReadPhoto ---
 
 func TestAlbumService_ReadPhoto_ReturnsFileBytes(t *testing.T) {
@@ -242,6 +644,48 @@ func TestAlbumService_ReadPhoto_JoinsAlbumDirWithToken(t *testing.T) {
 	}
 }
 
+func TestAlbumService_ReadPhoto_SubfolderToken(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "2024", Files: []domain.FileInfo{{Name: "summer", IsDir: true}}},
+			{Path: "2024/summer", Files: []domain.FileInfo{{Name: "beach.jpg"}}},
+		},
+		files: map[string][]byte{
+			"2024/summer/beach.jpg": []byte("img"),
+		},
+	}
+	sourceSvc := NewSourceService(map[string]*domain.Source{"src1": {ID: "src1", Provider: provider}}, nil)
+	svc := NewAlbumService(sourceSvc, map[string]*domain.Album{}, strategy.NewRecursiveFolderAlbumStrategy(), mapper.NewBase64Mapper(), 3)
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// key = base64("src1/2024")
+	if _, err := svc.ReadPhoto(context.Background(), "c3JjMS8yMDI0", "summer/beach.jpg"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAlbumService_ReadPhoto_RejectsEscapingToken(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "trips", Files: []domain.FileInfo{{Name: "sunset.jpg"}}},
+		},
+		files: map[string][]byte{
+			"secret.jpg": []byte("img"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := svc.ReadPhoto(context.Background(), "c3JjMS90cmlwcw==", "../secret.jpg")
+	if err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound, got: %v", err)
+	}
+}
+
 func TestAlbumService_ReadPhoto_AlbumNotFound(t *testing.T) {
 	provider := &mockProvider{}
 	svc, _, _ := newTestService(provider, "src1")
@@ -272,6 +716,209 @@ func TestAlbumService_ReadPhoto_SourceNotFound(t *testing.T) {
 	}
 }
 
+func TestAlbumService_ReadPhoto_VideoPoster(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "trips", Files: []domain.FileInfo{{Name: "a.mp4"}, {Name: "b.mov"}}},
+		},
+		files: map[string][]byte{
+			"trips/a.mp4": []byte("video"),
+			"trips/a.THM": []byte("poster"),
+			"trips/b.mov": []byte("video"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := svc.ReadPhoto(context.Background(), "c3JjMS90cmlwcw==", "a.mp4")
+	if err != nil || string(data) != "poster" {
+		t.Errorf("ReadPhoto(a.mp4) = %q, %v; want the .THM poster", data, err)
+	}
+	if _, err := svc.ReadPhoto(context.Background(), "c3JjMS90cmlwcw==", "b.mov"); err != domain.ErrNoPoster {
+		t.Errorf("expected ErrNoPoster, got: %v", err)
+	}
+}
+
+// --- OpenVideo ---
+
+func TestAlbumService_OpenVideo_RespectsVideoAccess(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "trips", Files: []domain.FileInfo{{Name: "clip.mp4"}, {Name: "sunset.jpg"}}},
+		},
+		files: map[string][]byte{
+			"trips/clip.mp4":   []byte("fake-video-data"),
+			"trips/sunset.jpg": []byte("fake-image-data"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Videos have a setting of their own, apart from originals.
+	svc.SetOriginalAccess(func(string) bool { return false })
+
+	f, _, err := svc.OpenVideo(context.Background(), "c3JjMS90cmlwcw==", "clip.mp4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "fake-video-data" {
+		t.Errorf("got %q, want the video", data)
+	}
+	if _, _, err := svc.OpenVideo(context.Background(), "c3JjMS90cmlwcw==", "sunset.jpg"); err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound for a photo, got: %v", err)
+	}
+
+	svc.SetVideoAccess(func(id string) bool { return id != "src1" })
+	if _, _, err := svc.OpenVideo(context.Background(), "c3JjMS90cmlwcw==", "clip.mp4"); err != domain.ErrVideoDenied {
+		t.Errorf("expected ErrVideoDenied, got: %v", err)
+	}
+}
+
+// --- OpenPhoto ---
+
+func TestAlbumService_OpenPhoto_RespectsSourceAccess(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "trips", Files: []domain.FileInfo{{Name: "sunset.jpg"}}},
+		},
+		files: map[string][]byte{
+			"trips/sunset.jpg": []byte("fake-image-data"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, info, err := svc.OpenPhoto(context.Background(), "c3JjMS90cmlwcw==", "sunset.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "fake-image-data" || info.Name != "sunset.jpg" {
+		t.Errorf("got %q named %q, want the original file", data, info.Name)
+	}
+
+	svc.SetOriginalAccess(func(sourceID string) bool { return sourceID != "src1" })
+	if _, _, err := svc.OpenPhoto(context.Background(), "c3JjMS90cmlwcw==", "sunset.jpg"); err != domain.ErrOriginalDenied {
+		t.Errorf("expected ErrOriginalDenied, got: %v", err)
+	}
+	// Resized copies are still served.
+	if _, err := svc.ReadPhoto(context.Background(), "c3JjMS90cmlwcw==", "sunset.jpg"); err != nil {
+		t.Errorf("ReadPhoto: unexpected error: %v", err)
+	}
+}
+
+// --- ArchivePhotos ---
+
+func TestAlbumService_PairsLivePhotos(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "phone", Files: []domain.FileInfo{
+				{Name: "IMG_1.HEIC"},
+				{Name: "IMG_1.MOV"},
+				{Name: "IMG_2.JPG"},
+				{Name: "IMG_2.mov"},
+				{Name: "IMG_3.jpg"},
+				{Name: "IMG_4.MOV"},
+			}},
+		},
+		files: map[string][]byte{
+			"phone/IMG_1.MOV": []byte("live-clip"),
+			"phone/IMG_3.jpg": []byte("still"),
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	key := albumKey(t, svc, "phone")
+
+	page, err := svc.ListPhotoPage(ctx, key, domain.ListOptions{}, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, p := range page.Photos {
+		got[p.Name] = p.Motion
+	}
+	want := map[string]bool{"IMG_1.HEIC": true, "IMG_2.JPG": true, "IMG_3.jpg": false, "IMG_4.MOV": false}
+	if !maps.Equal(got, want) {
+		t.Errorf("listing = %v, want %v", got, want)
+	}
+
+	f, _, err := svc.OpenMotion(ctx, key, "IMG_1.HEIC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "live-clip" {
+		t.Errorf("motion = %q, want the paired clip", data)
+	}
+	if _, _, err := svc.OpenMotion(ctx, key, "IMG_3.jpg"); err != domain.ErrNoMotion {
+		t.Errorf("expected ErrNoMotion, got: %v", err)
+	}
+	if _, _, err := svc.OpenMotion(ctx, key, "IMG_1.MOV"); err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound for the paired clip itself, got: %v", err)
+	}
+	svc.SetOriginalAccess(func(string) bool { return false })
+	if _, _, err := svc.OpenMotion(ctx, key, "IMG_1.HEIC"); err != domain.ErrOriginalDenied {
+		t.Errorf("expected ErrOriginalDenied, got: %v", err)
+	}
+}
+
+func TestAlbumService_ArchivePhotos(t *testing.T) {
+	provider := &mockProvider{
+		walkResult: []domain.DirSnapshot{
+			{Path: "trips", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}, {Name: "c.jpg"}}},
+		},
+	}
+	svc, _, _ := newTestService(provider, "src1")
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	archive, err := svc.ArchivePhotos(ctx, "c3JjMS90cmlwcw==", domain.ListOptions{}, []string{"c.jpg", "a.jpg"}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []domain.ArchiveEntry{{Token: "a.jpg", Name: "a.jpg"}, {Token: "c.jpg", Name: "c.jpg"}}
+	if archive.Name != "trips" || !slices.Equal(archive.Entries, want) {
+		t.Errorf("archive = %+v, want trips with %v in listing order", archive, want)
+	}
+
+	if _, err := svc.ArchivePhotos(ctx, "c3JjMS90cmlwcw==", domain.ListOptions{}, []string{"nope.jpg"}, true); err != domain.ErrPhotoNotFound {
+		t.Errorf("unknown token: expected ErrPhotoNotFound, got: %v", err)
+	}
+
+	svc.SetOriginalAccess(func(string) bool { return false })
+	if _, err := svc.ArchivePhotos(ctx, "c3JjMS90cmlwcw==", domain.ListOptions{}, nil, true); err != domain.ErrOriginalDenied {
+		t.Errorf("denied originals: expected ErrOriginalDenied, got: %v", err)
+	}
+	if archive, err := svc.ArchivePhotos(ctx, "c3JjMS90cmlwcw==", domain.ListOptions{}, nil, false); err != nil || len(archive.Entries) != 3 {
+		t.Errorf("renditions: got %d entries (%v), want 3", len(archive.Entries), err)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	used := map[string]bool{"IMG_1.jpg": true, "IMG_1 (2).jpg": true}
+	if got := uniqueName("IMG_1.jpg", used); got != "IMG_1 (3).jpg" {
+		t.Errorf("uniqueName = %q, want %q", got, "IMG_1 (3).jpg")
+	}
+	if got := uniqueName("IMG_2.jpg", used); got != "IMG_2.jpg" {
+		t.Errorf("uniqueName = %q, want %q", got, "IMG_2.jpg")
+	}
+}
+
 // --- Idempotency ---
 
 func TestAlbumService_SyncAlbums_Idempotent(t *testing.T) {
@@ -296,3 +943,27 @@ func TestAlbumService_SyncAlbums_Idempotent(t *testing.T) {
 		t.Errorf("SyncAlbums not idempotent: first=%d, second=%d albums", firstCount, secondCount)
 	}
 }
+
+func TestAlbumService_ListPhoto_Orders(t *testing.T) {
+	svc, _ := newSmartTestService(t)
+	svc.SetListStrategies(strategy.NewListStrategies())
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+
+	if err := svc.SetDefaultOrder("trip", "reverse"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokens, _ := svc.ListPhoto(ctx, trip, domain.ListOptions{}); len(tokens) != 2 || tokens[0] != "b.jpg" {
+		t.Errorf("default order = %v, want [b.jpg a.jpg]", tokens)
+	}
+	// A requested order applies on top of the album's default.
+	if tokens, _ := svc.ListPhoto(ctx, trip, domain.ListOptions{Order: "reverse"}); len(tokens) != 2 || tokens[0] != "a.jpg" {
+		t.Errorf("reversed default = %v, want [a.jpg b.jpg]", tokens)
+	}
+	if _, err := svc.ListPhoto(ctx, trip, domain.ListOptions{Order: "sideways"}); err != domain.ErrInvalidOrder {
+		t.Errorf("expected ErrInvalidOrder, got: %v", err)
+	}
+	if err := svc.SetDefaultOrder("trip", "sideways"); err != domain.ErrInvalidOrder {
+		t.Errorf("expected ErrInvalidOrder, got: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"math/bits"
+	"sort"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+type duplicateRank struct {
+	group int
+	rank  int
+}
+
+// DuplicateService groups copies of the same shot whenever the index changes:
+// files with the same content hash are exact duplicates, and images whose
+// dHashes differ in at most distance bits are near duplicates. A negative
+// distance turns near-duplicate matching off.
+type DuplicateService struct {
+	mu       sync.RWMutex
+	distance int
+	groups   []domain.DuplicateGroup
+	ranks    map[domain.PhotoRef]duplicateRank
+	// metadata returns the metadata policy of a source; nil serves metadata
+	// as stored.
+	metadata func(sourceID string) domain.MetadataPolicy
+}
+
+func NewDuplicateService(distance int) *DuplicateService {
+	return &DuplicateService{distance: distance, ranks: make(map[domain.PhotoRef]duplicateRank)}
+}
+
+// SetMetadataPolicy sets the metadata policy of each source, which decides
+// the metadata of the records Duplicates returns.
+func (s *DuplicateService) SetMetadataPolicy(policy func(sourceID string) domain.MetadataPolicy) {
+	s.metadata = policy
+}
+
+func (s *DuplicateService) IndexChanged(_ context.Context, records []domain.PhotoRecord) {
+	groups := groupDuplicates(records, s.distance)
+	ranks := make(map[domain.PhotoRef]duplicateRank)
+	for g, group := range groups {
+		for r, rec := range group.Photos {
+			ranks[domain.PhotoRef{SourceID: rec.SourceID, Path: rec.Path}] = duplicateRank{group: g, rank: r}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = groups
+	s.ranks = ranks
+}
+
+// Duplicates returns every duplicate group, largest first.
+func (s *DuplicateService) Duplicates(_ context.Context) []domain.DuplicateGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.metadata == nil {
+		return s.groups
+	}
+	groups := make([]domain.DuplicateGroup, len(s.groups))
+	for i, g := range s.groups {
+		groups[i] = domain.DuplicateGroup{Exact: g.Exact, Photos: make([]domain.PhotoRecord, len(g.Photos))}
+		for j, rec := range g.Photos {
+			groups[i].Photos[j] = s.metadata(rec.SourceID).FilterRecord(rec)
+		}
+	}
+	return groups
+}
+
+func (s *DuplicateService) DuplicateOf(ref domain.PhotoRef) (int, int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.ranks[ref]
+	return r.group, r.rank, ok
+}
+
+// groupDuplicates clusters records with a union-find over equal content
+// hashes and close dHashes. Records that were never read are ignored.
+func groupDuplicates(records []domain.PhotoRecord, distance int) []domain.DuplicateGroup {
+	var recs []domain.PhotoRecord
+	for _, rec := range records {
+		if rec.Hash != "" {
+			recs = append(recs, rec)
+		}
+	}
+
+	parent := make([]int, len(recs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		parent[find(i)] = find(j)
+	}
+
+	byHash := make(map[string]int, len(recs))
+	for i, rec := range recs {
+		if j, ok := byHash[rec.Hash]; ok {
+			union(i, j)
+		} else {
+			byHash[rec.Hash] = i
+		}
+	}
+	if distance >= 0 {
+		nearDHashes(recs, distance, union)
+	}
+
+	members := make(map[int][]domain.PhotoRecord)
+	for i, rec := range recs {
+		root := find(i)
+		members[root] = append(members[root], rec)
+	}
+	var groups []domain.DuplicateGroup
+	for _, photos := range members {
+		if len(photos) < 2 {
+			continue
+		}
+		sort.SliceStable(photos, func(i, j int) bool {
+			return photos[i].Width*photos[i].Height > photos[j].Width*photos[j].Height
+		})
+		exact := true
+		for _, p := range photos[1:] {
+			exact = exact && p.Hash == photos[0].Hash
+		}
+		groups = append(groups, domain.DuplicateGroup{Exact: exact, Photos: photos})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Photos) != len(groups[j].Photos) {
+			return len(groups[i].Photos) > len(groups[j].Photos)
+		}
+		a, b := groups[i].Photos[0], groups[j].Photos[0]
+		if a.SourceID != b.SourceID {
+			return a.SourceID < b.SourceID
+		}
+		return a.Path < b.Path
+	})
+	return groups
+}
+
+// nearDHashes calls union for the decoded records whose dHashes differ in at
+// most distance bits. Each distinct dHash is split into distance+1 bands;
+// two hashes that close agree on at least one whole band, so only hashes
+// sharing a band are compared.
+func nearDHashes(recs []domain.PhotoRecord, distance int, union func(i, j int)) {
+	var distinct []int
+	byDHash := make(map[uint64]int)
+	for i, rec := range recs {
+		if rec.Width == 0 {
+			continue
+		}
+		if j, ok := byDHash[rec.DHash]; ok {
+			union(i, j)
+			continue
+		}
+		byDHash[rec.DHash] = i
+		distinct = append(distinct, i)
+	}
+	if distance >= 64 {
+		for _, i := range distinct[min(1, len(distinct)):] {
+			union(i, distinct[0])
+		}
+		return
+	}
+
+	bands := distance + 1
+	for b, lo := 0, 0; b < bands; b++ {
+		// Spread the 64 bits as evenly as the band count allows.
+		width := 64 / bands
+		if b < 64%bands {
+			width++
+		}
+		mask := uint64(1)<<width - 1
+		buckets := make(map[uint64][]int)
+		for _, i := range distinct {
+			key := recs[i].DHash >> lo & mask
+			for _, j := range buckets[key] {
+				if bits.OnesCount64(recs[i].DHash^recs[j].DHash) <= distance {
+					union(i, j)
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+		lo += width
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"math/bits"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/index"
+	"github.com/Aquila-f/photo-slider/internal/mapper"
+	"github.com/Aquila-f/photo-slider/internal/strategy"
+)
+
+// sizeFingerprinter looks fingerprints up by file content.
+type sizeFingerprinter map[string]domain.Fingerprint
+
+func (f sizeFingerprinter) Fingerprint(_ context.Context, data []byte) (domain.Fingerprint, error) {
+	return f[string(data)], nil
+}
+
+func newDuplicateTestService(t *testing.T, distance int) (*AlbumService, *DuplicateService) {
+	t.Helper()
+	sources := map[string]*domain.Source{
+		"src": {ID: "src", Provider: &mockProvider{
+			walkResult: []domain.DirSnapshot{
+				{Path: "", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}, {Name: "c.jpg"}, {Name: "d.jpg"}}},
+				{Path: "copy", Files: []domain.FileInfo{{Name: "a.jpg"}}},
+			},
+			files: map[string][]byte{
+				"a.jpg":      []byte("original"),
+				"copy/a.jpg": []byte("original"),
+				"b.jpg":      []byte("resized"),
+				"c.jpg":      []byte("other"),
+				"d.jpg":      []byte("small"),
+			},
+		}},
+	}
+	fingerprints := sizeFingerprinter{
+		"original": {Width: 400, Height: 300, DHash: 0xF0F0},
+		"resized":  {Width: 800, Height: 600, DHash: 0xF0F1},
+		"small":    {Width: 200, Height: 150, DHash: 0xF0F3},
+		"other":    {Width: 400, Height: 300, DHash: 0x0F0F_0000},
+	}
+	svc := NewAlbumService(NewSourceService(sources, nil), map[string]*domain.Album{}, strategy.NewFolderAlbumStrategy(), mapper.NewBase64Mapper(), 3)
+	svc.SetIndex(index.NewMemoryIndex(modelExtractor{}, fingerprints))
+	dups := NewDuplicateService(distance)
+	svc.AddIndexObserver(dups)
+	svc.SetDuplicateFinder(dups)
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc, dups
+}
+
+func TestDuplicateService_GroupsExactAndNear(t *testing.T) {
+	_, dups := newDuplicateTestService(t, 2)
+
+	groups := dups.Duplicates(context.Background())
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d: %+v", len(groups), groups)
+	}
+	g := groups[0]
+	if g.Exact {
+		t.Error("group with a resized copy reported as exact")
+	}
+	var paths []string
+	for _, p := range g.Photos {
+		paths = append(paths, p.Path)
+	}
+	want := []string{"b.jpg", "a.jpg", "copy/a.jpg", "d.jpg"}
+	if len(paths) != len(want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("paths = %v, want %v (largest first)", paths, want)
+			break
+		}
+	}
+}
+
+func TestDuplicateService_NegativeDistanceOnlyExact(t *testing.T) {
+	_, dups := newDuplicateTestService(t, -1)
+
+	groups := dups.Duplicates(context.Background())
+	if len(groups) != 1 || !groups[0].Exact || len(groups[0].Photos) != 2 {
+		t.Errorf("groups = %+v, want one exact pair", groups)
+	}
+}
+
+func TestDuplicateService_MetadataPolicy(t *testing.T) {
+	_, dups := newDuplicateTestService(t, -1)
+	dups.SetMetadataPolicy(func(string) domain.MetadataPolicy {
+		return domain.MetadataPolicy{Strip: true}
+	})
+
+	groups := dups.Duplicates(context.Background())
+	if len(groups) != 1 || len(groups[0].Photos) != 2 {
+		t.Fatalf("groups = %+v, want one exact pair", groups)
+	}
+	for _, rec := range groups[0].Photos {
+		if rec.Model != "" || rec.Hash == "" {
+			t.Errorf("%s: Model = %q, Hash = %q; want the model stripped and the hash kept", rec.Path, rec.Model, rec.Hash)
+		}
+	}
+}
+
+func TestAlbumService_CollapseDuplicatesKeepsLargest(t *testing.T) {
+	svc, _ := newDuplicateTestService(t, 2)
+	ctx := context.Background()
+	root := albumKey(t, svc, "default")
+
+	tokens, err := svc.ListPhoto(ctx, root, domain.ListOptions{CollapseDuplicates: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0] != "b.jpg" || tokens[1] != "c.jpg" {
+		t.Errorf("tokens = %v, want [b.jpg c.jpg]", tokens)
+	}
+
+	// The copy folder holds only one member of the group, so it stays.
+	if tokens, _ := svc.ListPhoto(ctx, albumKey(t, svc, "copy"), domain.ListOptions{CollapseDuplicates: true}); len(tokens) != 1 {
+		t.Errorf("copy tokens = %v, want one photo", tokens)
+	}
+	if tokens, _ := svc.ListPhoto(ctx, root, domain.ListOptions{}); len(tokens) != 4 {
+		t.Errorf("uncollapsed tokens = %v, want 4", tokens)
+	}
+}
+
+func TestNearDHashes_MatchesEveryPair(t *testing.T) {
+	// Hashes a few bit flips apart from a handful of bases, so that most
+	// distances find some pairs and miss others.
+	rng := rand.New(rand.NewPCG(1, 2))
+	var recs []domain.PhotoRecord
+	for range 200 {
+		h := []uint64{0, 0xf0f0f0f0f0f0f0f0, 0x123456789abcdef0}[rng.IntN(3)]
+		for range rng.IntN(12) {
+			h ^= 1 << rng.IntN(64)
+		}
+		recs = append(recs, domain.PhotoRecord{Width: 1, DHash: h})
+	}
+	recs = append(recs, domain.PhotoRecord{DHash: recs[0].DHash}) // never decoded
+
+	for _, distance := range []int{0, 1, 3, 6, 10, 63, 64} {
+		want := make(map[[2]int]bool)
+		for i := range recs {
+			for j := i + 1; j < len(recs); j++ {
+				if recs[i].Width != 0 && recs[j].Width != 0 && bits.OnesCount64(recs[i].DHash^recs[j].DHash) <= distance {
+					want[[2]int{i, j}] = true
+				}
+			}
+		}
+		// Compare connected components, since pairs found through a third
+		// record need not be passed to union themselves.
+		got := components(len(recs), func(union func(i, j int)) { nearDHashes(recs, distance, union) })
+		brute := components(len(recs), func(union func(i, j int)) {
+			for p := range want {
+				union(p[0], p[1])
+			}
+		})
+		for i := range recs {
+			for j := range recs {
+				if (got[i] == got[j]) != (brute[i] == brute[j]) {
+					t.Fatalf("distance %d: records %d and %d grouped %v, want %v", distance, i, j, got[i] == got[j], brute[i] == brute[j])
+				}
+			}
+		}
+	}
+}
+
+// components returns the component of each of n records after link has
+// called union on pairs of them.
+func components(n int, link func(union func(i, j int))) []int {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	link(func(i, j int) { parent[find(i)] = find(j) })
+	out := make([]int, n)
+	for i := range out {
+		out[i] = find(i)
+	}
+	return out
+}
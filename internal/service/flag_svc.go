@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+type flagRecord struct {
+	Favorite bool `json:"favorite,omitempty"`
+	Rating   int  `json:"rating,omitempty"`
+	Hidden   bool `json:"hidden,omitempty"`
+}
+
+// FlagService stores favorites, ratings and hidden marks keyed by content
+// hash, so they follow a photo across renames and moves. Photos without
+// stored flags start from the rating in their XMP metadata.
+type FlagService struct {
+	mu       sync.RWMutex
+	store    DocumentStore
+	resolver PhotoResolver
+	index    domain.PhotoIndex
+	flags    map[string]flagRecord // content hash -> flags
+}
+
+func NewFlagService(store DocumentStore, resolver PhotoResolver, index domain.PhotoIndex) (*FlagService, error) {
+	flags := make(map[string]flagRecord)
+	if err := store.Load(&flags); err != nil {
+		return nil, err
+	}
+	return &FlagService{store: store, resolver: resolver, index: index, flags: flags}, nil
+}
+
+func (s *FlagService) Flags(_ context.Context, rec domain.PhotoRecord) domain.PhotoFlags {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[rec.Hash]
+	if !ok || rec.Hash == "" {
+		return domain.PhotoFlags{Rating: rec.Rating}
+	}
+	return domain.PhotoFlags{Favorite: f.Favorite, Rating: f.Rating, Hidden: f.Hidden}
+}
+
+func (s *FlagService) GetFlags(ctx context.Context, albumKey, photoToken string) (domain.PhotoFlags, error) {
+	rec, err := s.record(ctx, albumKey, photoToken)
+	if err != nil {
+		return domain.PhotoFlags{}, err
+	}
+	return s.Flags(ctx, rec), nil
+}
+
+func (s *FlagService) SetFlags(ctx context.Context, albumKey, photoToken string, update domain.FlagUpdate) (domain.PhotoFlags, error) {
+	if update.Rating != nil && (*update.Rating < 0 || *update.Rating > 5) {
+		return domain.PhotoFlags{}, domain.ErrInvalidRating
+	}
+	rec, err := s.record(ctx, albumKey, photoToken)
+	if err != nil {
+		return domain.PhotoFlags{}, err
+	}
+
+	// The update is applied to the stored flags under the same lock that
+	// saves them, so concurrent updates of one photo do not undo each other.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.flags[rec.Hash]
+	next := prev
+	if !existed {
+		next = flagRecord{Rating: rec.Rating}
+	}
+	if update.Favorite != nil {
+		next.Favorite = *update.Favorite
+	}
+	if update.Rating != nil {
+		next.Rating = *update.Rating
+	}
+	if update.Hidden != nil {
+		next.Hidden = *update.Hidden
+	}
+	s.flags[rec.Hash] = next
+	if err := s.store.Save(s.flags); err != nil {
+		if existed {
+			s.flags[rec.Hash] = prev
+		} else {
+			delete(s.flags, rec.Hash)
+		}
+		return domain.PhotoFlags{}, err
+	}
+	return domain.PhotoFlags{Favorite: next.Favorite, Rating: next.Rating, Hidden: next.Hidden}, nil
+}
+
+// record finds the indexed record, and so the content hash, of an album photo.
+func (s *FlagService) record(ctx context.Context, albumKey, photoToken string) (domain.PhotoRecord, error) {
+	ref, err := s.resolver.ResolvePhoto(ctx, albumKey, photoToken)
+	if err != nil {
+		return domain.PhotoRecord{}, err
+	}
+	rec, ok := s.index.Get(ref.SourceID, ref.Path)
+	if !ok || rec.Hash == "" {
+		return domain.PhotoRecord{}, domain.ErrPhotoNotFound
+	}
+	return rec, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+func newFlagTestService(t *testing.T, store *memStore) (*AlbumService, *FlagService) {
+	t.Helper()
+	svc, _ := newSmartTestService(t)
+	flags, err := NewFlagService(store, svc, svc.index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.SetFlagReader(flags)
+	return svc, flags
+}
+
+func albumKey(t *testing.T, svc *AlbumService, name string) string {
+	t.Helper()
+	item, ok := findAlbum(svc.ListAlbums(context.Background()), name)
+	if !ok {
+		t.Fatalf("album %q not found", name)
+	}
+	return item.Key
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestFlagService_HiddenFollowsContent(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+
+	if _, err := flags.SetFlags(ctx, trip, "a.jpg", domain.FlagUpdate{Hidden: ptr(true)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tokens, _ := svc.ListPhoto(ctx, trip, domain.ListOptions{})
+	if len(tokens) != 1 || tokens[0] != "b.jpg" {
+		t.Errorf("trip tokens = %v, want [b.jpg]", tokens)
+	}
+	// c.jpg in another source has the same content, so it is the same photo.
+	if tokens, _ := svc.ListPhoto(ctx, albumKey(t, svc, "default"), domain.ListOptions{}); len(tokens) != 0 {
+		t.Errorf("default tokens = %v, want none", tokens)
+	}
+}
+
+func TestFlagService_FavoritesAndMinRating(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+
+	_, _ = flags.SetFlags(ctx, trip, "a.jpg", domain.FlagUpdate{Favorite: ptr(true), Rating: ptr(2)})
+	_, _ = flags.SetFlags(ctx, trip, "b.jpg", domain.FlagUpdate{Rating: ptr(4)})
+
+	if tokens, _ := svc.ListPhoto(ctx, trip, domain.ListOptions{FavoritesOnly: true}); len(tokens) != 1 || tokens[0] != "a.jpg" {
+		t.Errorf("favorites = %v, want [a.jpg]", tokens)
+	}
+	if tokens, _ := svc.ListPhoto(ctx, trip, domain.ListOptions{MinRating: 3}); len(tokens) != 1 || tokens[0] != "b.jpg" {
+		t.Errorf("min rating 3 = %v, want [b.jpg]", tokens)
+	}
+}
+
+func TestFlagService_PartialUpdateAndPersistence(t *testing.T) {
+	store := &memStore{}
+	svc, flags := newFlagTestService(t, store)
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+
+	_, _ = flags.SetFlags(ctx, trip, "b.jpg", domain.FlagUpdate{Favorite: ptr(true)})
+	got, err := flags.SetFlags(ctx, trip, "b.jpg", domain.FlagUpdate{Rating: ptr(5)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Favorite || got.Rating != 5 {
+		t.Errorf("flags = %+v, want favorite with rating 5", got)
+	}
+
+	_, reloaded := newFlagTestService(t, store)
+	if got, _ := reloaded.GetFlags(ctx, trip, "b.jpg"); !got.Favorite || got.Rating != 5 {
+		t.Errorf("reloaded flags = %+v, want favorite with rating 5", got)
+	}
+}
+
+func TestFlagService_ConcurrentUpdates(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+	ctx := context.Background()
+	trip := albumKey(t, svc, "trip")
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			update := domain.FlagUpdate{Favorite: ptr(true)}
+			if i%2 == 1 {
+				update = domain.FlagUpdate{Rating: ptr(4)}
+			}
+			if _, err := flags.SetFlags(ctx, trip, "b.jpg", update); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := flags.GetFlags(ctx, trip, "b.jpg"); !got.Favorite || got.Rating != 4 {
+		t.Errorf("flags = %+v, want favorite with rating 4", got)
+	}
+}
+
+func TestFlagService_InvalidRating(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+
+	_, err := flags.SetFlags(context.Background(), albumKey(t, svc, "trip"), "a.jpg", domain.FlagUpdate{Rating: ptr(6)})
+	if err != domain.ErrInvalidRating {
+		t.Errorf("expected ErrInvalidRating, got: %v", err)
+	}
+}
+
+func TestFlagService_UnknownPhoto(t *testing.T) {
+	svc, flags := newFlagTestService(t, &memStore{})
+
+	_, err := flags.GetFlags(context.Background(), albumKey(t, svc, "trip"), "nope.jpg")
+	if err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound, got: %v", err)
+	}
+}
+
+func TestFlagService_DefaultsToXMPRating(t *testing.T) {
+	_, flags := newFlagTestService(t, &memStore{})
+
+	got := flags.Flags(context.Background(), domain.PhotoRecord{Hash: "unflagged", Rating: 3})
+	if got != (domain.PhotoFlags{Rating: 3}) {
+		t.Errorf("Flags() = %+v, want rating 3 from XMP", got)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// historyFlushDelay batches the writes of a running slideshow, which reports
+// a shown photo every few seconds.
+const historyFlushDelay = 30 * time.Second
+
+// HistoryService remembers when each viewer last saw each photo. Like flags,
+// history is keyed by content hash. Events are kept in memory and saved at
+// most once per historyFlushDelay, and on Close. Entries older than
+// domain.FreshHorizon are dropped when saving.
+type HistoryService struct {
+	mu       sync.RWMutex
+	store    DocumentStore
+	resolver PhotoResolver
+	index    domain.PhotoIndex
+	shown    map[string]map[string]time.Time // viewer -> content hash -> last shown
+	pending  bool
+	now      func() time.Time
+}
+
+func NewHistoryService(store DocumentStore, resolver PhotoResolver, index domain.PhotoIndex) (*HistoryService, error) {
+	shown := make(map[string]map[string]time.Time)
+	if err := store.Load(&shown); err != nil {
+		return nil, err
+	}
+	return &HistoryService{store: store, resolver: resolver, index: index, shown: shown, now: time.Now}, nil
+}
+
+func (s *HistoryService) LastShown(viewer string, rec domain.PhotoRecord) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.shown[viewer][rec.Hash]
+	return t, ok && rec.Hash != ""
+}
+
+// RecordShown notes that viewer has just been shown an album photo.
+func (s *HistoryService) RecordShown(ctx context.Context, viewer, albumKey, photoToken string) error {
+	ref, err := s.resolver.ResolvePhoto(ctx, albumKey, photoToken)
+	if err != nil {
+		return err
+	}
+	rec, ok := s.index.Get(ref.SourceID, ref.Path)
+	if !ok || rec.Hash == "" {
+		return domain.ErrPhotoNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shown[viewer] == nil {
+		s.shown[viewer] = make(map[string]time.Time)
+	}
+	s.shown[viewer][rec.Hash] = s.now()
+	if !s.pending {
+		s.pending = true
+		time.AfterFunc(historyFlushDelay, s.flush)
+	}
+	return nil
+}
+
+// Close saves the events not saved yet.
+func (s *HistoryService) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *HistoryService) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending {
+		return
+	}
+	if err := s.save(); err != nil {
+		log.Printf("error saving show history: %v", err)
+	}
+}
+
+// save prunes and writes the history. The caller holds s.mu.
+func (s *HistoryService) save() error {
+	s.pending = false
+	cutoff := s.now().Add(-domain.FreshHorizon)
+	for viewer, shown := range s.shown {
+		for hash, t := range shown {
+			if t.Before(cutoff) {
+				delete(shown, hash)
+			}
+		}
+		if len(shown) == 0 {
+			delete(s.shown, viewer)
+		}
+	}
+	return s.store.Save(s.shown)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+func newHistoryTestService(t *testing.T, store *memStore) (*AlbumService, *HistoryService) {
+	t.Helper()
+	svc, _ := newSmartTestService(t)
+	history, err := NewHistoryService(store, svc, svc.index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc, history
+}
+
+func TestHistoryService_RecordShownPerViewer(t *testing.T) {
+	svc, history := newHistoryTestService(t, &memStore{})
+	ctx := context.Background()
+	shownAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return shownAt }
+
+	if err := history.RecordShown(ctx, "kitchen", albumKey(t, svc, "trip"), "a.jpg"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a, _ := svc.index.Get("srcA", "trip/a.jpg")
+	if got, ok := history.LastShown("kitchen", a); !ok || !got.Equal(shownAt) {
+		t.Errorf("LastShown(kitchen) = %v, %v; want %v", got, ok, shownAt)
+	}
+	if _, ok := history.LastShown("hallway", a); ok {
+		t.Error("another viewer should have no history")
+	}
+	// c.jpg in srcB has the same content, so it counts as shown too.
+	c, _ := svc.index.Get("srcB", "c.jpg")
+	if _, ok := history.LastShown("kitchen", c); !ok {
+		t.Error("identical copy should share history")
+	}
+}
+
+func TestHistoryService_PersistsOnFlush(t *testing.T) {
+	store := &memStore{}
+	svc, history := newHistoryTestService(t, store)
+	ctx := context.Background()
+	_ = history.RecordShown(ctx, "kitchen", albumKey(t, svc, "trip"), "b.jpg")
+	history.flush()
+
+	_, reloaded := newHistoryTestService(t, store)
+	b, _ := svc.index.Get("srcA", "trip/b.jpg")
+	if _, ok := reloaded.LastShown("kitchen", b); !ok {
+		t.Error("history lost after reload")
+	}
+}
+
+func TestHistoryService_UnknownPhoto(t *testing.T) {
+	svc, history := newHistoryTestService(t, &memStore{})
+
+	if err := history.RecordShown(context.Background(), "", albumKey(t, svc, "trip"), "nope.jpg"); err == nil {
+		t.Error("expected an error for an unknown photo")
+	}
+}
+
+func TestHistoryService_PrunesStaleEntries(t *testing.T) {
+	store := &memStore{}
+	svc, history := newHistoryTestService(t, store)
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return now.Add(-domain.FreshHorizon - time.Hour) }
+	_ = history.RecordShown(ctx, "kitchen", albumKey(t, svc, "trip"), "a.jpg")
+	_ = history.RecordShown(ctx, "hallway", albumKey(t, svc, "trip"), "a.jpg")
+	history.now = func() time.Time { return now }
+	_ = history.RecordShown(ctx, "kitchen", albumKey(t, svc, "trip"), "b.jpg")
+	history.flush()
+
+	_, reloaded := newHistoryTestService(t, store)
+	a, _ := svc.index.Get("srcA", "trip/a.jpg")
+	b, _ := svc.index.Get("srcA", "trip/b.jpg")
+	if _, ok := reloaded.LastShown("kitchen", a); ok {
+		t.Error("entry older than the fresh horizon was kept")
+	}
+	if _, ok := reloaded.LastShown("kitchen", b); !ok {
+		t.Error("recent entry was dropped")
+	}
+	if _, ok := reloaded.shown["hallway"]; ok {
+		t.Error("viewer without recent entries was kept")
+	}
+}
+
+func TestHistoryService_CloseSavesPending(t *testing.T) {
+	store := &memStore{}
+	svc, history := newHistoryTestService(t, store)
+	_ = history.RecordShown(context.Background(), "kitchen", albumKey(t, svc, "trip"), "b.jpg")
+	if err := history.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, reloaded := newHistoryTestService(t, store)
+	b, _ := svc.index.Get("srcA", "trip/b.jpg")
+	if _, ok := reloaded.LastShown("kitchen", b); !ok {
+		t.Error("history lost after Close")
+	}
+}
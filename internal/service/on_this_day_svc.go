@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+)
+
+const onThisDayUID = "memories:on-this-day"
+
+// OnThisDayService is the virtual album of photos taken on today's month and
+// day in earlier years, give or take window days, oldest year first. "Today"
+// is the date in loc, and the album is rebuilt when it changes.
+type OnThisDayService struct {
+	window    int
+	loc       *time.Location
+	refresher domain.VirtualAlbumRefresher
+	now       func() time.Time
+}
+
+func NewOnThisDayService(window int, loc *time.Location) *OnThisDayService {
+	return &OnThisDayService{window: window, loc: loc, now: time.Now}
+}
+
+// SetRefresher sets the VirtualAlbumRefresher called at every midnight.
+func (s *OnThisDayService) SetRefresher(r domain.VirtualAlbumRefresher) {
+	s.refresher = r
+}
+
+// Run rebuilds the album at every midnight in the service's timezone until
+// ctx is done.
+func (s *OnThisDayService) Run(ctx context.Context) {
+	for {
+		now := s.now().In(s.loc)
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, s.loc)
+		timer := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if s.refresher == nil {
+			continue
+		}
+		if err := s.refresher.RefreshVirtualAlbums(ctx); err != nil {
+			log.Printf("error refreshing on this day: %v", err)
+		}
+	}
+}
+
+func (s *OnThisDayService) VirtualAlbums(_ context.Context, records []domain.PhotoRecord) ([]domain.Album, error) {
+	today := s.now().In(s.loc)
+	var matched []domain.PhotoRecord
+	for _, rec := range records {
+		if rec.TakenAt != nil && s.onThisDay(*rec.TakenAt, today) {
+			matched = append(matched, rec)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return query.WallClock(*matched[i].TakenAt).Before(query.WallClock(*matched[j].TakenAt))
+	})
+
+	album := domain.Album{UID: onThisDayUID, Name: "On this day", Photos: make([]domain.PhotoInfo, 0, len(matched))}
+	for _, rec := range matched {
+		album.Photos = append(album.Photos, domain.PhotoInfo{SourceID: rec.SourceID, Path: rec.Path})
+	}
+	return []domain.Album{album}, nil
+}
+
+// onThisDay reports whether taken falls within window days of today's month
+// and day in an earlier year. Anniversaries in the neighbouring years are
+// checked too, so a window around New Year's Day spans the year boundary.
+func (s *OnThisDayService) onThisDay(taken, today time.Time) bool {
+	day := dateOf(query.WallClock(taken))
+	for year := day.Year() - 1; year <= day.Year()+1; year++ {
+		if year >= today.Year() {
+			break
+		}
+		anniversary := time.Date(year, today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+		if days := int(day.Sub(anniversary).Hours() / 24); -s.window <= days && days <= s.window {
+			return true
+		}
+	}
+	return false
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+func takenOn(path, at string) domain.PhotoRecord {
+	t, err := time.Parse(time.DateTime, at)
+	if err != nil {
+		panic(err)
+	}
+	return domain.PhotoRecord{SourceID: "src", Path: path, TakenAt: &t}
+}
+
+func onThisDayPaths(t *testing.T, s *OnThisDayService, records []domain.PhotoRecord) []string {
+	t.Helper()
+	albums, err := s.VirtualAlbums(context.Background(), records)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(albums) != 1 || albums[0].UID != "memories:on-this-day" {
+		t.Fatalf("unexpected albums: %+v", albums)
+	}
+	var paths []string
+	for _, p := range albums[0].Photos {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestOnThisDayService_EarlierYearsByYear(t *testing.T) {
+	s := NewOnThisDayService(0, time.UTC)
+	s.now = func() time.Time { return time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC) }
+
+	got := onThisDayPaths(t, s, []domain.PhotoRecord{
+		takenOn("2021.jpg", "2021-10-19 18:00:00"),
+		takenOn("2019b.jpg", "2019-10-19 12:00:00"),
+		takenOn("2019a.jpg", "2019-10-19 08:00:00"),
+		takenOn("today.jpg", "2026-10-19 08:00:00"),
+		takenOn("nextday.jpg", "2020-10-20 08:00:00"),
+		{SourceID: "src", Path: "undated.jpg"},
+	})
+	want := []string{"2019a.jpg", "2019b.jpg", "2021.jpg"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestOnThisDayService_WindowSpansNewYear(t *testing.T) {
+	s := NewOnThisDayService(2, time.UTC)
+	s.now = func() time.Time { return time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC) }
+
+	got := onThisDayPaths(t, s, []domain.PhotoRecord{
+		takenOn("eve.jpg", "2024-12-30 23:00:00"),
+		takenOn("jan3.jpg", "2025-01-03 10:00:00"),
+		takenOn("jan4.jpg", "2025-01-04 10:00:00"),
+		takenOn("lastweek.jpg", "2025-12-30 10:00:00"),
+	})
+	// lastweek.jpg is within the window of this year's date, not an earlier one.
+	want := []string{"eve.jpg", "jan3.jpg"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestOnThisDayService_DayFollowsTimezone(t *testing.T) {
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+	s := NewOnThisDayService(0, taipei)
+	// 20:00 UTC on the 18th is already the 19th in Taipei.
+	s.now = func() time.Time { return time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC) }
+
+	got := onThisDayPaths(t, s, []domain.PhotoRecord{
+		takenOn("18th.jpg", "2020-10-18 10:00:00"),
+		takenOn("19th.jpg", "2020-10-19 10:00:00"),
+	})
+	if len(got) != 1 || got[0] != "19th.jpg" {
+		t.Fatalf("expected [19th.jpg], got %v", got)
+	}
+}
+
+type countingRefresher struct{ refreshed chan struct{} }
+
+func (r *countingRefresher) RefreshVirtualAlbums(context.Context) error {
+	r.refreshed <- struct{}{}
+	return nil
+}
+
+func TestOnThisDayService_RefreshesAtMidnight(t *testing.T) {
+	s := NewOnThisDayService(0, time.UTC)
+	midnight := time.Now().Add(20 * time.Millisecond)
+	s.now = func() time.Time {
+		return time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC).Add(-time.Until(midnight))
+	}
+	r := &countingRefresher{refreshed: make(chan struct{}, 1)}
+	s.SetRefresher(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case <-r.refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a refresh at midnight")
+	}
+}
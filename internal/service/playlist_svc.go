@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// DocumentStore persists a whole document, such as the list of playlists.
+type DocumentStore interface {
+	Load(v any) error
+	Save(v any) error
+}
+
+// PhotoResolver is implemented by AlbumService to turn album photos picked by
+// a client into album-independent refs.
+type PhotoResolver interface {
+	ResolvePhoto(ctx context.Context, albumKey, photoToken string) (domain.PhotoRef, error)
+}
+
+type playlistRecord struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Photos []domain.PhotoRef `json:"photos"`
+}
+
+// PlaylistService owns hand-picked playlists, persists them to a
+// DocumentStore and serves them as virtual albums.
+type PlaylistService struct {
+	mu          sync.RWMutex
+	store       DocumentStore
+	resolver    PhotoResolver
+	albumMapper domain.Mapper
+	refresher   domain.VirtualAlbumRefresher
+	playlists   map[string]playlistRecord
+}
+
+func NewPlaylistService(store DocumentStore, resolver PhotoResolver, mapper domain.Mapper) (*PlaylistService, error) {
+	var recs []playlistRecord
+	if err := store.Load(&recs); err != nil {
+		return nil, err
+	}
+	playlists := make(map[string]playlistRecord, len(recs))
+	for _, rec := range recs {
+		playlists[rec.ID] = rec
+	}
+	return &PlaylistService{store: store, resolver: resolver, albumMapper: mapper, playlists: playlists}, nil
+}
+
+// SetRefresher sets the VirtualAlbumRefresher used to rebuild albums when a
+// playlist changes.
+func (s *PlaylistService) SetRefresher(r domain.VirtualAlbumRefresher) {
+	s.refresher = r
+}
+
+func (s *PlaylistService) ListPlaylists(_ context.Context) []domain.Playlist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.Playlist, 0, len(s.playlists))
+	for _, rec := range s.playlists {
+		out = append(out, s.toPlaylist(rec))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *PlaylistService) GetPlaylist(_ context.Context, id string) (domain.Playlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.playlists[id]
+	if !ok {
+		return domain.Playlist{}, domain.ErrPlaylistNotFound
+	}
+	return s.toPlaylist(rec), nil
+}
+
+func (s *PlaylistService) CreatePlaylist(ctx context.Context, name string, photos []domain.AlbumPhoto) (domain.Playlist, error) {
+	refs, err := s.resolve(ctx, photos)
+	if err != nil {
+		return domain.Playlist{}, err
+	}
+	rec := playlistRecord{ID: newID(), Name: name, Photos: refs}
+	if err := s.put(ctx, rec, false); err != nil {
+		return domain.Playlist{}, err
+	}
+	return s.toPlaylist(rec), nil
+}
+
+// UpdatePlaylist replaces the name and photos of an existing playlist.
+func (s *PlaylistService) UpdatePlaylist(ctx context.Context, id, name string, photos []domain.AlbumPhoto) (domain.Playlist, error) {
+	s.mu.RLock()
+	_, ok := s.playlists[id]
+	s.mu.RUnlock()
+	if !ok {
+		return domain.Playlist{}, domain.ErrPlaylistNotFound
+	}
+	refs, err := s.resolve(ctx, photos)
+	if err != nil {
+		return domain.Playlist{}, err
+	}
+	rec := playlistRecord{ID: id, Name: name, Photos: refs}
+	// The playlist may have been deleted while its photos were resolved.
+	if err := s.put(ctx, rec, true); err != nil {
+		return domain.Playlist{}, err
+	}
+	return s.toPlaylist(rec), nil
+}
+
+func (s *PlaylistService) DeletePlaylist(ctx context.Context, id string) error {
+	s.mu.Lock()
+	if _, ok := s.playlists[id]; !ok {
+		s.mu.Unlock()
+		return domain.ErrPlaylistNotFound
+	}
+	delete(s.playlists, id)
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.refresh(ctx)
+}
+
+func (s *PlaylistService) VirtualAlbums(_ context.Context, records []domain.PhotoRecord) ([]domain.Album, error) {
+	indexed := make(map[domain.PhotoRef]struct{}, len(records))
+	for _, rec := range records {
+		indexed[domain.PhotoRef{SourceID: rec.SourceID, Path: rec.Path}] = struct{}{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	albums := make([]domain.Album, 0, len(s.playlists))
+	for id, rec := range s.playlists {
+		// Photos that were deleted or whose source was removed are skipped
+		// but kept in the playlist, so they return if the file does.
+		photos := make([]domain.PhotoInfo, 0, len(rec.Photos))
+		for _, ref := range rec.Photos {
+			if _, ok := indexed[ref]; ok {
+				photos = append(photos, domain.PhotoInfo{SourceID: ref.SourceID, Path: ref.Path})
+			}
+		}
+		albums = append(albums, domain.Album{UID: playlistUID(id), Name: rec.Name, Photos: photos})
+	}
+	return albums, nil
+}
+
+func (s *PlaylistService) resolve(ctx context.Context, photos []domain.AlbumPhoto) ([]domain.PhotoRef, error) {
+	refs := make([]domain.PhotoRef, 0, len(photos))
+	for _, p := range photos {
+		ref, err := s.resolver.ResolvePhoto(ctx, p.AlbumKey, p.Token)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// put stores and saves rec. With mustExist it only replaces a playlist that
+// is still there, and fails with ErrPlaylistNotFound otherwise.
+func (s *PlaylistService) put(ctx context.Context, rec playlistRecord, mustExist bool) error {
+	s.mu.Lock()
+	prev, existed := s.playlists[rec.ID]
+	if mustExist && !existed {
+		s.mu.Unlock()
+		return domain.ErrPlaylistNotFound
+	}
+	s.playlists[rec.ID] = rec
+	if err := s.save(); err != nil {
+		if existed {
+			s.playlists[rec.ID] = prev
+		} else {
+			delete(s.playlists, rec.ID)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+	return s.refresh(ctx)
+}
+
+// save writes every playlist to the store; callers must hold mu.
+func (s *PlaylistService) save() error {
+	recs := make([]playlistRecord, 0, len(s.playlists))
+	for _, rec := range s.playlists {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ID < recs[j].ID })
+	return s.store.Save(recs)
+}
+
+func (s *PlaylistService) refresh(ctx context.Context) error {
+	if s.refresher == nil {
+		return nil
+	}
+	return s.refresher.RefreshVirtualAlbums(ctx)
+}
+
+func (s *PlaylistService) toPlaylist(rec playlistRecord) domain.Playlist {
+	return domain.Playlist{
+		ID:     rec.ID,
+		Key:    s.albumMapper.Encode(playlistUID(rec.ID)),
+		Name:   rec.Name,
+		Photos: rec.Photos,
+	}
+}
+
+func playlistUID(id string) string {
+	return "playlist:" + id
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
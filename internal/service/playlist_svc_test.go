@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/mapper"
+)
+
+// memStore is a DocumentStore that round-trips through JSON in memory.
+type memStore struct {
+	data []byte
+}
+
+func (m *memStore) Load(v any) error {
+	if m.data == nil {
+		return nil
+	}
+	return json.Unmarshal(m.data, v)
+}
+
+func (m *memStore) Save(v any) error {
+	data, err := json.Marshal(v)
+	m.data = data
+	return err
+}
+
+func newPlaylistTestService(t *testing.T, store *memStore) (*AlbumService, *PlaylistService) {
+	t.Helper()
+	svc, _ := newSmartTestService(t)
+	playlists, err := NewPlaylistService(store, svc, mapper.NewBase64Mapper())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	playlists.SetRefresher(svc)
+	svc.AddVirtualSource(playlists)
+	if err := svc.RefreshVirtualAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc, playlists
+}
+
+// pick returns the album photos for tokens of the named folder album.
+func pick(t *testing.T, svc *AlbumService, album string, tokens ...string) []domain.AlbumPhoto {
+	t.Helper()
+	item, ok := findAlbum(svc.ListAlbums(context.Background()), album)
+	if !ok {
+		t.Fatalf("album %q not found", album)
+	}
+	photos := make([]domain.AlbumPhoto, 0, len(tokens))
+	for _, token := range tokens {
+		photos = append(photos, domain.AlbumPhoto{AlbumKey: item.Key, Token: token})
+	}
+	return photos
+}
+
+func TestPlaylistService_CreatePlaysInOrderAcrossSources(t *testing.T) {
+	svc, playlists := newPlaylistTestService(t, &memStore{})
+	ctx := context.Background()
+
+	photos := append(pick(t, svc, "default", "c.jpg"), pick(t, svc, "trip", "b.jpg", "a.jpg")...)
+	pl, err := playlists.CreatePlaylist(ctx, "Best of", photos)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tokens, err := svc.ListPhoto(ctx, pl.Key, domain.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"X100", "R5", "X100"}
+	if len(tokens) != len(want) {
+		t.Fatalf("expected %d photos, got %d", len(want), len(tokens))
+	}
+	for i, token := range tokens {
+		data, err := svc.ReadPhoto(ctx, pl.Key, token)
+		if err != nil {
+			t.Fatalf("ReadPhoto(%q) error: %v", token, err)
+		}
+		if string(data) != want[i] {
+			t.Errorf("photo %d = %q, want %q", i, data, want[i])
+		}
+	}
+	if _, ok := findAlbum(svc.ListAlbums(ctx), "Best of"); !ok {
+		t.Error("playlist not listed as an album")
+	}
+}
+
+func TestPlaylistService_PersistsAcrossRestart(t *testing.T) {
+	store := &memStore{}
+	svc, playlists := newPlaylistTestService(t, store)
+	ctx := context.Background()
+	created, err := playlists.CreatePlaylist(ctx, "Dinner", pick(t, svc, "trip", "a.jpg"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, reloaded := newPlaylistTestService(t, store)
+	got, err := reloaded.GetPlaylist(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Name != "Dinner" || len(got.Photos) != 1 || got.Photos[0].Path != "trip/a.jpg" {
+		t.Errorf("reloaded playlist = %+v", got)
+	}
+}
+
+func TestPlaylistService_UpdateAndDelete(t *testing.T) {
+	svc, playlists := newPlaylistTestService(t, &memStore{})
+	ctx := context.Background()
+	pl, _ := playlists.CreatePlaylist(ctx, "Draft", pick(t, svc, "trip", "a.jpg"))
+
+	updated, err := playlists.UpdatePlaylist(ctx, pl.ID, "Final", pick(t, svc, "trip", "a.jpg", "b.jpg"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Name != "Final" || len(updated.Photos) != 2 {
+		t.Errorf("updated = %+v", updated)
+	}
+	if tokens, _ := svc.ListPhoto(ctx, pl.Key, domain.ListOptions{}); len(tokens) != 2 {
+		t.Errorf("album has %d photos after update, want 2", len(tokens))
+	}
+
+	if err := playlists.DeletePlaylist(ctx, pl.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.ListPhoto(ctx, pl.Key, domain.ListOptions{}); err != domain.ErrAlbumNotFound {
+		t.Errorf("expected ErrAlbumNotFound after delete, got: %v", err)
+	}
+	if _, err := playlists.UpdatePlaylist(ctx, pl.ID, "x", nil); err != domain.ErrPlaylistNotFound {
+		t.Errorf("expected ErrPlaylistNotFound, got: %v", err)
+	}
+}
+
+func TestPlaylistService_CreateRejectsUnknownPhoto(t *testing.T) {
+	svc, playlists := newPlaylistTestService(t, &memStore{})
+
+	_, err := playlists.CreatePlaylist(context.Background(), "Bad", pick(t, svc, "trip", "nope.jpg"))
+	if err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound, got: %v", err)
+	}
+	if n := len(playlists.ListPlaylists(context.Background())); n != 0 {
+		t.Errorf("expected no playlists, got %d", n)
+	}
+}
+
+// hookResolver runs hook before resolving each photo.
+type hookResolver struct {
+	PhotoResolver
+	hook func()
+}
+
+func (r hookResolver) ResolvePhoto(ctx context.Context, albumKey, photoToken string) (domain.PhotoRef, error) {
+	r.hook()
+	return r.PhotoResolver.ResolvePhoto(ctx, albumKey, photoToken)
+}
+
+func TestPlaylistService_UpdateAfterConcurrentDelete(t *testing.T) {
+	store := &memStore{}
+	svc, playlists := newPlaylistTestService(t, store)
+	ctx := context.Background()
+	pl, _ := playlists.CreatePlaylist(ctx, "Draft", pick(t, svc, "trip", "a.jpg"))
+
+	// The playlist is deleted after the update checked for it but before it
+	// is stored.
+	playlists.resolver = hookResolver{svc, func() { _ = playlists.DeletePlaylist(ctx, pl.ID) }}
+	if _, err := playlists.UpdatePlaylist(ctx, pl.ID, "Final", pick(t, svc, "trip", "b.jpg")); err != domain.ErrPlaylistNotFound {
+		t.Errorf("expected ErrPlaylistNotFound, got: %v", err)
+	}
+	if _, err := playlists.GetPlaylist(ctx, pl.ID); err != domain.ErrPlaylistNotFound {
+		t.Errorf("deleted playlist came back: %v", err)
+	}
+
+	reloaded, err := NewPlaylistService(store, svc, mapper.NewBase64Mapper())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(reloaded.ListPlaylists(ctx)); n != 0 {
+		t.Errorf("saved %d playlists, want 0", n)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+	"github.com/Aquila-f/photo-slider/internal/search"
+)
+
+// SearchService answers photo searches from an inverted index rebuilt after
+// every scan. Hits play through AlbumService's library album.
+type SearchService struct {
+	mu     sync.RWMutex
+	index  *search.Index
+	mapper domain.Mapper
+	flags  domain.FlagReader
+	// metadata returns the metadata policy of a source; nil serves metadata
+	// as stored.
+	metadata func(sourceID string) domain.MetadataPolicy
+}
+
+func NewSearchService(mapper domain.Mapper) *SearchService {
+	return &SearchService{index: search.NewIndex(nil), mapper: mapper}
+}
+
+// SetFlagReader sets the FlagReader used to leave hidden photos out of
+// results.
+func (s *SearchService) SetFlagReader(flags domain.FlagReader) {
+	s.flags = flags
+}
+
+// SetMetadataPolicy sets the metadata policy of each source. Records are
+// indexed without the fields their policy hides, so searches can neither
+// match nor return them. It takes effect from the next scan.
+func (s *SearchService) SetMetadataPolicy(policy func(sourceID string) domain.MetadataPolicy) {
+	s.metadata = policy
+}
+
+func (s *SearchService) IndexChanged(_ context.Context, records []domain.PhotoRecord) {
+	if s.metadata != nil {
+		filtered := make([]domain.PhotoRecord, len(records))
+		for i, rec := range records {
+			filtered[i] = s.metadata(rec.SourceID).FilterRecord(rec)
+		}
+		records = filtered
+	}
+	index := search.NewIndex(records)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = index
+}
+
+// Search returns up to limit hits for q starting at offset.
+func (s *SearchService) Search(ctx context.Context, q string, offset, limit int) (domain.SearchResult, error) {
+	parsed, err := query.Parse(q)
+	if err != nil {
+		return domain.SearchResult{}, err
+	}
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+
+	var hits []domain.PhotoRecord
+	for _, rec := range index.Search(parsed) {
+		if s.flags != nil && s.flags.Flags(ctx, rec).Hidden {
+			continue
+		}
+		hits = append(hits, rec)
+	}
+
+	result := domain.SearchResult{Total: len(hits), Album: s.mapper.Encode(libraryAlbumUID), Photos: []domain.SearchHit{}}
+	if offset >= len(hits) {
+		return result, nil
+	}
+	hits = hits[offset:min(offset+limit, len(hits))]
+	for _, rec := range hits {
+		result.Photos = append(result.Photos, domain.SearchHit{
+			Key:      domain.EncodePhotoRef(s.mapper, rec.SourceID, rec.Path),
+			Type:     domain.MediaType(rec.Path),
+			SourceID: rec.SourceID,
+			Path:     rec.Path,
+			TakenAt:  rec.TakenAt,
+			Model:    rec.Model,
+		})
+	}
+	return result, nil
+}
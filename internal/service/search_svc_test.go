@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/mapper"
+)
+
+func newSearchTestService(t *testing.T) (*AlbumService, *SearchService) {
+	t.Helper()
+	svc, _ := newSmartTestService(t)
+	searchSvc := NewSearchService(mapper.NewBase64Mapper())
+	svc.AddIndexObserver(searchSvc)
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc, searchSvc
+}
+
+func TestSearchService_HitsPlayThroughPhotoRoute(t *testing.T) {
+	svc, searchSvc := newSearchTestService(t)
+	ctx := context.Background()
+
+	result, err := searchSvc.Search(ctx, "x100", 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Total != 2 || len(result.Photos) != 2 {
+		t.Fatalf("result = %+v, want 2 hits", result)
+	}
+	for _, hit := range result.Photos {
+		data, err := svc.ReadPhoto(ctx, result.Album, hit.Key)
+		if err != nil {
+			t.Fatalf("ReadPhoto(%q) error: %v", hit.Key, err)
+		}
+		if string(data) != "X100" {
+			t.Errorf("ReadPhoto(%q) = %q, want X100 photo", hit.Key, data)
+		}
+	}
+	if _, ok := findAlbum(svc.ListAlbums(ctx), "Library"); ok {
+		t.Error("library album should not be listed")
+	}
+}
+
+func TestSearchService_Paginates(t *testing.T) {
+	_, searchSvc := newSearchTestService(t)
+	ctx := context.Background()
+
+	page, _ := searchSvc.Search(ctx, "", 1, 1)
+	if page.Total != 3 || len(page.Photos) != 1 || page.Photos[0].Path != "trip/b.jpg" {
+		t.Errorf("page = %+v, want trip/b.jpg of 3", page)
+	}
+	past, _ := searchSvc.Search(ctx, "", 5, 1)
+	if past.Total != 3 || len(past.Photos) != 0 {
+		t.Errorf("page past the end = %+v", past)
+	}
+}
+
+func TestSearchService_SkipsHidden(t *testing.T) {
+	svc, searchSvc := newSearchTestService(t)
+	flags, err := NewFlagService(&memStore{}, svc, svc.index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	searchSvc.SetFlagReader(flags)
+	ctx := context.Background()
+	_, _ = flags.SetFlags(ctx, albumKey(t, svc, "trip"), "b.jpg", domain.FlagUpdate{Hidden: ptr(true)})
+
+	if result, _ := searchSvc.Search(ctx, "r5", 0, 10); result.Total != 0 {
+		t.Errorf("hidden photo found: %+v", result)
+	}
+}
+
+func TestSearchService_InvalidQuery(t *testing.T) {
+	_, searchSvc := newSearchTestService(t)
+
+	_, err := searchSvc.Search(context.Background(), "color:red", 0, 10)
+	if !errors.Is(err, domain.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got: %v", err)
+	}
+}
+
+func TestSearchService_MetadataPolicy(t *testing.T) {
+	svc, searchSvc := newSearchTestService(t)
+	ctx := context.Background()
+	policy := func(sourceID string) domain.MetadataPolicy {
+		return domain.MetadataPolicy{Strip: sourceID == "srcA"}
+	}
+	svc.SetMetadataPolicy(policy)
+	searchSvc.SetMetadataPolicy(policy)
+	if err := svc.SyncAlbums(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The stripped model can be neither matched nor returned.
+	result, err := searchSvc.Search(ctx, `model:"X100"`, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Photos) != 1 || result.Photos[0].SourceID != "srcB" {
+		t.Fatalf("result = %+v, want the srcB hit only", result)
+	}
+	all, err := searchSvc.Search(ctx, "", 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, hit := range all.Photos {
+		if hit.SourceID == "srcA" && (hit.Model != "" || hit.TakenAt != nil) {
+			t.Errorf("%s: hit carries %q %v", hit.Path, hit.Model, hit.TakenAt)
+		}
+		got, err := svc.MetadataPolicy(ctx, result.Album, hit.Key)
+		if err != nil || got.Strip != (hit.SourceID == "srcA") {
+			t.Errorf("%s: MetadataPolicy() = %+v, %v", hit.Path, got, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/query"
+)
+
+type smartAlbum struct {
+	def   domain.SmartAlbum
+	query *query.Query
+	// stored marks albums created through AddSmartAlbum, which are persisted;
+	// the ones from config are not.
+	stored bool
+}
+
+type smartAlbumRecord struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// SmartAlbumService owns the smart album definitions, persists the ones
+// created at runtime to a DocumentStore and evaluates them as virtual albums
+// over the photo index.
+type SmartAlbumService struct {
+	mu        sync.RWMutex
+	store     DocumentStore
+	albums    map[string]smartAlbum
+	refresher domain.VirtualAlbumRefresher
+}
+
+// NewSmartAlbumService loads the smart albums persisted in store on top of
+// the configured ones; a stored album replaces a configured one of the same
+// name.
+func NewSmartAlbumService(store DocumentStore, configured []domain.SmartAlbum) (*SmartAlbumService, error) {
+	var recs []smartAlbumRecord
+	if err := store.Load(&recs); err != nil {
+		return nil, err
+	}
+	albums := make(map[string]smartAlbum, len(configured)+len(recs))
+	add := func(def domain.SmartAlbum, stored bool) error {
+		q, err := query.Parse(def.Query)
+		if err != nil {
+			return fmt.Errorf("smart album %q: %w", def.Name, err)
+		}
+		albums[def.Name] = smartAlbum{def: def, query: q, stored: stored}
+		return nil
+	}
+	for _, def := range configured {
+		if err := add(def, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, rec := range recs {
+		if err := add(domain.SmartAlbum{Name: rec.Name, Query: rec.Query}, true); err != nil {
+			return nil, err
+		}
+	}
+	return &SmartAlbumService{store: store, albums: albums}, nil
+}
+
+// SetRefresher sets the VirtualAlbumRefresher used to rebuild albums when a
+// definition changes.
+func (s *SmartAlbumService) SetRefresher(r domain.VirtualAlbumRefresher) {
+	s.refresher = r
+}
+
+func (s *SmartAlbumService) ListSmartAlbums(_ context.Context) []domain.SmartAlbum {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	defs := make([]domain.SmartAlbum, 0, len(s.albums))
+	for _, a := range s.albums {
+		defs = append(defs, a.def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// AddSmartAlbum creates or replaces the smart album with the same name.
+func (s *SmartAlbumService) AddSmartAlbum(ctx context.Context, def domain.SmartAlbum) error {
+	q, err := query.Parse(def.Query)
+	if err != nil {
+		return fmt.Errorf("smart album %q: %w", def.Name, err)
+	}
+	s.mu.Lock()
+	prev, existed := s.albums[def.Name]
+	s.albums[def.Name] = smartAlbum{def: def, query: q, stored: true}
+	if err := s.save(); err != nil {
+		if existed {
+			s.albums[def.Name] = prev
+		} else {
+			delete(s.albums, def.Name)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+	return s.refresh(ctx)
+}
+
+// DeleteSmartAlbum removes a smart album. Albums from config come back on
+// the next start.
+func (s *SmartAlbumService) DeleteSmartAlbum(ctx context.Context, name string) error {
+	s.mu.Lock()
+	prev, ok := s.albums[name]
+	if !ok {
+		s.mu.Unlock()
+		return domain.ErrAlbumNotFound
+	}
+	delete(s.albums, name)
+	if prev.stored {
+		if err := s.save(); err != nil {
+			s.albums[name] = prev
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+	return s.refresh(ctx)
+}
+
+// save persists the stored albums. Callers hold s.mu.
+func (s *SmartAlbumService) save() error {
+	recs := make([]smartAlbumRecord, 0, len(s.albums))
+	for _, a := range s.albums {
+		if a.stored {
+			recs = append(recs, smartAlbumRecord{Name: a.def.Name, Query: a.def.Query})
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Name < recs[j].Name })
+	return s.store.Save(recs)
+}
+
+func (s *SmartAlbumService) refresh(ctx context.Context) error {
+	if s.refresher == nil {
+		return nil
+	}
+	return s.refresher.RefreshVirtualAlbums(ctx)
+}
+
+func (s *SmartAlbumService) VirtualAlbums(_ context.Context, records []domain.PhotoRecord) ([]domain.Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	albums := make([]domain.Album, 0, len(s.albums))
+	for name, a := range s.albums {
+		matched := a.query.Filter(records)
+		photos := make([]domain.PhotoInfo, 0, len(matched))
+		for _, rec := range matched {
+			photos = append(photos, domain.PhotoInfo{SourceID: rec.SourceID, Path: rec.Path})
+		}
+		albums = append(albums, domain.Album{UID: "smart:" + name, Name: name, Photos: photos})
+	}
+	return albums, nil
+}
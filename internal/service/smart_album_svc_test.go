@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/index"
+	"github.com/Aquila-f/photo-slider/internal/mapper"
+	"github.com/Aquila-f/photo-slider/internal/strategy"
+)
+
+// modelExtractor reports the file content as the camera model.
+type modelExtractor struct{}
+
+func (modelExtractor) Extract(_ context.Context, data []byte) (*domain.PhotoMeta, error) {
+	return &domain.PhotoMeta{Model: string(data)}, nil
+}
+
+// newSmartTestService wires two sources, an index and smart albums together.
+func newSmartTestService(t *testing.T) (*AlbumService, *SmartAlbumService) {
+	t.Helper()
+	sources := map[string]*domain.Source{
+		"srcA": {ID: "srcA", Provider: &mockProvider{
+			walkResult: []domain.DirSnapshot{{Path: "trip", Files: []domain.FileInfo{{Name: "a.jpg"}, {Name: "b.jpg"}}}},
+			files:      map[string][]byte{"trip/a.jpg": []byte("X100"), "trip/b.jpg": []byte("R5")},
+		}},
+		"srcB": {ID: "srcB", Provider: &mockProvider{
+			walkResult: []domain.DirSnapshot{{Path: "", Files: []domain.FileInfo{{Name: "c.jpg"}}}},
+			files:      map[string][]byte{"c.jpg": []byte("X100")},
+		}},
+	}
+	sourceSvc := NewSourceService(sources, nil)
+	svc := NewAlbumService(sourceSvc, map[string]*domain.Album{}, strategy.NewFolderAlbumStrategy(), mapper.NewBase64Mapper(), 3)
+	svc.SetIndex(index.NewMemoryIndex(modelExtractor{}, nil))
+	smart, err := NewSmartAlbumService(&memStore{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	smart.SetRefresher(svc)
+	svc.AddVirtualSource(smart)
+	if err := svc.SyncAlbums(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return svc, smart
+}
+
+func findAlbum(items []domain.AlbumItem, name string) (domain.AlbumItem, bool) {
+	for _, item := range items {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return domain.AlbumItem{}, false
+}
+
+func TestSmartAlbumService_SpansSources(t *testing.T) {
+	svc, smart := newSmartTestService(t)
+	ctx := context.Background()
+
+	if err := smart.AddSmartAlbum(ctx, domain.SmartAlbum{Name: "Fuji", Query: "model:x100"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item, ok := findAlbum(svc.ListAlbums(ctx), "Fuji")
+	if !ok {
+		t.Fatal("smart album not listed")
+	}
+	tokens, err := svc.ListPhoto(ctx, item.Key, domain.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 photos, got %d", len(tokens))
+	}
+	for _, token := range tokens {
+		data, err := svc.ReadPhoto(ctx, item.Key, token)
+		if err != nil {
+			t.Fatalf("ReadPhoto(%q) error: %v", token, err)
+		}
+		if string(data) != "X100" {
+			t.Errorf("ReadPhoto(%q) = %q, want X100 photo", token, data)
+		}
+	}
+}
+
+func TestSmartAlbumService_ReadPhotoRejectsForeignToken(t *testing.T) {
+	svc, smart := newSmartTestService(t)
+	ctx := context.Background()
+	_ = smart.AddSmartAlbum(ctx, domain.SmartAlbum{Name: "Canon", Query: "model:r5"})
+
+	item, _ := findAlbum(svc.ListAlbums(ctx), "Canon")
+	foreign := domain.EncodePhotoRef(mapper.NewBase64Mapper(), "srcB", "c.jpg")
+	if _, err := svc.ReadPhoto(ctx, item.Key, foreign); err != domain.ErrPhotoNotFound {
+		t.Errorf("expected ErrPhotoNotFound, got: %v", err)
+	}
+}
+
+func TestSmartAlbumService_InvalidQuery(t *testing.T) {
+	_, smart := newSmartTestService(t)
+
+	err := smart.AddSmartAlbum(context.Background(), domain.SmartAlbum{Name: "bad", Query: "color:red"})
+	if !errors.Is(err, domain.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got: %v", err)
+	}
+	if n := len(smart.ListSmartAlbums(context.Background())); n != 0 {
+		t.Errorf("expected no smart albums, got %d", n)
+	}
+}
+
+func TestSmartAlbumService_DeleteAndRescan(t *testing.T) {
+	svc, smart := newSmartTestService(t)
+	ctx := context.Background()
+	_ = smart.AddSmartAlbum(ctx, domain.SmartAlbum{Name: "All", Query: ""})
+
+	// A rescan keeps smart albums and re-evaluates them.
+	if err := svc.SyncAlbums(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	item, ok := findAlbum(svc.ListAlbums(ctx), "All")
+	if !ok {
+		t.Fatal("smart album lost on rescan")
+	}
+	if tokens, _ := svc.ListPhoto(ctx, item.Key, domain.ListOptions{}); len(tokens) != 3 {
+		t.Errorf("expected 3 photos, got %d", len(tokens))
+	}
+
+	if err := smart.DeleteSmartAlbum(ctx, "All"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := findAlbum(svc.ListAlbums(ctx), "All"); ok {
+		t.Error("deleted smart album still listed")
+	}
+	if err := smart.DeleteSmartAlbum(ctx, "All"); err != domain.ErrAlbumNotFound {
+		t.Errorf("expected ErrAlbumNotFound, got: %v", err)
+	}
+}
+
+func TestSmartAlbumService_Persistence(t *testing.T) {
+	store := &memStore{}
+	configured := []domain.SmartAlbum{{Name: "Fuji", Query: "model:x100"}, {Name: "Canon", Query: "model:r5"}}
+	smart, err := NewSmartAlbumService(store, configured)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	_ = smart.AddSmartAlbum(ctx, domain.SmartAlbum{Name: "All", Query: ""})
+	_ = smart.AddSmartAlbum(ctx, domain.SmartAlbum{Name: "Canon", Query: "model:eos"})
+	_ = smart.DeleteSmartAlbum(ctx, "Fuji")
+
+	reloaded, err := NewSmartAlbumService(store, configured)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Fuji comes from config, so it is back; the edited Canon replaces the
+	// configured one.
+	want := []domain.SmartAlbum{{Name: "All", Query: ""}, {Name: "Canon", Query: "model:eos"}, {Name: "Fuji", Query: "model:x100"}}
+	if got := reloaded.ListSmartAlbums(ctx); !slices.Equal(got, want) {
+		t.Errorf("reloaded = %v, want %v", got, want)
+	}
+
+	if _, err := NewSmartAlbumService(store, []domain.SmartAlbum{{Name: "bad", Query: "color:red"}}); !errors.Is(err, domain.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got: %v", err)
+	}
+}
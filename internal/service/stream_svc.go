@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// StreamAlbums is implemented by AlbumService to give StreamService the
+// albums to interleave.
+type StreamAlbums interface {
+	ListAlbums(ctx context.Context) []domain.AlbumItem
+	AlbumPhotos(ctx context.Context, albumKey string, opts domain.ListOptions) ([]domain.PhotoInfo, error)
+	LibraryKey() string
+}
+
+// StreamService interleaves the photos of many albums into one stream, such
+// as for a display cycling through the whole library.
+type StreamService struct {
+	albums  StreamAlbums
+	mapper  domain.Mapper
+	shuffle domain.PhotoListStrategy
+}
+
+// NewStreamService returns a StreamService that shuffles random streams with
+// shuffle.
+func NewStreamService(albums StreamAlbums, mapper domain.Mapper, shuffle domain.PhotoListStrategy) *StreamService {
+	return &StreamService{albums: albums, mapper: mapper, shuffle: shuffle}
+}
+
+// Stream interleaves the photos of the albums with the given keys, or of
+// every listed album if there are none, as mode says. opts filters and orders
+// the photos of each album, and its Seed also drives the interleaving. A
+// photo in several albums is streamed once, from the first of them.
+func (s *StreamService) Stream(ctx context.Context, keys []string, mode string, opts domain.ListOptions) (domain.PhotoStream, error) {
+	switch mode {
+	case "":
+		mode = domain.StreamRoundRobin
+	case domain.StreamRoundRobin, domain.StreamProportional, domain.StreamRandom:
+	default:
+		return domain.PhotoStream{}, domain.ErrInvalidMode
+	}
+	if len(keys) == 0 {
+		items := s.albums.ListAlbums(ctx)
+		sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+	}
+
+	// lanes[i] holds the photos streamed from the album keys[i].
+	lanes := make([][]domain.PhotoInfo, len(keys))
+	origin := make(map[domain.PhotoRef]string)
+	for i, key := range keys {
+		photos, err := s.albums.AlbumPhotos(ctx, key, opts)
+		if err != nil {
+			return domain.PhotoStream{}, err
+		}
+		for _, p := range photos {
+			ref := domain.PhotoRef{SourceID: p.SourceID, Path: p.Path}
+			if _, ok := origin[ref]; ok {
+				continue
+			}
+			origin[ref] = key
+			lanes[i] = append(lanes[i], p)
+		}
+	}
+
+	var merged []domain.PhotoInfo
+	switch mode {
+	case domain.StreamRoundRobin:
+		merged = roundRobin(lanes)
+	case domain.StreamProportional:
+		merged = proportional(lanes, opts.Seed)
+	case domain.StreamRandom:
+		var err error
+		if merged, err = s.shuffle.Arrange(ctx, roundRobin(lanes), domain.ArrangeOptions{Seed: opts.Seed, Viewer: opts.Viewer}); err != nil {
+			return domain.PhotoStream{}, err
+		}
+	}
+
+	stream := domain.PhotoStream{Album: s.albums.LibraryKey(), Photos: make([]domain.StreamPhoto, 0, len(merged))}
+	for _, p := range merged {
+		stream.Photos = append(stream.Photos, domain.StreamPhoto{
+			Key:       domain.EncodePhotoRef(s.mapper, p.SourceID, p.Path),
+			Type:      domain.MediaType(p.Path),
+			AlbumKey:  origin[domain.PhotoRef{SourceID: p.SourceID, Path: p.Path}],
+			AlbumName: p.AlbumName,
+		})
+	}
+	return stream, nil
+}
+
+// roundRobin takes the next photo of each lane in turn, skipping lanes that
+// have run out.
+func roundRobin(lanes [][]domain.PhotoInfo) []domain.PhotoInfo {
+	var merged []domain.PhotoInfo
+	for i := 0; ; i++ {
+		taken := false
+		for _, lane := range lanes {
+			if i < len(lane) {
+				merged = append(merged, lane[i])
+				taken = true
+			}
+		}
+		if !taken {
+			return merged
+		}
+	}
+}
+
+// proportional spreads the photos of each lane evenly over the result while
+// keeping their order: the i-th of n photos sits at (i+offset)/n of the way
+// through, where each lane's offset in [0, 1) comes from seed.
+func proportional(lanes [][]domain.PhotoInfo, seed uint64) []domain.PhotoInfo {
+	type placed struct {
+		at    float64
+		photo domain.PhotoInfo
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+	var all []placed
+	for _, lane := range lanes {
+		offset := rng.Float64()
+		for i, p := range lane {
+			all = append(all, placed{at: (float64(i) + offset) / float64(len(lane)), photo: p})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].at < all[j].at })
+	merged := make([]domain.PhotoInfo, 0, len(all))
+	for _, p := range all {
+		merged = append(merged, p.photo)
+	}
+	return merged
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+	"github.com/Aquila-f/photo-slider/internal/mapper"
+	"github.com/Aquila-f/photo-slider/internal/strategy"
+)
+
+// fakeStreamAlbums serves albums named after their keys whose photos are
+// sourceless paths.
+type fakeStreamAlbums map[string][]string
+
+func (f fakeStreamAlbums) ListAlbums(context.Context) []domain.AlbumItem {
+	var items []domain.AlbumItem
+	for key := range f {
+		items = append(items, domain.AlbumItem{Name: key, Key: key})
+	}
+	return items
+}
+
+func (f fakeStreamAlbums) AlbumPhotos(_ context.Context, key string, _ domain.ListOptions) ([]domain.PhotoInfo, error) {
+	paths, ok := f[key]
+	if !ok {
+		return nil, domain.ErrAlbumNotFound
+	}
+	var photos []domain.PhotoInfo
+	for _, p := range paths {
+		photos = append(photos, domain.PhotoInfo{AlbumName: key, Path: p})
+	}
+	return photos, nil
+}
+
+func (f fakeStreamAlbums) LibraryKey() string { return "lib" }
+
+func streamPaths(t *testing.T, s *StreamService, keys []string, mode string) []string {
+	t.Helper()
+	stream, err := s.Stream(context.Background(), keys, mode, domain.ListOptions{Seed: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, p := range stream.Photos {
+		_, path, err := domain.DecodePhotoRef(s.mapper, p.Key)
+		if err != nil {
+			t.Fatalf("bad key %q: %v", p.Key, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func newFakeStream() *StreamService {
+	albums := fakeStreamAlbums{
+		"a": {"a1", "a2", "a3", "a4"},
+		"b": {"b1", "b2"},
+		"c": {"c1", "a2"},
+	}
+	return NewStreamService(albums, mapper.NewBase64Mapper(), strategy.NewRandomListStrategy())
+}
+
+func TestStreamService_RoundRobin(t *testing.T) {
+	got := streamPaths(t, newFakeStream(), nil, "")
+	// Every listed album by name; a2 was already streamed from a.
+	want := []string{"a1", "b1", "c1", "a2", "b2", "a3", "a4"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStreamService_Proportional(t *testing.T) {
+	got := streamPaths(t, newFakeStream(), []string{"a", "b"}, domain.StreamProportional)
+	if len(got) != 6 {
+		t.Fatalf("got %v, want 6 photos", got)
+	}
+	// Album order is kept and b is spread out rather than bunched together.
+	var as, bAt []int
+	for i, p := range got {
+		if p[0] == 'a' {
+			as = append(as, int(p[1]-'0'))
+		} else {
+			bAt = append(bAt, i)
+		}
+	}
+	if !slices.Equal(as, []int{1, 2, 3, 4}) {
+		t.Errorf("album a out of order: %v", got)
+	}
+	if bAt[1]-bAt[0] < 2 {
+		t.Errorf("album b not spread out: %v", got)
+	}
+}
+
+func TestStreamService_RandomIsSeeded(t *testing.T) {
+	s := newFakeStream()
+	first := streamPaths(t, s, []string{"a", "b"}, domain.StreamRandom)
+	if again := streamPaths(t, s, []string{"a", "b"}, domain.StreamRandom); !slices.Equal(first, again) {
+		t.Errorf("same seed gave %v and %v", first, again)
+	}
+	sorted := slices.Sorted(slices.Values(first))
+	if !slices.Equal(sorted, []string{"a1", "a2", "a3", "a4", "b1", "b2"}) {
+		t.Errorf("got %v, want every photo once", first)
+	}
+}
+
+func TestStreamService_Errors(t *testing.T) {
+	s := newFakeStream()
+	ctx := context.Background()
+	if _, err := s.Stream(ctx, nil, "bogus", domain.ListOptions{}); !errors.Is(err, domain.ErrInvalidMode) {
+		t.Errorf("err = %v, want ErrInvalidMode", err)
+	}
+	if _, err := s.Stream(ctx, []string{"a", "missing"}, "", domain.ListOptions{}); !errors.Is(err, domain.ErrAlbumNotFound) {
+		t.Errorf("err = %v, want ErrAlbumNotFound", err)
+	}
+}
+
+func TestStreamService_KeysPlayThroughPhotoRoute(t *testing.T) {
+	svc, _ := newSmartTestService(t)
+	ctx := context.Background()
+	s := NewStreamService(svc, svc.albumMapper, strategy.NewRandomListStrategy())
+
+	stream, err := s.Stream(ctx, nil, "", domain.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stream.Photos) != 3 {
+		t.Fatalf("stream = %+v, want 3 photos", stream)
+	}
+	for _, p := range stream.Photos {
+		if _, err := svc.ReadPhoto(ctx, stream.Album, p.Key); err != nil {
+			t.Errorf("ReadPhoto(%q) error: %v", p.Key, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -25,7 +27,12 @@ func (p *LocalFSProvider) ListDir(ctx context.Context, path string) ([]domain.Fi
 	}
 	var files []domain.FileInfo
 	for _, e := range entries {
-		files = append(files, domain.FileInfo{Name: e.Name(), Path: filepath.Join(path, e.Name()), IsDir: e.IsDir()})
+		f := domain.FileInfo{Name: e.Name(), Path: filepath.Join(path, e.Name()), IsDir: e.IsDir()}
+		// Size and mtime are best-effort; a file removed mid-listing keeps zero values.
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			f.Size, f.ModTime = info.Size(), info.ModTime()
+		}
+		files = append(files, f)
 	}
 	return files, nil
 }
@@ -57,3 +64,20 @@ func (p *LocalFSProvider) Walk(ctx context.Context, root string, maxDepth int) (
 func (p *LocalFSProvider) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
 	return os.ReadFile(filepath.Join(p.baseDir, filePath))
 }
+
+func (p *LocalFSProvider) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, domain.FileInfo, error) {
+	f, err := os.Open(filepath.Join(p.baseDir, filePath))
+	if err != nil {
+		return nil, domain.FileInfo{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, domain.FileInfo{}, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, domain.FileInfo{}, fmt.Errorf("%s is a directory", filePath)
+	}
+	return f, domain.FileInfo{Name: info.Name(), Path: filePath, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type doc struct {
+	Names []string `json:"names"`
+}
+
+func TestJSONFile_LoadMissingLeavesValue(t *testing.T) {
+	f := NewJSONFile(filepath.Join(t.TempDir(), "missing.json"))
+	v := doc{Names: []string{"keep"}}
+
+	if err := f.Load(&v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(v.Names) != 1 || v.Names[0] != "keep" {
+		t.Errorf("Load() modified value: %+v", v)
+	}
+}
+
+func TestJSONFile_SaveAndLoad(t *testing.T) {
+	// Save creates missing parent directories.
+	path := filepath.Join(t.TempDir(), "data", "doc.json")
+	f := NewJSONFile(path)
+
+	if err := f.Save(doc{Names: []string{"a", "b"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	var got doc
+	if err := NewJSONFile(path).Load(&got); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(got.Names) != 2 || got.Names[1] != "b" {
+		t.Errorf("Load() = %+v, want [a b]", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+}
+
+func TestJSONFile_LoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var v doc
+	if err := NewJSONFile(path).Load(&v); err == nil {
+		t.Error("expected error for corrupt file")
+	}
+}
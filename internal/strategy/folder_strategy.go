@@ -2,17 +2,39 @@ package strategy
 
 import (
 	"context"
+	"path"
+	"strings"
 
 	"github.com/Aquila-f/photo-slider/internal/domain"
 )
 
-type FolderAlbumStrategy struct{}
+type FolderAlbumStrategy struct {
+	includeSubfolders bool
+}
 
 func NewFolderAlbumStrategy() *FolderAlbumStrategy {
 	return &FolderAlbumStrategy{}
 }
 
+// NewRecursiveFolderAlbumStrategy returns a strategy whose albums also contain
+// every photo beneath their folder, so a parent folder with only subfolders
+// still becomes an album.
+func NewRecursiveFolderAlbumStrategy() *FolderAlbumStrategy {
+	return &FolderAlbumStrategy{includeSubfolders: true}
+}
+
 func (s *FolderAlbumStrategy) GenerateAlbums(ctx context.Context, snaps []domain.DirSnapshot, sourceId string) ([]domain.Album, error) {
+	// members holds, per folder, the snapshots its album is made of: its own,
+	// and with includeSubfolders those of every folder beneath it.
+	members := make(map[string][]int, len(snaps))
+	for i, sub := range snaps {
+		members[sub.Path] = append(members[sub.Path], i)
+		for dir := sub.Path; s.includeSubfolders && dir != ""; {
+			dir = domain.ParentDir(dir)
+			members[dir] = append(members[dir], i)
+		}
+	}
+
 	var albums []domain.Album
 	for _, snap := range snaps {
 		name := snap.Path
@@ -20,9 +42,18 @@ func (s *FolderAlbumStrategy) GenerateAlbums(ctx context.Context, snaps []domain
 			name = "default"
 		}
 		var photos []domain.PhotoInfo
-		for _, f := range snap.Files {
-			if !f.IsDir && domain.IsImage(f.Name) {
-				photos = append(photos, domain.PhotoInfo{AlbumName: name, FilePath: f.Name})
+		for _, i := range members[snap.Path] {
+			sub := snaps[i]
+			rel, _ := relDir(snap.Path, sub.Path)
+			for _, f := range sub.Files {
+				if !f.IsDir && domain.IsMedia(f.Name) {
+					photos = append(photos, domain.PhotoInfo{
+						AlbumName: name,
+						FilePath:  path.Join(rel, f.Name),
+						SourceID:  sourceId,
+						Path:      path.Join(sub.Path, f.Name),
+					})
+				}
 			}
 		}
 		if len(photos) == 0 {
@@ -38,3 +69,16 @@ func (s *FolderAlbumStrategy) GenerateAlbums(ctx context.Context, snaps []domain
 	}
 	return albums, nil
 }
+
+// relDir reports whether dir is root or lies beneath it, and returns dir
+// relative to root.
+func relDir(root, dir string) (string, bool) {
+	if dir == root {
+		return "", true
+	}
+	if root == "" {
+		return dir, true
+	}
+	rest, ok := strings.CutPrefix(dir, root+"/")
+	return rest, ok
+}
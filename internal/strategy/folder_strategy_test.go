@@ -67,14 +67,14 @@ func TestFolderAlbumStrategy_RootPathBecomesDefault(t *testing.T) {
 	}
 }
 
-func TestFolderAlbumStrategy_SkipsNonImageFiles(t *testing.T) {
+func TestFolderAlbumStrategy_SkipsNonMediaFiles(t *testing.T) {
 	snaps := []domain.DirSnapshot{
 		{
 			Path: "docs",
 			Files: []domain.FileInfo{
 				{Name: "readme.txt", IsDir: false},
 				{Name: "photo.jpg", IsDir: false},
-				{Name: "video.mp4", IsDir: false},
+				{Name: "video.avi", IsDir: false},
 			},
 		},
 	}
@@ -91,6 +91,27 @@ func TestFolderAlbumStrategy_SkipsNonImageFiles(t *testing.T) {
 	}
 }
 
+func TestFolderAlbumStrategy_IncludesVideos(t *testing.T) {
+	snaps := []domain.DirSnapshot{
+		{
+			Path: "trip",
+			Files: []domain.FileInfo{
+				{Name: "photo.jpg", IsDir: false},
+				{Name: "clip.mp4", IsDir: false},
+				{Name: "clip2.MOV", IsDir: false},
+			},
+		},
+	}
+
+	albums, err := newStrategy().GenerateAlbums(context.Background(), snaps, "src1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(albums[0].Photos) != 3 {
+		t.Errorf("Photos count = %d, want 3", len(albums[0].Photos))
+	}
+}
+
 func TestFolderAlbumStrategy_SkipsDirectoryEntries(t *testing.T) {
 	snaps := []domain.DirSnapshot{
 		{
@@ -182,4 +203,65 @@ func TestFolderAlbumStrategy_PhotoInfoFields(t *testing.T) {
 	if p.FilePath != "sunset.jpg" {
 		t.Errorf("PhotoInfo.FilePath = %q, want %q", p.FilePath, "sunset.jpg")
 	}
+	if p.SourceID != "src1" {
+		t.Errorf("PhotoInfo.SourceID = %q, want %q", p.SourceID, "src1")
+	}
+	if p.Path != "trip/sunset.jpg" {
+		t.Errorf("PhotoInfo.Path = %q, want %q", p.Path, "trip/sunset.jpg")
+	}
+}
+
+func TestFolderAlbumStrategy_FlatIgnoresSubfolderPhotos(t *testing.T) {
+	snaps := []domain.DirSnapshot{
+		{Path: "2024", Files: []domain.FileInfo{{Name: "summer", IsDir: true}}},
+		{Path: "2024/summer", Files: []domain.FileInfo{{Name: "beach.jpg"}}},
+	}
+
+	albums, err := newStrategy().GenerateAlbums(context.Background(), snaps, "src1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(albums) != 1 || albums[0].Dir != "2024/summer" {
+		t.Fatalf("albums = %+v, want only 2024/summer", albums)
+	}
+}
+
+func TestFolderAlbumStrategy_RecursiveIncludesSubfolders(t *testing.T) {
+	snaps := []domain.DirSnapshot{
+		{Path: "", Files: []domain.FileInfo{{Name: "2024", IsDir: true}, {Name: "2024-notes", IsDir: true}}},
+		{Path: "2024", Files: []domain.FileInfo{{Name: "summer", IsDir: true}, {Name: "winter", IsDir: true}}},
+		{Path: "2024/summer", Files: []domain.FileInfo{{Name: "beach.jpg"}}},
+		{Path: "2024/winter", Files: []domain.FileInfo{{Name: "snow.png"}}},
+		{Path: "2024-notes", Files: []domain.FileInfo{{Name: "note.jpg"}}},
+	}
+
+	albums, err := NewRecursiveFolderAlbumStrategy().GenerateAlbums(context.Background(), snaps, "src1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	byDir := make(map[string]domain.Album, len(albums))
+	for _, a := range albums {
+		byDir[a.Dir] = a
+	}
+	if len(byDir) != 5 {
+		t.Fatalf("expected 5 albums, got %d", len(byDir))
+	}
+
+	year := byDir["2024"]
+	want := []string{"summer/beach.jpg", "winter/snow.png"}
+	if len(year.Photos) != len(want) {
+		t.Fatalf("2024 photos = %+v, want %v", year.Photos, want)
+	}
+	for i, p := range year.Photos {
+		if p.FilePath != want[i] {
+			t.Errorf("Photos[%d].FilePath = %q, want %q", i, p.FilePath, want[i])
+		}
+	}
+	if n := len(byDir[""].Photos); n != 3 {
+		t.Errorf("root photos = %d, want 3", n)
+	}
+	// "2024-notes" shares a prefix with "2024" but is not beneath it.
+	if n := len(byDir["2024-notes"].Photos); n != 1 {
+		t.Errorf("2024-notes photos = %d, want 1", n)
+	}
 }
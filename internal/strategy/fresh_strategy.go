@@ -0,0 +1,124 @@
+package strategy
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+const (
+	// minFreshness keeps just-shown photos possible, only unlikely.
+	minFreshness = 0.01
+	// burstWindow is how close in capture time two shots may be before they
+	// count as the same moment and are kept apart.
+	burstWindow = 5 * time.Minute
+)
+
+// FreshListStrategy is a random order that favors photos the viewer has not
+// seen for a while. Weighted strategies also favor higher ratings and
+// favorites. Shots taken moments apart are not played back to back.
+type FreshListStrategy struct {
+	history  domain.ShowHistory
+	flags    domain.FlagReader
+	index    domain.IndexReader
+	weighted bool
+	now      func() time.Time
+}
+
+// NewFreshListStrategy returns a least-recently-shown strategy; flags may be
+// nil unless weighted is set.
+func NewFreshListStrategy(history domain.ShowHistory, flags domain.FlagReader, weighted bool) *FreshListStrategy {
+	return &FreshListStrategy{history: history, flags: flags, weighted: weighted, now: time.Now}
+}
+
+func (s *FreshListStrategy) SetIndex(index domain.IndexReader) {
+	s.index = index
+}
+
+func (s *FreshListStrategy) Arrange(ctx context.Context, photos []domain.PhotoInfo, opts domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	type candidate struct {
+		photo domain.PhotoInfo
+		key   float64
+		taken time.Time
+	}
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed))
+	now := s.now()
+	candidates := make([]candidate, 0, len(photos))
+	for _, p := range photos {
+		var rec domain.PhotoRecord
+		if s.index != nil {
+			rec, _ = s.index.Get(p.SourceID, p.Path)
+		}
+		c := candidate{photo: p}
+		if rec.TakenAt != nil {
+			c.taken = *rec.TakenAt
+		}
+		// Weighted sampling without replacement (Efraimidis-Spirakis): the
+		// largest log(u)/w go first, so heavier photos tend to come earlier.
+		u := 1 - rng.Float64()
+		c.key = math.Log(u) / s.weight(ctx, rec, opts.Viewer, now)
+		candidates = append(candidates, c)
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return cmp.Compare(b.key, a.key)
+	})
+
+	// Whenever the next photo is from the same moment as the previous one,
+	// pull a later photo forward, or failing that move it back to an earlier
+	// gap where it fits.
+	same := func(a, b candidate) bool { return sameMoment(a.taken, b.taken) }
+	for i := 1; i < len(candidates); i++ {
+		if !same(candidates[i-1], candidates[i]) {
+			continue
+		}
+		if j := slices.IndexFunc(candidates[i+1:], func(c candidate) bool { return !same(candidates[i-1], c) }); j >= 0 {
+			candidates[i], candidates[i+1+j] = candidates[i+1+j], candidates[i]
+			continue
+		}
+		for k := i - 2; k >= 0; k-- {
+			if !same(candidates[i], candidates[k]) && (k == 0 || !same(candidates[k-1], candidates[i])) {
+				c := candidates[i]
+				copy(candidates[k+1:i+1], candidates[k:i])
+				candidates[k] = c
+				break
+			}
+		}
+	}
+
+	out := make([]domain.PhotoInfo, 0, len(candidates))
+	for _, c := range candidates {
+		out = append(out, c.photo)
+	}
+	return out, nil
+}
+
+// weight is the photo's freshness, from minFreshness just after it was shown
+// up to 1 once domain.FreshHorizon has passed, times its rating bonus if weighted.
+func (s *FreshListStrategy) weight(ctx context.Context, rec domain.PhotoRecord, viewer string, now time.Time) float64 {
+	w := 1.0
+	if s.history != nil {
+		if shown, ok := s.history.LastShown(viewer, rec); ok {
+			w = max(minFreshness, min(1, float64(now.Sub(shown))/float64(domain.FreshHorizon)))
+		}
+	}
+	if s.weighted && s.flags != nil && rec.Hash != "" {
+		flags := s.flags.Flags(ctx, rec)
+		w *= 1 + 0.5*float64(flags.Rating)
+		if flags.Favorite {
+			w *= 2
+		}
+	}
+	return w
+}
+
+func sameMoment(a, b time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return false
+	}
+	return a.Sub(b).Abs() < burstWindow
+}
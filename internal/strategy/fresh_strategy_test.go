@@ -0,0 +1,113 @@
+package strategy
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// fakeHistory serves last-shown times keyed by content hash.
+type fakeHistory map[string]time.Time
+
+func (h fakeHistory) LastShown(_ string, rec domain.PhotoRecord) (time.Time, bool) {
+	t, ok := h[rec.Hash]
+	return t, ok
+}
+
+// fakeFlags serves flags keyed by content hash.
+type fakeFlags map[string]domain.PhotoFlags
+
+func (f fakeFlags) Flags(_ context.Context, rec domain.PhotoRecord) domain.PhotoFlags {
+	return f[rec.Hash]
+}
+
+// hashedIndex indexes each path with itself as the content hash.
+func hashedIndex(paths ...string) fakeIndex {
+	index := fakeIndex{}
+	for _, p := range paths {
+		index[p] = domain.PhotoRecord{Path: p, Hash: p}
+	}
+	return index
+}
+
+// positions arranges photos under many seeds and counts where each path lands.
+func positions(t *testing.T, s *FreshListStrategy, photos []domain.PhotoInfo) map[string][]int {
+	t.Helper()
+	counts := make(map[string][]int)
+	for _, p := range photos {
+		counts[p.Path] = make([]int, len(photos))
+	}
+	for seed := range uint64(200) {
+		got, err := s.Arrange(context.Background(), photos, domain.ArrangeOptions{Seed: seed})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, p := range got {
+			counts[p.Path][i]++
+		}
+	}
+	return counts
+}
+
+func TestFreshListStrategy_JustShownGoesLast(t *testing.T) {
+	photos := photosAt("a", "b", "c", "d", "e")
+	s := NewFreshListStrategy(fakeHistory{"c": time.Now()}, nil, false)
+	s.SetIndex(hashedIndex("a", "b", "c", "d", "e"))
+
+	if last := positions(t, s, photos)["c"][4]; last < 170 {
+		t.Errorf("just-shown photo was last in %d of 200 orders, want nearly all", last)
+	}
+}
+
+func TestFreshListStrategy_WeightedFavorsRatedFavorites(t *testing.T) {
+	photos := photosAt("a", "b", "c", "d")
+	s := NewFreshListStrategy(nil, fakeFlags{"d": {Favorite: true, Rating: 5}}, true)
+	s.SetIndex(hashedIndex("a", "b", "c", "d"))
+
+	counts := positions(t, s, photos)
+	if first := counts["d"][0]; first < 100 {
+		t.Errorf("favorite was first in %d of 200 orders, want most", first)
+	}
+
+	unweighted := NewFreshListStrategy(nil, fakeFlags{"d": {Favorite: true, Rating: 5}}, false)
+	unweighted.SetIndex(hashedIndex("a", "b", "c", "d"))
+	if first := positions(t, unweighted, photos)["d"][0]; first > 80 {
+		t.Errorf("unweighted favorite was first in %d of 200 orders, want about 50", first)
+	}
+}
+
+func TestFreshListStrategy_SeparatesBursts(t *testing.T) {
+	at := func(minute int) *time.Time {
+		tm := time.Date(2024, 7, 1, 10, minute, 0, 0, time.UTC)
+		return &tm
+	}
+	index := fakeIndex{
+		"burst1": {TakenAt: at(0)},
+		"burst2": {TakenAt: at(1)},
+		"later":  {TakenAt: at(45)},
+	}
+	s := NewFreshListStrategy(nil, nil, false)
+	s.SetIndex(index)
+
+	for seed := range uint64(50) {
+		got, _ := s.Arrange(context.Background(), photosAt("burst1", "burst2", "later"), domain.ArrangeOptions{Seed: seed})
+		if got[1].Path != "later" {
+			t.Fatalf("seed %d: burst shots back to back: %v", seed, paths(got))
+		}
+	}
+}
+
+func TestFreshListStrategy_Reproducible(t *testing.T) {
+	in := photosAt("a", "b", "c", "d", "e", "f")
+	s := NewFreshListStrategy(nil, nil, false)
+
+	first, _ := s.Arrange(context.Background(), in, domain.ArrangeOptions{Seed: 3})
+	again, _ := s.Arrange(context.Background(), in, domain.ArrangeOptions{Seed: 3})
+	if !slices.Equal(paths(first), paths(again)) {
+		t.Errorf("same seed gave %v and %v", paths(first), paths(again))
+	}
+	assertPaths(t, in, "a", "b", "c", "d", "e", "f")
+}
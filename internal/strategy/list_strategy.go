@@ -2,19 +2,28 @@ package strategy
 
 import (
 	"context"
-	"math/rand"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
 )
 
+// RandomListStrategy shuffles photos in an order fixed by the seed, so every
+// client given the same seed plays the same sequence.
 type RandomListStrategy struct{}
 
 func NewRandomListStrategy() *RandomListStrategy {
 	return &RandomListStrategy{}
 }
 
-func (s *RandomListStrategy) Arrange(_ context.Context, tokens []string) ([]string, error) {
-	// Fisher-Yates shuffle
-	rand.Shuffle(len(tokens), func(i, j int) {
-		tokens[i], tokens[j] = tokens[j], tokens[i]
-	})
-	return tokens, nil
+func (s *RandomListStrategy) Arrange(_ context.Context, photos []domain.PhotoInfo, opts domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	out := slices.Clone(photos)
+	// Fisher-Yates shuffle. PCG's output is specified, unlike rand.Shuffle's
+	// use of it, so the permutation stays the same across Go releases.
+	rng := rand.NewPCG(opts.Seed, opts.Seed)
+	for i := len(out) - 1; i > 0; i-- {
+		j := int(rng.Uint64() % uint64(i+1))
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
 }
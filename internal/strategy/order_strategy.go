@@ -0,0 +1,169 @@
+package strategy
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// NewListStrategies returns every photo list strategy keyed by the name used
+// in ?order= and in album config.
+func NewListStrategies() map[string]domain.PhotoListStrategy {
+	return map[string]domain.PhotoListStrategy{
+		"name":       NewNameListStrategy(),
+		"taken":      NewTakenListStrategy(false),
+		"taken_desc": NewTakenListStrategy(true),
+		"mtime":      NewModTimeListStrategy(false),
+		"mtime_desc": NewModTimeListStrategy(true),
+		"reverse":    NewReverseListStrategy(),
+		"random":     NewRandomListStrategy(),
+	}
+}
+
+// NameListStrategy sorts photos by file name the way people count, so IMG_2
+// comes before IMG_10.
+type NameListStrategy struct{}
+
+func NewNameListStrategy() *NameListStrategy {
+	return &NameListStrategy{}
+}
+
+func (s *NameListStrategy) Arrange(_ context.Context, photos []domain.PhotoInfo, _ domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	out := slices.Clone(photos)
+	slices.SortStableFunc(out, compareNames)
+	return out, nil
+}
+
+// ReverseListStrategy plays photos back to front.
+type ReverseListStrategy struct{}
+
+func NewReverseListStrategy() *ReverseListStrategy {
+	return &ReverseListStrategy{}
+}
+
+func (s *ReverseListStrategy) Arrange(_ context.Context, photos []domain.PhotoInfo, _ domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	out := slices.Clone(photos)
+	slices.Reverse(out)
+	return out, nil
+}
+
+// timeListStrategy sorts photos by a time read from the index. Photos without
+// one go last, and ties fall back to the file name.
+type timeListStrategy struct {
+	desc  bool
+	index domain.IndexReader
+	field func(domain.PhotoRecord) time.Time
+}
+
+func (s *timeListStrategy) SetIndex(index domain.IndexReader) {
+	s.index = index
+}
+
+func (s *timeListStrategy) Arrange(_ context.Context, photos []domain.PhotoInfo, _ domain.ArrangeOptions) ([]domain.PhotoInfo, error) {
+	times := make(map[domain.PhotoRef]time.Time, len(photos))
+	if s.index != nil {
+		for _, p := range photos {
+			if rec, ok := s.index.Get(p.SourceID, p.Path); ok {
+				times[domain.PhotoRef{SourceID: p.SourceID, Path: p.Path}] = s.field(rec)
+			}
+		}
+	}
+	out := slices.Clone(photos)
+	slices.SortStableFunc(out, func(a, b domain.PhotoInfo) int {
+		ta := times[domain.PhotoRef{SourceID: a.SourceID, Path: a.Path}]
+		tb := times[domain.PhotoRef{SourceID: b.SourceID, Path: b.Path}]
+		switch {
+		case ta.IsZero() != tb.IsZero():
+			if ta.IsZero() {
+				return 1
+			}
+			return -1
+		case !ta.Equal(tb):
+			c := ta.Compare(tb)
+			if s.desc {
+				c = -c
+			}
+			return c
+		}
+		return compareNames(a, b)
+	})
+	return out, nil
+}
+
+// NewTakenListStrategy sorts photos by EXIF capture time.
+func NewTakenListStrategy(desc bool) domain.PhotoListStrategy {
+	return &timeListStrategy{desc: desc, field: func(rec domain.PhotoRecord) time.Time {
+		if rec.TakenAt == nil {
+			return time.Time{}
+		}
+		return *rec.TakenAt
+	}}
+}
+
+// NewModTimeListStrategy sorts photos by file modification time.
+func NewModTimeListStrategy(desc bool) domain.PhotoListStrategy {
+	return &timeListStrategy{desc: desc, field: func(rec domain.PhotoRecord) time.Time {
+		return rec.ModTime
+	}}
+}
+
+// compareNames orders photos by base name in natural order, then by full
+// path so that equal names in different folders stay apart.
+func compareNames(a, b domain.PhotoInfo) int {
+	if c := naturalCompare(path.Base(a.Path), path.Base(b.Path)); c != 0 {
+		return c
+	}
+	return naturalCompare(a.Path, b.Path)
+}
+
+// naturalCompare compares strings case-insensitively, treating runs of digits
+// as numbers.
+func naturalCompare(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := digitRun(a)
+			nb, rb := digitRun(b)
+			if c := compareNumbers(na, nb); c != 0 {
+				return c
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitRun splits s into its leading digits and the rest.
+func digitRun(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareNumbers compares decimal strings of any length by value; with equal
+// values the one with fewer leading zeros comes first.
+func compareNumbers(a, b string) int {
+	ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(ta) != len(tb) {
+		return len(ta) - len(tb)
+	}
+	if c := strings.Compare(ta, tb); c != 0 {
+		return c
+	}
+	return len(a) - len(b)
+}
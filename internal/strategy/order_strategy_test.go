@@ -0,0 +1,150 @@
+package strategy
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Aquila-f/photo-slider/internal/domain"
+)
+
+// fakeIndex serves records keyed by path.
+type fakeIndex map[string]domain.PhotoRecord
+
+func (x fakeIndex) Records(_ context.Context) []domain.PhotoRecord {
+	return nil
+}
+
+func (x fakeIndex) Get(_, p string) (domain.PhotoRecord, bool) {
+	rec, ok := x[p]
+	return rec, ok
+}
+
+func photosAt(paths ...string) []domain.PhotoInfo {
+	photos := make([]domain.PhotoInfo, 0, len(paths))
+	for _, p := range paths {
+		photos = append(photos, domain.PhotoInfo{FilePath: p, SourceID: "src", Path: p})
+	}
+	return photos
+}
+
+func paths(photos []domain.PhotoInfo) []string {
+	out := make([]string, 0, len(photos))
+	for _, p := range photos {
+		out = append(out, p.Path)
+	}
+	return out
+}
+
+func assertPaths(t *testing.T, got []domain.PhotoInfo, want ...string) {
+	t.Helper()
+	g := paths(got)
+	if len(g) != len(want) {
+		t.Fatalf("got %v, want %v", g, want)
+	}
+	for i := range want {
+		if g[i] != want[i] {
+			t.Fatalf("got %v, want %v", g, want)
+		}
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"IMG_2.jpg", "IMG_10.jpg", -1},
+		{"img_10.jpg", "IMG_9.jpg", 1},
+		{"a.jpg", "A.jpg", 0},
+		{"IMG_002.jpg", "IMG_2.jpg", 1},
+		{"IMG_2.jpg", "IMG_2a.jpg", -1},
+		{"99999999999999999999.jpg", "100000000000000000000.jpg", -1},
+	}
+	for _, tt := range tests {
+		got := naturalCompare(tt.a, tt.b)
+		if (got < 0) != (tt.want < 0) || (got > 0) != (tt.want > 0) {
+			t.Errorf("naturalCompare(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNameListStrategy(t *testing.T) {
+	in := photosAt("b/IMG_10.jpg", "IMG_2.jpg", "a/IMG_10.jpg", "IMG_1.jpg")
+
+	got, err := NewNameListStrategy().Arrange(context.Background(), in, domain.ArrangeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertPaths(t, got, "IMG_1.jpg", "IMG_2.jpg", "a/IMG_10.jpg", "b/IMG_10.jpg")
+	assertPaths(t, in, "b/IMG_10.jpg", "IMG_2.jpg", "a/IMG_10.jpg", "IMG_1.jpg")
+}
+
+func TestTakenListStrategy(t *testing.T) {
+	day := func(d int) *time.Time {
+		tm := time.Date(2024, 7, d, 0, 0, 0, 0, time.UTC)
+		return &tm
+	}
+	index := fakeIndex{
+		"a.jpg": {TakenAt: day(3)},
+		"b.jpg": {TakenAt: day(1)},
+		"c.jpg": {},
+		"d.jpg": {TakenAt: day(2)},
+	}
+	in := photosAt("a.jpg", "b.jpg", "c.jpg", "d.jpg", "unindexed.jpg")
+
+	asc := NewTakenListStrategy(false)
+	asc.(domain.IndexConsumer).SetIndex(index)
+	got, _ := asc.Arrange(context.Background(), in, domain.ArrangeOptions{})
+	assertPaths(t, got, "b.jpg", "d.jpg", "a.jpg", "c.jpg", "unindexed.jpg")
+
+	desc := NewTakenListStrategy(true)
+	desc.(domain.IndexConsumer).SetIndex(index)
+	got, _ = desc.Arrange(context.Background(), in, domain.ArrangeOptions{})
+	assertPaths(t, got, "a.jpg", "d.jpg", "b.jpg", "c.jpg", "unindexed.jpg")
+}
+
+func TestModTimeListStrategy(t *testing.T) {
+	base := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	index := fakeIndex{
+		"old.jpg": {ModTime: base},
+		"new.jpg": {ModTime: base.Add(time.Hour)},
+	}
+	s := NewModTimeListStrategy(true)
+	s.(domain.IndexConsumer).SetIndex(index)
+
+	got, _ := s.Arrange(context.Background(), photosAt("old.jpg", "new.jpg"), domain.ArrangeOptions{})
+	assertPaths(t, got, "new.jpg", "old.jpg")
+}
+
+func TestReverseListStrategy(t *testing.T) {
+	in := photosAt("a.jpg", "b.jpg", "c.jpg")
+
+	got, _ := NewReverseListStrategy().Arrange(context.Background(), in, domain.ArrangeOptions{})
+	assertPaths(t, got, "c.jpg", "b.jpg", "a.jpg")
+	assertPaths(t, in, "a.jpg", "b.jpg", "c.jpg")
+}
+
+func TestRandomListStrategy_Seeded(t *testing.T) {
+	in := photosAt("a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg", "f.jpg", "g.jpg", "h.jpg")
+	s := NewRandomListStrategy()
+	ctx := context.Background()
+
+	first, _ := s.Arrange(ctx, in, domain.ArrangeOptions{Seed: 7})
+	again, _ := s.Arrange(ctx, in, domain.ArrangeOptions{Seed: 7})
+	assertPaths(t, again, paths(first)...)
+	assertPaths(t, in, "a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg", "f.jpg", "g.jpg", "h.jpg")
+
+	other, _ := s.Arrange(ctx, in, domain.ArrangeOptions{Seed: 8})
+	if slices.Equal(paths(first), paths(other)) {
+		t.Errorf("seeds 7 and 8 gave the same order %v", paths(first))
+	}
+}
+
+// TestRandomListStrategy_StableAcrossReleases pins the permutation so a seed
+// handed out by one server version replays on the next.
+func TestRandomListStrategy_StableAcrossReleases(t *testing.T) {
+	got, _ := NewRandomListStrategy().Arrange(context.Background(), photosAt("a", "b", "c", "d", "e"), domain.ArrangeOptions{Seed: 1})
+	assertPaths(t, got, "c", "e", "b", "d", "a")
+}